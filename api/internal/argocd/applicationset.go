@@ -0,0 +1,141 @@
+package argocd
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"pn-infra/api/internal/config"
+)
+
+// ApplicationSet is an argoproj.io/v1alpha1 ApplicationSet
+type ApplicationSet struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   Metadata           `yaml:"metadata"`
+	Spec       ApplicationSetSpec `yaml:"spec"`
+}
+
+type ApplicationSetSpec struct {
+	GoTemplate        bool                `yaml:"goTemplate"`
+	GoTemplateOptions []string            `yaml:"goTemplateOptions"`
+	Generators        []Generator         `yaml:"generators"`
+	Template          ApplicationTemplate `yaml:"template"`
+	TemplatePatch     string              `yaml:"templatePatch"`
+}
+
+type Generator struct {
+	List ListGenerator `yaml:"list"`
+}
+
+type ListGenerator struct {
+	Elements []map[string]interface{} `yaml:"elements"`
+}
+
+type ApplicationTemplate struct {
+	Metadata Metadata        `yaml:"metadata"`
+	Spec     ApplicationSpec `yaml:"spec"`
+}
+
+// templatePatch adds the fields that differ in shape between applications,
+// such as Helm values and sync policies, from the patch of each element
+const templatePatch = "{{ toJson .patch }}\n"
+
+// newApplicationSet builds the ApplicationSet of an environment from its
+// Applications. A list generator holds one element per application: the
+// fields the template substitutes, and a patch with the rest of its spec.
+func newApplicationSet(settings config.ArgoCDSettings, environment string, apps []Application) (ApplicationSet, error) {
+	elements := make([]map[string]interface{}, 0, len(apps))
+	for _, app := range apps {
+		spec := map[string]interface{}{}
+		source := map[string]interface{}{}
+		if app.Spec.Source.Helm != nil {
+			helm, err := toValue(app.Spec.Source.Helm)
+			if err != nil {
+				return ApplicationSet{}, fmt.Errorf("application %s: %w", app.Metadata.Name, err)
+			}
+			source["helm"] = helm
+		}
+		if app.Spec.Source.Kustomize != nil {
+			kustomize, err := toValue(app.Spec.Source.Kustomize)
+			if err != nil {
+				return ApplicationSet{}, fmt.Errorf("application %s: %w", app.Metadata.Name, err)
+			}
+			source["kustomize"] = kustomize
+		}
+		if len(source) > 0 {
+			spec["source"] = source
+		}
+		if app.Spec.SyncPolicy != nil {
+			syncPolicy, err := toValue(app.Spec.SyncPolicy)
+			if err != nil {
+				return ApplicationSet{}, fmt.Errorf("application %s: %w", app.Metadata.Name, err)
+			}
+			spec["syncPolicy"] = syncPolicy
+		}
+		if len(app.Spec.IgnoreDifferences) > 0 {
+			ignored, err := toValue(app.Spec.IgnoreDifferences)
+			if err != nil {
+				return ApplicationSet{}, fmt.Errorf("application %s: %w", app.Metadata.Name, err)
+			}
+			spec["ignoreDifferences"] = ignored
+		}
+		patch := map[string]interface{}{}
+		if len(spec) > 0 {
+			patch["spec"] = spec
+		}
+		elements = append(elements, map[string]interface{}{
+			"name":           app.Metadata.Name,
+			"namespace":      app.Spec.Destination.Namespace,
+			"path":           app.Spec.Source.Path,
+			"targetRevision": app.Spec.Source.TargetRevision,
+			"syncWave":       app.Metadata.Annotations[SyncWaveAnnotation],
+			"patch":          patch,
+		})
+	}
+
+	return ApplicationSet{
+		APIVersion: APIVersion,
+		Kind:       "ApplicationSet",
+		Metadata: Metadata{
+			Name:      "business-" + environment,
+			Namespace: firstNonEmpty(settings.Namespace, DefaultNamespace),
+		},
+		Spec: ApplicationSetSpec{
+			GoTemplate:        true,
+			GoTemplateOptions: []string{"missingkey=error"},
+			Generators:        []Generator{{List: ListGenerator{Elements: elements}}},
+			Template: ApplicationTemplate{
+				Metadata: Metadata{
+					Name:        "{{ .name }}",
+					Annotations: map[string]string{SyncWaveAnnotation: "{{ .syncWave }}"},
+					Finalizers:  []string{Finalizer},
+				},
+				Spec: ApplicationSpec{
+					Project: firstNonEmpty(settings.Project, DefaultProject),
+					Source: Source{
+						RepoURL:        settings.RepoURL,
+						TargetRevision: "{{ .targetRevision }}",
+						Path:           "{{ .path }}",
+					},
+					Destination: newDestination(settings, "{{ .namespace }}"),
+				},
+			},
+			TemplatePatch: templatePatch,
+		},
+	}, nil
+}
+
+// toValue converts v to the generic maps and lists it encodes to, so that
+// it keeps its YAML field names inside a list generator element
+func toValue(v interface{}) (interface{}, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,306 @@
+// Package argocd generates Argo CD Application and ApplicationSet manifests
+// for the business applications when their deployment method is argocd
+package argocd
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/manifest"
+)
+
+// Argo CD API identifiers and defaults
+const (
+	APIVersion         = "argoproj.io/v1alpha1"
+	SyncWaveAnnotation = "argocd.argoproj.io/sync-wave"
+	Finalizer          = "resources-finalizer.argocd.argoproj.io"
+	InClusterServer    = "https://kubernetes.default.svc"
+
+	DefaultProject        = "default"
+	DefaultNamespace      = "argocd"
+	DefaultTargetRevision = "HEAD"
+)
+
+// Manifest kinds selected by business.argocd.manifest
+const (
+	ManifestApplications   = "applications"
+	ManifestApplicationSet = "applicationset"
+)
+
+// OutputDir is the directory, relative to the environment output directory,
+// the manifests are written to
+const OutputDir = "argocd"
+
+// Metadata is the object metadata of a manifest
+type Metadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Finalizers  []string          `yaml:"finalizers,omitempty"`
+}
+
+// Application is an argoproj.io/v1alpha1 Application
+type Application struct {
+	APIVersion string          `yaml:"apiVersion"`
+	Kind       string          `yaml:"kind"`
+	Metadata   Metadata        `yaml:"metadata"`
+	Spec       ApplicationSpec `yaml:"spec"`
+}
+
+type ApplicationSpec struct {
+	Project           string             `yaml:"project"`
+	Source            Source             `yaml:"source"`
+	Destination       Destination        `yaml:"destination"`
+	SyncPolicy        *SyncPolicy        `yaml:"syncPolicy,omitempty"`
+	IgnoreDifferences []IgnoreDifference `yaml:"ignoreDifferences,omitempty"`
+}
+
+type Source struct {
+	RepoURL        string           `yaml:"repoURL"`
+	TargetRevision string           `yaml:"targetRevision"`
+	Path           string           `yaml:"path"`
+	Helm           *HelmSource      `yaml:"helm,omitempty"`
+	Kustomize      *KustomizeSource `yaml:"kustomize,omitempty"`
+}
+
+type HelmSource struct {
+	ReleaseName  string                 `yaml:"releaseName"`
+	ValuesObject map[string]interface{} `yaml:"valuesObject,omitempty"`
+}
+
+type KustomizeSource struct {
+	Images   []string  `yaml:"images,omitempty"`
+	Replicas []Replica `yaml:"replicas,omitempty"`
+}
+
+type Replica struct {
+	Name  string `yaml:"name"`
+	Count int    `yaml:"count"`
+}
+
+type Destination struct {
+	Server    string `yaml:"server,omitempty"`
+	Name      string `yaml:"name,omitempty"`
+	Namespace string `yaml:"namespace"`
+}
+
+type SyncPolicy struct {
+	Automated   *Automated `yaml:"automated,omitempty"`
+	SyncOptions []string   `yaml:"syncOptions,omitempty"`
+	Retry       *Retry     `yaml:"retry,omitempty"`
+}
+
+type Automated struct {
+	Prune    bool `yaml:"prune"`
+	SelfHeal bool `yaml:"selfHeal"`
+}
+
+type Retry struct {
+	Limit   int      `yaml:"limit"`
+	Backoff *Backoff `yaml:"backoff,omitempty"`
+}
+
+type Backoff struct {
+	Duration    string `yaml:"duration,omitempty"`
+	Factor      int    `yaml:"factor,omitempty"`
+	MaxDuration string `yaml:"maxDuration,omitempty"`
+}
+
+type IgnoreDifference struct {
+	Group                 string   `yaml:"group,omitempty"`
+	Kind                  string   `yaml:"kind"`
+	Name                  string   `yaml:"name,omitempty"`
+	Namespace             string   `yaml:"namespace,omitempty"`
+	JSONPointers          []string `yaml:"jsonPointers,omitempty"`
+	JQPathExpressions     []string `yaml:"jqPathExpressions,omitempty"`
+	ManagedFieldsManagers []string `yaml:"managedFieldsManagers,omitempty"`
+}
+
+// Manifests generates the manifests of the enabled business applications:
+// an Application per app in argocd/<app>.yaml, or with manifest:
+// applicationset one ApplicationSet for the environment in
+// argocd/applicationset.yaml, each starting with header
+func Manifests(merged *config.MergedConfig, header string) ([]manifest.File, error) {
+	settings := merged.ArgoCD
+	if settings.RepoURL == "" {
+		return nil, errors.New("business.argocd.repo_url is required")
+	}
+	if settings.Destination.Server != "" && settings.Destination.Name != "" {
+		return nil, errors.New("business.argocd.destination: set server or name, not both")
+	}
+
+	var apps []Application
+	for _, app := range merged.Applications {
+		app, override, err := merged.ResolveApplication(app)
+		if err != nil {
+			return nil, fmt.Errorf("application %s: %w", app.Name, err)
+		}
+		if !app.Enabled {
+			continue
+		}
+		application, err := newApplication(settings, app, override)
+		if err != nil {
+			return nil, fmt.Errorf("application %s: %w", app.Name, err)
+		}
+		apps = append(apps, application)
+	}
+
+	switch settings.Manifest {
+	case "", ManifestApplications:
+		files := make([]manifest.File, 0, len(apps))
+		for _, app := range apps {
+			content, err := manifest.Encode(header, app)
+			if err != nil {
+				return nil, fmt.Errorf("encode application %s: %w", app.Metadata.Name, err)
+			}
+			files = append(files, manifest.File{Path: path.Join(OutputDir, app.Metadata.Name+".yaml"), Content: content})
+		}
+		return files, nil
+	case ManifestApplicationSet:
+		set, err := newApplicationSet(settings, merged.Environment, apps)
+		if err != nil {
+			return nil, err
+		}
+		content, err := manifest.Encode(header, set)
+		if err != nil {
+			return nil, fmt.Errorf("encode applicationset: %w", err)
+		}
+		return []manifest.File{{Path: path.Join(OutputDir, "applicationset.yaml"), Content: content}}, nil
+	}
+	return nil, fmt.Errorf("business.argocd.manifest: unsupported manifest %s (use %s or %s)", settings.Manifest, ManifestApplications, ManifestApplicationSet)
+}
+
+// newApplication builds the Application of a business application resolved
+// against its app_overrides entry. The image and replicas overrides of
+// kustomize sources become kustomize images and replicas.
+func newApplication(settings config.ArgoCDSettings, app config.Application, override config.AppOverride) (Application, error) {
+	if app.Namespace == "" {
+		return Application{}, errors.New("no namespace")
+	}
+	if app.Source.Path == "" {
+		return Application{}, errors.New("no source path")
+	}
+
+	source := Source{
+		RepoURL:        settings.RepoURL,
+		TargetRevision: firstNonEmpty(app.Source.TargetRevision, settings.TargetRevision, DefaultTargetRevision),
+		Path:           app.Source.Path,
+	}
+	switch app.Source.Type {
+	case "helm":
+		source.Helm = &HelmSource{ReleaseName: app.Name, ValuesObject: app.Values}
+	case "kustomize":
+		source.Kustomize = newKustomizeSource(app.Name, override)
+	case "directory":
+		if override.Image != nil || override.Replicas != nil {
+			return Application{}, errors.New("app_overrides: image and replicas need a helm or kustomize source")
+		}
+	default:
+		return Application{}, fmt.Errorf("unsupported source type: %s", app.Source.Type)
+	}
+
+	retry := settings.Retry
+	var syncPolicy *SyncPolicy
+	if app.SyncPolicy != nil {
+		syncPolicy = &SyncPolicy{SyncOptions: app.SyncPolicy.SyncOptions}
+		if automated := app.SyncPolicy.Automated; automated.Prune || automated.SelfHeal {
+			syncPolicy.Automated = &Automated{Prune: automated.Prune, SelfHeal: automated.SelfHeal}
+		}
+		if app.SyncPolicy.Retry != nil {
+			retry = app.SyncPolicy.Retry
+		}
+	}
+	if retry != nil {
+		if syncPolicy == nil {
+			syncPolicy = &SyncPolicy{}
+		}
+		syncPolicy.Retry = newRetry(retry)
+	}
+
+	var ignored []IgnoreDifference
+	for _, d := range app.IgnoreDifferences {
+		if d.Kind == "" {
+			return Application{}, errors.New("ignore_differences: kind is required")
+		}
+		ignored = append(ignored, IgnoreDifference{
+			Group:                 d.Group,
+			Kind:                  d.Kind,
+			Name:                  d.Name,
+			Namespace:             d.Namespace,
+			JSONPointers:          d.JSONPointers,
+			JQPathExpressions:     d.JQPathExpressions,
+			ManagedFieldsManagers: d.ManagedFieldsManagers,
+		})
+	}
+
+	return Application{
+		APIVersion: APIVersion,
+		Kind:       "Application",
+		Metadata: Metadata{
+			Name:        app.Name,
+			Namespace:   firstNonEmpty(settings.Namespace, DefaultNamespace),
+			Annotations: map[string]string{SyncWaveAnnotation: strconv.Itoa(app.Wave())},
+			Finalizers:  []string{Finalizer},
+		},
+		Spec: ApplicationSpec{
+			Project:           firstNonEmpty(settings.Project, DefaultProject),
+			Source:            source,
+			Destination:       newDestination(settings, app.Namespace),
+			SyncPolicy:        syncPolicy,
+			IgnoreDifferences: ignored,
+		},
+	}, nil
+}
+
+// newKustomizeSource returns the kustomize image and replica overrides of an
+// application, or nil without any. Images use the kustomize edit set image
+// syntax, name=newName:newTag.
+func newKustomizeSource(name string, override config.AppOverride) *KustomizeSource {
+	var k KustomizeSource
+	if image := override.Image; image != nil {
+		set := image.Repository
+		if newName := image.NewName(); newName != "" {
+			set += "=" + newName
+		}
+		if image.Tag != "" {
+			set += ":" + image.Tag
+		}
+		k.Images = append(k.Images, set)
+	}
+	if override.Replicas != nil {
+		k.Replicas = append(k.Replicas, Replica{Name: name, Count: *override.Replicas})
+	}
+	if len(k.Images) == 0 && len(k.Replicas) == 0 {
+		return nil
+	}
+	return &k
+}
+
+// newDestination returns the configured cluster, or the in-cluster server
+func newDestination(settings config.ArgoCDSettings, namespace string) Destination {
+	destination := Destination{Server: settings.Destination.Server, Name: settings.Destination.Name, Namespace: namespace}
+	if destination.Server == "" && destination.Name == "" {
+		destination.Server = InClusterServer
+	}
+	return destination
+}
+
+func newRetry(retry *config.ApplicationRetry) *Retry {
+	r := &Retry{Limit: retry.Limit}
+	if b := retry.Backoff; b != nil {
+		r.Backoff = &Backoff{Duration: b.Duration, Factor: b.Factor, MaxDuration: b.MaxDuration}
+	}
+	return r
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
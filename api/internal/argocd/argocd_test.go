@@ -0,0 +1,200 @@
+package argocd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"pn-infra/api/internal/config"
+)
+
+func wave(n int) *int { return &n }
+
+func testConfig() *config.MergedConfig {
+	return &config.MergedConfig{
+		ConfigPackage: "core",
+		Environment:   "staging",
+		ArgoCD: config.ArgoCDSettings{
+			RepoURL:     "https://git.example.com/apps.git",
+			Project:     "business",
+			Destination: config.ArgoCDDestination{Name: "staging"},
+			Retry:       &config.ApplicationRetry{Limit: 5, Backoff: &config.ApplicationRetryBackoff{Duration: "5s", Factor: 2, MaxDuration: "3m"}},
+		},
+		Applications: []config.Application{
+			{
+				Name: "docs", Enabled: true, Namespace: "docs", SyncWave: wave(2),
+				Source: config.ApplicationSource{Type: "helm", Path: "business/apps/docs/chart"},
+				SyncPolicy: &config.ApplicationSyncPolicy{
+					Automated:   config.ApplicationSyncAutomated{Prune: true, SelfHeal: true},
+					SyncOptions: []string{"CreateNamespace=true"},
+				},
+				Values:            map[string]interface{}{"replicas": 2},
+				IgnoreDifferences: []config.IgnoreDifference{{Group: "apps", Kind: "Deployment", JSONPointers: []string{"/spec/replicas"}}},
+			},
+			{
+				Name: "api", Enabled: true, Namespace: "apps",
+				Source:     config.ApplicationSource{Type: "kustomize", Path: "business/apps/api", TargetRevision: "v1.2.0"},
+				SyncPolicy: &config.ApplicationSyncPolicy{Retry: &config.ApplicationRetry{Limit: 1}},
+			},
+			{Name: "legacy", Enabled: false, Namespace: "apps", Source: config.ApplicationSource{Type: "directory", Path: "legacy"}},
+		},
+	}
+}
+
+func TestManifestsWritesAnApplicationPerApp(t *testing.T) {
+	header := "# Generated from config package: core\n"
+	files, err := Manifests(testConfig(), header)
+	if err != nil {
+		t.Fatalf("Manifests: %v", err)
+	}
+	var paths []string
+	apps := map[string]Application{}
+	for _, file := range files {
+		paths = append(paths, file.Path)
+		if !strings.HasPrefix(string(file.Content), header) {
+			t.Fatalf("%s does not start with the header:\n%s", file.Path, file.Content)
+		}
+		var app Application
+		if err := yaml.Unmarshal(file.Content, &app); err != nil {
+			t.Fatalf("decode %s: %v", file.Path, err)
+		}
+		apps[app.Metadata.Name] = app
+	}
+	if want := []string{"argocd/docs.yaml", "argocd/api.yaml"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("paths = %v, want %v", paths, want)
+	}
+
+	docs := apps["docs"]
+	if docs.APIVersion != APIVersion || docs.Kind != "Application" || docs.Metadata.Namespace != DefaultNamespace {
+		t.Fatalf("unexpected docs header %+v", docs)
+	}
+	if docs.Metadata.Annotations[SyncWaveAnnotation] != "2" {
+		t.Fatalf("docs sync wave annotation = %q", docs.Metadata.Annotations[SyncWaveAnnotation])
+	}
+	wantSpec := ApplicationSpec{
+		Project: "business",
+		Source: Source{
+			RepoURL:        "https://git.example.com/apps.git",
+			TargetRevision: DefaultTargetRevision,
+			Path:           "business/apps/docs/chart",
+			Helm:           &HelmSource{ReleaseName: "docs", ValuesObject: map[string]interface{}{"replicas": 2}},
+		},
+		Destination: Destination{Name: "staging", Namespace: "docs"},
+		SyncPolicy: &SyncPolicy{
+			Automated:   &Automated{Prune: true, SelfHeal: true},
+			SyncOptions: []string{"CreateNamespace=true"},
+			Retry:       &Retry{Limit: 5, Backoff: &Backoff{Duration: "5s", Factor: 2, MaxDuration: "3m"}},
+		},
+		IgnoreDifferences: []IgnoreDifference{{Group: "apps", Kind: "Deployment", JSONPointers: []string{"/spec/replicas"}}},
+	}
+	if !reflect.DeepEqual(docs.Spec, wantSpec) {
+		t.Fatalf("docs spec = %+v, want %+v", docs.Spec, wantSpec)
+	}
+
+	api := apps["api"]
+	if api.Spec.Source.TargetRevision != "v1.2.0" || api.Spec.Source.Helm != nil {
+		t.Fatalf("unexpected api source %+v", api.Spec.Source)
+	}
+	if api.Spec.SyncPolicy.Automated != nil || !reflect.DeepEqual(api.Spec.SyncPolicy.Retry, &Retry{Limit: 1}) {
+		t.Fatalf("api sync policy = %+v, want manual sync with its own retry", api.Spec.SyncPolicy)
+	}
+}
+
+func TestManifestsAppliesAppOverrides(t *testing.T) {
+	merged := testConfig()
+	merged.AppOverrides = map[string]interface{}{
+		"docs":   map[string]interface{}{"namespace": "docs-staging", "replicas": 3, "image": map[string]interface{}{"tag": "1.25"}},
+		"api":    map[string]interface{}{"replicas": 2, "image": map[string]interface{}{"registry": "registry.local", "repository": "api", "tag": "v2"}},
+		"legacy": map[string]interface{}{"enabled": true, "namespace": "legacy"},
+	}
+	files, err := Manifests(merged, "")
+	if err != nil {
+		t.Fatalf("Manifests: %v", err)
+	}
+	apps := map[string]Application{}
+	for _, file := range files {
+		var app Application
+		if err := yaml.Unmarshal(file.Content, &app); err != nil {
+			t.Fatalf("decode %s: %v", file.Path, err)
+		}
+		apps[app.Metadata.Name] = app
+	}
+	if len(apps) != 3 {
+		t.Fatalf("expected legacy to be enabled by its override, got %d applications", len(apps))
+	}
+
+	docs := apps["docs"]
+	wantValues := map[string]interface{}{"replicas": 3, "image": map[string]interface{}{"tag": "1.25"}}
+	if docs.Spec.Destination.Namespace != "docs-staging" || !reflect.DeepEqual(docs.Spec.Source.Helm.ValuesObject, wantValues) {
+		t.Fatalf("docs overrides not applied: namespace %q, values %+v", docs.Spec.Destination.Namespace, docs.Spec.Source.Helm.ValuesObject)
+	}
+	want := &KustomizeSource{Images: []string{"api=registry.local/api:v2"}, Replicas: []Replica{{Name: "api", Count: 2}}}
+	if !reflect.DeepEqual(apps["api"].Spec.Source.Kustomize, want) {
+		t.Fatalf("api kustomize = %+v, want %+v", apps["api"].Spec.Source.Kustomize, want)
+	}
+	if apps["legacy"].Spec.Destination.Namespace != "legacy" {
+		t.Fatalf("legacy namespace = %q", apps["legacy"].Spec.Destination.Namespace)
+	}
+
+	merged.AppOverrides["legacy"] = map[string]interface{}{"enabled": true, "replicas": 2}
+	if _, err := Manifests(merged, ""); err == nil || !strings.Contains(err.Error(), "application legacy: app_overrides: image and replicas need a helm or kustomize source") {
+		t.Fatalf("expected an error for replicas on a directory source, got %v", err)
+	}
+}
+
+func TestManifestsWritesOneApplicationSet(t *testing.T) {
+	merged := testConfig()
+	merged.ArgoCD.Manifest = ManifestApplicationSet
+	files, err := Manifests(merged, "")
+	if err != nil {
+		t.Fatalf("Manifests: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "argocd/applicationset.yaml" {
+		t.Fatalf("expected argocd/applicationset.yaml, got %+v", files)
+	}
+	var set ApplicationSet
+	if err := yaml.Unmarshal(files[0].Content, &set); err != nil {
+		t.Fatalf("decode applicationset: %v", err)
+	}
+	if set.Metadata.Name != "business-staging" || set.Spec.Template.Spec.Source.RepoURL != "https://git.example.com/apps.git" {
+		t.Fatalf("unexpected applicationset %+v", set)
+	}
+	elements := set.Spec.Generators[0].List.Elements
+	if len(elements) != 2 || elements[0]["name"] != "docs" || elements[0]["syncWave"] != "2" || elements[1]["targetRevision"] != "v1.2.0" {
+		t.Fatalf("unexpected elements %+v", elements)
+	}
+	patch, _ := yaml.Marshal(elements[0]["patch"])
+	for _, want := range []string{"valuesObject:", "selfHeal: true", "maxDuration: 3m", "jsonPointers:"} {
+		if !strings.Contains(string(patch), want) {
+			t.Fatalf("docs patch does not contain %q:\n%s", want, patch)
+		}
+	}
+}
+
+func TestManifestsRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*config.MergedConfig)
+		want   string
+	}{
+		{"no repo url", func(m *config.MergedConfig) { m.ArgoCD.RepoURL = "" }, "repo_url is required"},
+		{"two destinations", func(m *config.MergedConfig) { m.ArgoCD.Destination.Server = "https://k8s" }, "set server or name, not both"},
+		{"unknown manifest", func(m *config.MergedConfig) { m.ArgoCD.Manifest = "appofapps" }, "unsupported manifest appofapps"},
+		{"mistyped override", func(m *config.MergedConfig) {
+			m.AppOverrides = map[string]interface{}{"docs": map[string]interface{}{"enabled": "no"}}
+		}, "application docs: app_overrides.docs.enabled must be a boolean"},
+		{"ignore difference without kind", func(m *config.MergedConfig) { m.Applications[0].IgnoreDifferences[0].Kind = "" }, "application docs: ignore_differences: kind is required"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := testConfig()
+			test.modify(merged)
+			_, err := Manifests(merged, "")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("expected an error containing %q, got %v", test.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// entrySuffix marks render cache entries; other files in the directory are
+// never read or pruned
+const entrySuffix = "-r"
+
+// entryHeader starts every entry, followed by the SHA-256 of the content
+const entryHeader = "v1 "
+
+// touchInterval limits how often a hit refreshes an entry's modification
+// time, which prune uses as its last use
+const touchInterval = time.Hour
+
+// Cache is a content-addressed store of rendered outputs, sharded by the
+// first byte of the key like the Go build cache: <dir>/<key[:2]>/<key>-r
+type Cache struct {
+	Dir string
+}
+
+// New returns a cache rooted at dir. The directory is created on first write.
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Key derives a cache key from its parts. Each part is length-prefixed, so
+// moving bytes between parts changes the key.
+func Key(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%d:", len(part))
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+entrySuffix)
+}
+
+// Get returns the content stored under key. Missing and corrupt entries are
+// misses; corrupt entries are removed.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	header, content, ok := bytes.Cut(data, []byte("\n"))
+	sum := sha256.Sum256(content)
+	if !ok || string(header) != entryHeader+hex.EncodeToString(sum[:]) {
+		os.Remove(path)
+		return nil, false
+	}
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > touchInterval {
+		now := time.Now()
+		os.Chtimes(path, now, now)
+	}
+	return content, true
+}
+
+// Put stores content under key. The entry is written to a temporary file and
+// renamed into place, so concurrent readers never see a partial entry.
+func (c *Cache) Put(key string, content []byte) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	sum := sha256.Sum256(content)
+	_, err = fmt.Fprintf(tmp, "%s%s\n%s", entryHeader, hex.EncodeToString(sum[:]), content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	return nil
+}
+
+// Stats summarizes the entries on disk
+type Stats struct {
+	Entries int
+	Bytes   int64
+	Oldest  time.Time // least recent use
+	Newest  time.Time // most recent use
+}
+
+// Entry is a cache entry on disk
+type Entry struct {
+	Path    string
+	Size    int64
+	LastUse time.Time
+}
+
+// Entries lists the cache entries, least recently used first
+func (c *Cache) Entries() ([]Entry, error) {
+	var entries []Entry
+	err := filepath.Walk(c.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.Dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), entrySuffix) {
+			return nil
+		}
+		entries = append(entries, Entry{Path: path, Size: info.Size(), LastUse: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan cache %s: %w", c.Dir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastUse.Before(entries[j].LastUse) })
+	return entries, nil
+}
+
+// Stats returns the number, total size and use range of the entries
+func (c *Cache) Stats() (Stats, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return Stats{}, err
+	}
+	var stats Stats
+	for _, entry := range entries {
+		stats.Entries++
+		stats.Bytes += entry.Size
+	}
+	if len(entries) > 0 {
+		stats.Oldest = entries[0].LastUse
+		stats.Newest = entries[len(entries)-1].LastUse
+	}
+	return stats, nil
+}
+
+// Prune removes entries not used within maxAge (when positive), then the
+// least recently used entries until the cache fits in maxBytes (when
+// positive). It returns the number of entries and bytes removed.
+func (c *Cache) Prune(maxAge time.Duration, maxBytes int64) (removed int, freed int64, err error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		expired := maxAge > 0 && entry.LastUse.Before(cutoff)
+		oversize := maxBytes > 0 && total > maxBytes
+		if !expired && !oversize {
+			continue
+		}
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			return removed, freed, fmt.Errorf("prune cache: %w", err)
+		}
+		removed++
+		freed += entry.Size
+		total -= entry.Size
+	}
+	return removed, freed, nil
+}
+
+// Clear removes every entry. It returns the number of entries and bytes removed.
+func (c *Cache) Clear() (removed int, freed int64, err error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, entry := range entries {
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			return removed, freed, fmt.Errorf("clear cache: %w", err)
+		}
+		removed++
+		freed += entry.Size
+	}
+	return removed, freed, nil
+}
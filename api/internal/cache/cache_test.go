@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetReturnsStoredContentAndDropsCorruptEntries(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "render"))
+	key := Key([]byte("template"), []byte("data"))
+	if _, ok := c.Get(key); ok {
+		t.Fatalf("expected a miss on an empty cache")
+	}
+	if err := c.Put(key, []byte("a: 1\n")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	content, ok := c.Get(key)
+	if !ok || string(content) != "a: 1\n" {
+		t.Fatalf("get = %q, %v", content, ok)
+	}
+
+	if err := os.WriteFile(c.path(key), []byte("v1 0000\na: 2\n"), 0644); err != nil {
+		t.Fatalf("corrupt: %v", err)
+	}
+	if _, ok := c.Get(key); ok {
+		t.Fatalf("expected a corrupt entry to be a miss")
+	}
+	if _, err := os.Stat(c.path(key)); !os.IsNotExist(err) {
+		t.Fatalf("expected the corrupt entry to be removed")
+	}
+
+	if Key([]byte("ab"), []byte("c")) == Key([]byte("a"), []byte("bc")) {
+		t.Fatalf("keys must not collide when bytes move between parts")
+	}
+}
+
+func TestPruneRemovesExpiredThenLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	c := New(dir)
+	now := time.Now()
+	ages := map[string]time.Duration{"old": 60 * 24 * time.Hour, "older-recent": 2 * time.Hour, "recent": time.Minute}
+	for name, age := range ages {
+		key := Key([]byte(name))
+		if err := c.Put(key, []byte(name)); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+		os.Chtimes(c.path(key), now.Add(-age), now.Add(-age))
+	}
+	// Files that are not render entries, such as a Go build cache, are kept
+	foreign := filepath.Join(dir, "README")
+	os.WriteFile(foreign, []byte("not an entry"), 0644)
+
+	removed, _, err := c.Prune(30*24*time.Hour, 0)
+	if err != nil || removed != 1 {
+		t.Fatalf("prune by age removed %d (%v), want 1", removed, err)
+	}
+	entries, _ := c.Entries()
+	removed, _, err = c.Prune(0, entries[1].Size)
+	if err != nil || removed != 1 {
+		t.Fatalf("prune by size removed %d (%v), want 1", removed, err)
+	}
+	if _, ok := c.Get(Key([]byte("recent"))); !ok {
+		t.Fatalf("expected the most recently used entry to survive")
+	}
+	if _, err := os.Stat(foreign); err != nil {
+		t.Fatalf("prune must not remove other files: %v", err)
+	}
+}
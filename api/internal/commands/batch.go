@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// envResult is the outcome of generating one environment in a batch
+type envResult struct {
+	ID      string
+	Summary string
+	Err     error
+	Elapsed time.Duration
+}
+
+// generateBatch generates several environments with at most jobs running at
+// once. Each environment logs into its own buffer, printed as a block when it
+// finishes so concurrent logs do not interleave. Failures do not stop the
+// other environments; they are reported together in the final summary. After
+// ctx is cancelled no new environment is started. With --format json the
+// logs go to stderr and a JSON report of the failures to stdout.
+func (rt *Runtime) generateBatch(ctx context.Context, ids []string, jobs int, opts generateOptions) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(ids) {
+		jobs = len(ids)
+	}
+	out := progressWriter(opts.Format)
+	fmt.Fprintf(out, "Generating %d environments (%d at a time): %s\n", len(ids), jobs, strings.Join(ids, ", "))
+
+	results := make([]envResult, len(ids))
+	queue := make(chan int)
+	var printMu sync.Mutex
+	var wg sync.WaitGroup
+	for worker := 0; worker < jobs; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				start := time.Now()
+				var log bytes.Buffer
+				summary, err := rt.generateEnvironment(ctx, &log, ids[i], opts)
+				results[i] = envResult{ID: ids[i], Summary: summary, Err: err, Elapsed: time.Since(start)}
+
+				printMu.Lock()
+				fmt.Fprintf(out, "\n── %s ──\n", ids[i])
+				out.Write(log.Bytes())
+				if err != nil {
+					fmt.Fprintf(out, "\n❌ Environment '%s' failed (see summary)\n", ids[i])
+				}
+				printMu.Unlock()
+			}
+		}()
+	}
+
+	for i := range ids {
+		if ctx.Err() != nil {
+			results[i] = envResult{ID: ids[i], Err: fmt.Errorf("not started: %w", ctx.Err())}
+			continue
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	fmt.Fprintln(out, "\nSummary:")
+	var failed []error
+	for _, result := range results {
+		if result.Err != nil {
+			// Aggregated render errors are one per line
+			fmt.Fprintf(out, "  ✗ %-20s %s\n", result.ID, strings.ReplaceAll(result.Err.Error(), "\n", "\n"+strings.Repeat(" ", 25)))
+			failed = append(failed, fmt.Errorf("%s: %w", result.ID, result.Err))
+			continue
+		}
+		fmt.Fprintf(out, "  ✓ %-20s %s (%s)\n", result.ID, result.Summary, result.Elapsed.Round(time.Millisecond))
+	}
+	if opts.Format == formatJSON {
+		if err := writeErrorReport(os.Stdout, results); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(out, "\n%d of %d environments failed\n", len(failed), len(ids))
+		return errors.Join(failed...)
+	}
+	fmt.Fprintf(out, "\n✅ All %d environments done\n", len(ids))
+	return nil
+}
+
+// environmentIDs lists the environments of a config package: those with
+// override files in the package's environments/ directory (named
+// <env>.<kind>.<ext>) or in a module's environments/ directory, and those
+// with generated outputs
+func (rt *Runtime) environmentIDs(configPackage string) ([]string, error) {
+	seen := map[string]bool{}
+	collect := func(dir string, dirs bool) error {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("list environments: %w", err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") || entry.IsDir() != dirs {
+				continue
+			}
+			if !dirs {
+				name, _, _ = strings.Cut(name, ".")
+			}
+			seen[name] = true
+		}
+		return nil
+	}
+
+	dirs := []string{filepath.Join(rt.RepoRoot, "config", "packages", configPackage, "environments")}
+	for _, module := range []string{"infrastructure", "container-orchestration", "platform", "provisioner", "business"} {
+		dirs = append(dirs, filepath.Join(rt.RepoRoot, module, "environments"))
+	}
+	for _, dir := range dirs {
+		if err := collect(dir, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := collect(filepath.Join(rt.RepoRoot, "api", "outputs"), true); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no environments found for config package %s", configPackage)
+	}
+	return ids, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items and
+// duplicates
+func splitList(value string) []string {
+	var items []string
+	seen := map[string]bool{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" && !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvironmentIDsCollectsOverridesAndOutputs(t *testing.T) {
+	repo := t.TempDir()
+	for _, path := range []string{
+		"config/packages/core/environments/development.platform.yaml",
+		"config/packages/core/environments/development.terraform.tfvars",
+		"platform/environments/staging.yaml",
+		"api/outputs/production/metadata.json",
+		"api/outputs/.production.lock",
+	} {
+		full := filepath.Join(repo, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(full, nil, 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	os.MkdirAll(filepath.Join(repo, "api", "outputs", ".production.staging-123"), 0755)
+
+	rt := &Runtime{RepoRoot: repo}
+	ids, err := rt.environmentIDs("core")
+	if err != nil {
+		t.Fatalf("environmentIDs: %v", err)
+	}
+	if want := []string{"development", "production", "staging"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+
+	if _, err := rt.environmentIDs("missing"); err != nil {
+		t.Fatalf("outputs alone should still list environments: %v", err)
+	}
+	if got := splitList(" a, b,,a ,c"); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Fatalf("splitList = %v", got)
+	}
+}
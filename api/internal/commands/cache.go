@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pn-infra/api/internal/cache"
+)
+
+// renderCache returns the render cache shared by all environments. It lives
+// in its own directory so it never touches other tools' files in api/.cache.
+func (rt *Runtime) renderCache() *cache.Cache {
+	return cache.New(filepath.Join(rt.RepoRoot, "api", ".cache", "render"))
+}
+
+// cacheStats prints the size and age of the render cache
+func (rt *Runtime) cacheStats(args []string) error {
+	fs := flag.NewFlagSet("cache stats", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c := rt.renderCache()
+	stats, err := c.Stats()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Render cache: %s\n", c.Dir)
+	fmt.Printf("  Entries: %d\n", stats.Entries)
+	fmt.Printf("  Size:    %s\n", formatBytes(stats.Bytes))
+	if stats.Entries > 0 {
+		fmt.Printf("  Oldest:  %s (last used)\n", stats.Oldest.UTC().Format(time.RFC3339))
+		fmt.Printf("  Newest:  %s (last used)\n", stats.Newest.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// cachePrune removes render cache entries that were not used recently or
+// that exceed the size limit, least recently used first
+func (rt *Runtime) cachePrune(args []string) error {
+	fs := flag.NewFlagSet("cache prune", flag.ContinueOnError)
+	maxAge := fs.Duration("max-age", 30*24*time.Hour, "remove entries not used for this long (0 keeps all)")
+	maxSize := fs.String("max-size", "", "then remove least recently used entries until the cache fits (e.g. 500MB)")
+	all := fs.Bool("all", false, "remove every entry")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var maxBytes int64
+	if *maxSize != "" {
+		size, err := parseBytes(*maxSize)
+		if err != nil {
+			return fmt.Errorf("invalid --max-size: %w", err)
+		}
+		maxBytes = size
+	}
+
+	c := rt.renderCache()
+	prune := func() (int, int64, error) { return c.Prune(*maxAge, maxBytes) }
+	if *all {
+		prune = c.Clear
+	}
+	removed, freed, err := prune()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Pruned %d render cache entries (%s) from %s\n", removed, formatBytes(freed), c.Dir)
+	return nil
+}
+
+var byteUnits = []string{"B", "KB", "MB", "GB"}
+
+// formatBytes formats a size in the largest 1024-based unit that keeps it at
+// or above 1
+func formatBytes(n int64) string {
+	value, unit := float64(n), 0
+	for value >= 1024 && unit < len(byteUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", value, byteUnits[unit])
+}
+
+// parseBytes parses a size such as 512, 64KB or 1.5GB (1024-based)
+func parseBytes(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := 1.0
+	for i := len(byteUnits) - 1; i >= 0; i-- {
+		if strings.HasSuffix(s, byteUnits[i]) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, byteUnits[i]))
+			for j := 0; j < i; j++ {
+				multiplier *= 1024
+			}
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%q is not a size", s)
+	}
+	return int64(value * multiplier), nil
+}
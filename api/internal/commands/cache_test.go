@@ -0,0 +1,19 @@
+package commands
+
+import "testing"
+
+func TestParseAndFormatBytes(t *testing.T) {
+	cases := map[string]int64{"512": 512, "64KB": 64 << 10, "1.5 gb": 3 << 29, "500MB": 500 << 20}
+	for input, want := range cases {
+		got, err := parseBytes(input)
+		if err != nil || got != want {
+			t.Fatalf("parseBytes(%q) = %d (%v), want %d", input, got, err, want)
+		}
+	}
+	if _, err := parseBytes("lots"); err == nil {
+		t.Fatalf("expected an error for an invalid size")
+	}
+	if got := formatBytes(1536); got != "1.5 KB" {
+		t.Fatalf("formatBytes(1536) = %q", got)
+	}
+}
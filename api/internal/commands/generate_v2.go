@@ -1,206 +1,672 @@
 package commands
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"pn-infra/api/internal/argocd"
+	"pn-infra/api/internal/cache"
 	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/kustomize"
+	"pn-infra/api/internal/manifest"
+	"pn-infra/api/internal/metadata"
+	"pn-infra/api/internal/plan"
+	"pn-infra/api/internal/plugin"
 	"pn-infra/api/internal/template"
+	"pn-infra/api/internal/validate"
 )
 
+// generateOptions are the generate env flags that apply to every environment
+type generateOptions struct {
+	ConfigPackage string
+	SkipValidate  bool
+	ValidateOnly  bool
+	DryRun        bool
+	ShowDiff      bool
+	Force         bool
+	RenderCache   *cache.Cache // nil disables the render cache
+	Format        string       // formatText or formatJSON
+
+	// OperationsApplied drops a pending operations plan, planning against
+	// the last generated hosts instead of the plan's applied hosts
+	OperationsApplied bool
+}
+
 // generateEnvV2 is the refactored version using master config pattern
 func (rt *Runtime) generateEnvV2(args []string) error {
 	fs := flag.NewFlagSet("generate env", flag.ContinueOnError)
-	envID := fs.String("id", "", "environment identifier (e.g., development)")
+	envIDs := fs.String("id", "", "environment identifier (e.g., development), or a comma-separated list")
+	all := fs.Bool("all", false, "generate every environment of the config package")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "number of environments generated concurrently with --all or several --id values")
 	configPackage := fs.String("config", "core", "config package identifier")
 	skipValidate := fs.Bool("skip-validate", false, "skip schema/definition validation")
 	validateOnly := fs.Bool("validate-only", false, "only validate without generating")
+	dryRun := fs.Bool("dry-run", false, "render everything in memory and list changed outputs without writing")
+	showDiff := fs.Bool("diff", false, "like --dry-run, printing a unified diff per changed output; exits non-zero when outputs changed")
+	force := fs.Bool("force", false, "overwrite outputs that were edited by hand since the last generation")
+	operationsApplied := fs.Bool("operations-applied", false, "the pending operations.json plan has been run; plan node operations against the last generation")
+	noCache := fs.Bool("no-cache", false, "render every template, ignoring the render cache in api/.cache/render")
+	format := fs.String("format", formatText, "failure report format: text, or json to print a JSON report on stdout and progress on stderr")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	if *envID == "" {
-		return errors.New("missing required --id flag")
+	if *envIDs == "" && !*all {
+		return errors.New("missing required --id or --all flag")
+	}
+	if *envIDs != "" && *all {
+		return errors.New("--id and --all are mutually exclusive")
+	}
+	if *format != formatText && *format != formatJSON {
+		return fmt.Errorf("invalid --format %q: must be %s or %s", *format, formatText, formatJSON)
+	}
+
+	opts := generateOptions{
+		ConfigPackage: *configPackage,
+		SkipValidate:  *skipValidate,
+		ValidateOnly:  *validateOnly,
+		DryRun:        *dryRun,
+		ShowDiff:      *showDiff,
+		Force:         *force,
+		Format:        *format,
+
+		OperationsApplied: *operationsApplied,
+	}
+	if !*noCache {
+		opts.RenderCache = rt.renderCache()
+	}
+
+	// Ctrl-C stops rendering; outputs already swapped in stay complete
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *all {
+		ids, err := rt.environmentIDs(*configPackage)
+		if err != nil {
+			return err
+		}
+		return rt.generateBatch(ctx, ids, *jobs, opts)
+	}
+	ids := splitList(*envIDs)
+	if len(ids) == 0 {
+		return errors.New("missing required --id or --all flag")
+	}
+	if len(ids) == 1 {
+		_, err := rt.generateEnvironment(ctx, progressWriter(opts.Format), ids[0], opts)
+		if opts.Format == formatJSON {
+			if reportErr := writeErrorReport(os.Stdout, []envResult{{ID: ids[0], Err: err}}); reportErr != nil {
+				return reportErr
+			}
+		}
+		return err
 	}
+	return rt.generateBatch(ctx, ids, *jobs, opts)
+}
 
-	fmt.Printf("Generating artifacts for environment: %s\n", *envID)
-	fmt.Printf("Using config package: %s\n", *configPackage)
+// generateEnvironment generates one environment, logging progress to w, and
+// returns a one-line summary of the result
+func (rt *Runtime) generateEnvironment(ctx context.Context, w io.Writer, envID string, opts generateOptions) (string, error) {
+	fmt.Fprintf(w, "Generating artifacts for environment: %s\n", envID)
+	fmt.Fprintf(w, "Using config package: %s\n", opts.ConfigPackage)
 
 	// Step 1: Load and merge configuration
-	fmt.Println("\n[1/7] Loading configuration...")
-	loader := config.NewLoader(rt.RepoRoot, *configPackage, *envID)
+	fmt.Fprintln(w, "\n[1/8] Loading configuration...")
+	loader := config.NewLoader(rt.RepoRoot, opts.ConfigPackage, envID)
 	mergedConfig, err := loader.LoadAndMerge()
 	if err != nil {
-		return fmt.Errorf("load configuration: %w", err)
+		return "", fmt.Errorf("load configuration: %w", err)
 	}
-	fmt.Printf("  ✓ Master config loaded (platform: %s, orchestrator: %s)\n",
+	fmt.Fprintf(w, "  ✓ Master config loaded (platform: %s, orchestrator: %s)\n",
 		mergedConfig.Infrastructure.Platform,
 		mergedConfig.ContainerOrchestration.Orchestrator)
-	fmt.Printf("  ✓ Loaded %d hosts\n", len(mergedConfig.Hosts))
+	fmt.Fprintf(w, "  ✓ Loaded %d hosts\n", len(mergedConfig.Hosts))
 
-	// Step 2: Validate environment overrides (if not skipped)
-	if !*skipValidate {
-		fmt.Println("\n[2/7] Validating environment overrides...")
-		if err := rt.validateEnvironments(*envID); err != nil {
-			return fmt.Errorf("validation failed: %w", err)
+	// Step 2: Validate environment overrides and provider settings (if not skipped)
+	if !opts.SkipValidate {
+		fmt.Fprintln(w, "\n[2/8] Validating environment overrides...")
+		if err := rt.validateEnvironments(w, envID); err != nil {
+			return "", fmt.Errorf("validation failed: %w", err)
 		}
-		fmt.Println("  ✓ Environment validation passed")
+		if err := config.ValidateProviders(mergedConfig); err != nil {
+			return "", fmt.Errorf("validation failed: %w", err)
+		}
+		fmt.Fprintln(w, "  ✓ Environment validation passed")
 	} else {
-		fmt.Println("\n[2/7] Skipping validation (--skip-validate)")
+		fmt.Fprintln(w, "\n[2/8] Skipping validation (--skip-validate)")
+	}
+
+	if opts.ValidateOnly {
+		fmt.Fprintln(w, "\nValidation complete (--validate-only)")
+		return "validated", nil
+	}
+
+	if !opts.DryRun && !opts.ShowDiff {
+		outputDir := template.NewPathResolver(rt.RepoRoot).ResolveOutputPaths(envID).OutputDir
+		release, err := lockOutputs(outputDir)
+		if err != nil {
+			return "", err
+		}
+		defer release()
+	}
+
+	// Steps 3-8: Render every output in memory
+	outputPaths, outputs, err := rt.renderOutputs(ctx, w, envID, loader, mergedConfig, opts)
+	if err != nil {
+		return "", err
+	}
+
+	edited, err := handEditedOutputs(rt.RepoRoot, outputPaths)
+	if err != nil {
+		return "", err
+	}
+	for _, change := range edited {
+		fmt.Fprintf(w, "  ! Edited since last generation: %s (%s)\n", relativeOutput(outputPaths, filepath.Join(rt.RepoRoot, change.Path)), change.Kind)
+	}
+
+	if opts.DryRun || opts.ShowDiff {
+		changed, err := outputs.compare(w, outputPaths.OutputDir, opts.ShowDiff)
+		if err != nil {
+			return "", err
+		}
+		if changed == 0 {
+			fmt.Fprintf(w, "\n✅ Environment '%s' outputs are up to date (dry run, nothing written)\n", envID)
+			return "up to date", nil
+		}
+		fmt.Fprintf(w, "\n%d file(s) would change in %s (dry run, nothing written)\n", changed, outputPaths.OutputDir)
+		summary := fmt.Sprintf("%d file(s) would change", changed)
+		if opts.ShowDiff {
+			return summary, errOutputsChanged
+		}
+		return summary, nil
 	}
 
-	if *validateOnly {
-		fmt.Println("\nValidation complete (--validate-only)")
-		return nil
+	if len(edited) > 0 && !opts.Force {
+		return "", fmt.Errorf("%d output(s) in %s were edited by hand since the last generation; move the changes into the config package or rerun with --force to overwrite them", len(edited), outputPaths.OutputDir)
+	}
+
+	// Last point at which an interrupt leaves the previous outputs in place
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	pruned, err := outputs.commit(outputPaths.OutputDir)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(w, "  ✓ Wrote %d files\n", len(outputs.files))
+	for _, relative := range pruned {
+		fmt.Fprintf(w, "  ✗ Pruned: %s\n", relative)
+	}
+
+	fmt.Fprintf(w, "\n✅ Environment '%s' artifacts generated successfully!\n", envID)
+	fmt.Fprintf(w, "📁 Output directory: %s\n", outputPaths.OutputDir)
+
+	return fmt.Sprintf("%d files written, %d pruned", len(outputs.files), len(pruned)), nil
+}
+
+// renderOutputs resolves templates and renders every output of an
+// environment in memory, metadata.json included, logging progress to w.
+// Templates are looked up in opts.RenderCache when it is not nil. Nothing is
+// written to the output directory.
+func (rt *Runtime) renderOutputs(ctx context.Context, w io.Writer, envID string, loader *config.Loader, mergedConfig *config.MergedConfig, opts generateOptions) (*template.OutputPaths, *outputSet, error) {
+	configPackage := opts.ConfigPackage
+	packageVersion, err := loader.PackageVersion(&mergedConfig.MasterConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load configuration: %w", err)
 	}
 
 	// Step 3: Resolve template paths
-	fmt.Println("\n[3/7] Resolving template paths...")
+	fmt.Fprintln(w, "\n[3/8] Resolving template paths...")
 	pathResolver := template.NewPathResolver(rt.RepoRoot)
+	pathResolver.SearchPath = template.SearchPath(rt.RepoRoot, configPackage, envID)
 	templatePaths, err := pathResolver.Resolve(&mergedConfig.MasterConfig)
 	if err != nil {
-		return fmt.Errorf("resolve template paths: %w", err)
+		return nil, nil, fmt.Errorf("resolve template paths: %w", err)
+	}
+	for _, target := range templatePaths.Infrastructure {
+		fmt.Fprintf(w, "  ✓ Infrastructure template: %s\n", filepath.Base(target.Template.Path))
 	}
-	fmt.Printf("  ✓ Infrastructure template: %s\n", filepath.Base(templatePaths.Infrastructure))
-	fmt.Printf("  ✓ Orchestrator templates: %s\n", mergedConfig.ContainerOrchestration.Orchestrator)
+	fmt.Fprintf(w, "  ✓ Orchestrator templates: %s\n", mergedConfig.ContainerOrchestration.Orchestrator)
 
 	// Step 4: Resolve output paths
-	fmt.Println("\n[4/7] Resolving output paths...")
-	outputPaths := pathResolver.ResolveOutputPaths(*envID, mergedConfig.ContainerOrchestration.Orchestrator)
-	if err := os.MkdirAll(outputPaths.OutputDir, 0755); err != nil {
-		return fmt.Errorf("create output directory: %w", err)
-	}
-	fmt.Printf("  ✓ Output directory: %s\n", outputPaths.OutputDir)
+	fmt.Fprintln(w, "\n[4/8] Resolving output paths...")
+	outputPaths := pathResolver.ResolveOutputPaths(envID)
+	fmt.Fprintf(w, "  ✓ Output directory: %s\n", outputPaths.OutputDir)
 
 	// Step 5: Render templates
-	fmt.Println("\n[5/7] Rendering templates...")
+	fmt.Fprintln(w, "\n[5/8] Rendering templates...")
 	renderer := template.NewRenderer(rt.RepoRoot)
+	renderer.Cache = opts.RenderCache
+	outputs := newOutputSet()
+
+	type renderJob struct {
+		name     string
+		template template.Source
+		output   string
+		what     string // for errors, e.g. "platform template"
+	}
+	var jobs []renderJob
+
+	// Render infrastructure templates (skip if platform is "none")
+	if len(templatePaths.Infrastructure) == 0 {
+		fmt.Fprintf(w, "  ⊘ Skipped: Infrastructure (platform=none)\n")
+	}
+	for _, target := range templatePaths.Infrastructure {
+		jobs = append(jobs, renderJob{target.Name, target.Template, outputPaths.Path(target.Output), target.Name + " template"})
+	}
+
+	// Render container orchestration templates
+	orchestrator := mergedConfig.ContainerOrchestration.Orchestrator
+	for _, target := range templatePaths.ContainerOrchestration {
+		jobs = append(jobs, renderJob{"orchestrator_" + target.Name, target.Template, outputPaths.Path(target.Output), orchestrator + " " + target.Name})
+	}
+
+	// Render provisioner templates, and platform and business templates
+	// unless their deployment method generates other outputs
+	platformMethod, err := mergedConfig.MasterConfig.Platform.Method()
+	if err != nil {
+		return nil, nil, err
+	}
+	businessMethod, err := mergedConfig.MasterConfig.Business.Method()
+	if err != nil {
+		return nil, nil, err
+	}
+	jobs = append(jobs, renderJob{"provisioner", templatePaths.Provisioner, outputPaths.Provisioner, "provisioner template"})
+	if platformMethod != config.DeploymentKustomize {
+		jobs = append(jobs, renderJob{"platform", templatePaths.Platform, outputPaths.Platform, "platform template"})
+	}
+	if businessMethod != config.DeploymentKustomize {
+		jobs = append(jobs, renderJob{"business", templatePaths.Business, outputPaths.Business, "business template"})
+	}
+
+	// Templates render concurrently; outputs are recorded in job order so
+	// logs and metadata do not depend on scheduling
+	contents := make([]string, len(jobs))
+	renderErrs := make([]error, len(jobs))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job renderJob) {
+			defer wg.Done()
+			if err := ctx.Err(); err != nil {
+				renderErrs[i] = err
+				return
+			}
+			contents[i], renderErrs[i] = renderer.RenderChecked(job.template, job.output, mergedConfig, validate.Output)
+		}(i, job)
+	}
+	wg.Wait()
+
+	var failed []error
+	var templateInputs []string
+	templates := make(map[string]metadata.Template, len(jobs))
+	for i, job := range jobs {
+		err := renderErrs[i]
+		if err == nil {
+			err = outputs.add(job.name, job.output, []byte(contents[i]))
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("render %s: %w", job.what, err))
+			fmt.Fprintf(w, "  ✗ Failed: %s\n", job.what)
+			var renderErr *template.RenderError
+			if errors.As(err, &renderErr) {
+				fmt.Fprint(w, indentLines(renderErr.Pretty(), "      "))
+			}
+			continue
+		}
+		templateInputs = append(templateInputs, job.template.Files()...)
+		record, err := templateRecord(rt.RepoRoot, job.template)
+		if err != nil {
+			return nil, nil, err
+		}
+		templates[job.name] = record
+		fmt.Fprintf(w, "  ✓ Rendered: %s%s\n", relativeOutput(outputPaths, job.output), templateNote(job.template))
+	}
+	if len(failed) > 0 {
+		return nil, nil, errors.Join(failed...)
+	}
+	if opts.RenderCache != nil {
+		hits, misses := renderer.CacheCounts()
+		fmt.Fprintf(w, "  ✓ Render cache: %d hit(s), %d miss(es)\n", hits, misses)
+	}
+
+	// Step 6: Generate provider artifacts (e.g. kubesprayConfig.json),
+	// kustomizations and Argo CD manifests, and run plugins
+	fmt.Fprintln(w, "\n[6/8] Generating provider and plugin artifacts...")
+	artifacts, err := config.ProviderArtifacts(mergedConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate provider artifacts: %w", err)
+	}
+	for _, artifact := range artifacts {
+		if err := outputs.addJSON(artifact.Name, outputPaths.Path(artifact.Output), artifact.Data); err != nil {
+			return nil, nil, fmt.Errorf("generate %s: %w", artifact.Output, err)
+		}
+		fmt.Fprintf(w, "  ✓ Rendered: %s\n", artifact.Output)
+	}
+	header, err := renderer.Header(pathResolver, mergedConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("render generated file header: %w", err)
+	}
+	generator := kustomize.NewGenerator(rt.RepoRoot, outputPaths.OutputDir, header)
+	for _, module := range []struct {
+		name, method string
+		generate     func(*config.MergedConfig) ([]manifest.File, error)
+	}{
+		{"platform", platformMethod, generator.Platform},
+		{"business", businessMethod, generator.Business},
+	} {
+		if module.method != config.DeploymentKustomize {
+			continue
+		}
+		files, err := module.generate(mergedConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generate %s kustomizations: %w", module.name, err)
+		}
+		for _, file := range files {
+			if err := outputs.add("kustomize:"+file.Path, outputPaths.Path(file.Path), file.Content); err != nil {
+				return nil, nil, fmt.Errorf("generate %s kustomizations: %w", module.name, err)
+			}
+			fmt.Fprintf(w, "  ✓ Rendered: %s\n", file.Path)
+		}
+	}
+	if businessMethod == config.DeploymentArgoCD {
+		manifests, err := argocd.Manifests(mergedConfig, header)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generate argocd manifests: %w", err)
+		}
+		for _, file := range manifests {
+			if err := outputs.add("argocd:"+file.Path, outputPaths.Path(file.Path), file.Content); err != nil {
+				return nil, nil, fmt.Errorf("generate argocd manifests: %w", err)
+			}
+			fmt.Fprintf(w, "  ✓ Rendered: %s\n", file.Path)
+		}
+	}
+	if err := rt.runPlugins(ctx, w, envID, configPackage, mergedConfig, outputPaths, outputs); err != nil {
+		return nil, nil, err
+	}
 
-	// Render infrastructure template (skip if platform is "none")
-	if templatePaths.Infrastructure != "" {
-		if err := renderer.RenderToFile(templatePaths.Infrastructure, outputPaths.Infrastructure, mergedConfig); err != nil {
-			return fmt.Errorf("render infrastructure template: %w", err)
+	// Step 7: Plan node operations against the hosts the cluster runs
+	fmt.Fprintln(w, "\n[7/8] Planning node operations...")
+	hostSnapshots := plan.Snapshot(mergedConfig.Hosts)
+	if orchestrator == "kubespray" {
+		operations, previousInventory, err := rt.planOperations(w, envID, outputPaths, hostSnapshots, opts.OperationsApplied)
+		if err != nil {
+			return nil, nil, fmt.Errorf("plan node operations: %w", err)
+		}
+		if operations != nil {
+			if err := outputs.addJSON("operations", outputPaths.Operations, operations); err != nil {
+				return nil, nil, fmt.Errorf("plan node operations: %w", err)
+			}
+			fmt.Fprintf(w, "  ✓ Rendered: %s\n", filepath.Base(outputPaths.Operations))
+		}
+		if previousInventory != nil {
+			if err := outputs.add("operations_inventory", outputPaths.Path(plan.PreviousInventory), previousInventory); err != nil {
+				return nil, nil, fmt.Errorf("plan node operations: %w", err)
+			}
+			fmt.Fprintf(w, "  ✓ Rendered: %s\n", plan.PreviousInventory)
 		}
-		fmt.Printf("  ✓ Generated: %s\n", filepath.Base(outputPaths.Infrastructure))
 	} else {
-		fmt.Printf("  ⊘ Skipped: Infrastructure (platform=none)\n")
+		fmt.Fprintf(w, "  ⊘ Skipped: node operations (orchestrator=%s)\n", orchestrator)
 	}
 
-	// Render container orchestration templates
-	switch mergedConfig.ContainerOrchestration.Orchestrator {
-	case "kubespray":
-		if err := os.MkdirAll(outputPaths.ContainerOrchestration.GroupVarsDir, 0755); err != nil {
-			return fmt.Errorf("create group_vars directory: %w", err)
-		}
-		if err := renderer.RenderToFile(templatePaths.ContainerOrchestration.Inventory,
-			outputPaths.ContainerOrchestration.Inventory, mergedConfig); err != nil {
-			return fmt.Errorf("render kubespray inventory: %w", err)
-		}
-		if err := renderer.RenderToFile(templatePaths.ContainerOrchestration.GroupVarsAll,
-			outputPaths.ContainerOrchestration.GroupVarsAll, mergedConfig); err != nil {
-			return fmt.Errorf("render kubespray group_vars/all: %w", err)
-		}
-		if err := renderer.RenderToFile(templatePaths.ContainerOrchestration.GroupVarsK8s,
-			outputPaths.ContainerOrchestration.GroupVarsK8s, mergedConfig); err != nil {
-			return fmt.Errorf("render kubespray group_vars/k8s_cluster: %w", err)
-		}
-		fmt.Printf("  ✓ Generated: kubespray/inventory.ini\n")
-		fmt.Printf("  ✓ Generated: kubespray/group_vars/all.yaml\n")
-		fmt.Printf("  ✓ Generated: kubespray/group_vars/k8s_cluster.yaml\n")
-	case "kubekey", "kind":
-		if err := os.MkdirAll(filepath.Dir(outputPaths.ContainerOrchestration.Config), 0755); err != nil {
-			return fmt.Errorf("create orchestrator directory: %w", err)
-		}
-		if err := renderer.RenderToFile(templatePaths.ContainerOrchestration.Config,
-			outputPaths.ContainerOrchestration.Config, mergedConfig); err != nil {
-			return fmt.Errorf("render %s config: %w", mergedConfig.ContainerOrchestration.Orchestrator, err)
-		}
-		fmt.Printf("  ✓ Generated: %s/config.yaml\n", mergedConfig.ContainerOrchestration.Orchestrator)
-	}
-
-	// Render provisioner template
-	if err := renderer.RenderToFile(templatePaths.Provisioner, outputPaths.Provisioner, mergedConfig); err != nil {
-		return fmt.Errorf("render provisioner template: %w", err)
-	}
-	fmt.Printf("  ✓ Generated: %s\n", filepath.Base(outputPaths.Provisioner))
-
-	// Render platform template
-	if err := renderer.RenderToFile(templatePaths.Platform, outputPaths.Platform, mergedConfig); err != nil {
-		return fmt.Errorf("render platform template: %w", err)
-	}
-	fmt.Printf("  ✓ Generated: %s\n", filepath.Base(outputPaths.Platform))
-
-	// Render business template
-	if err := renderer.RenderToFile(templatePaths.Business, outputPaths.Business, mergedConfig); err != nil {
-		return fmt.Errorf("render business template: %w", err)
-	}
-	fmt.Printf("  ✓ Generated: %s\n", filepath.Base(outputPaths.Business))
-
-	// Step 6: Generate kubesprayConfig.json for compatibility
-	fmt.Println("\n[6/7] Generating compatibility artifacts...")
-	if mergedConfig.ContainerOrchestration.Orchestrator == "kubespray" {
-		kubesprayConfig := map[string]interface{}{
-			"image": map[string]string{
-				"registry": "quay.io",
-				"version":  "v2.28.1",
-			},
-			"ssh": map[string]interface{}{
-				"keyPath": mergedConfig.SSH.KeyPath,
-				"user":    mergedConfig.SSH.User,
-				"port":    mergedConfig.SSH.Port,
-			},
-		}
-		kubesprayConfigPath := filepath.Join(outputPaths.OutputDir, "kubesprayConfig.json")
-		if err := writeJSONFile(kubesprayConfigPath, kubesprayConfig); err != nil {
-			return fmt.Errorf("write kubesprayConfig.json: %w", err)
-		}
-		fmt.Printf("  ✓ Generated: kubesprayConfig.json\n")
-	}
-
-	// Step 7: Generate metadata.json
-	fmt.Println("\n[7/7] Generating metadata...")
-	metadata := map[string]interface{}{
-		"environment": *envID,
-		"configPackage": map[string]string{
-			"id":      *configPackage,
-			"version": "v1.0.0",
-		},
-		"generatedAt": time.Now().UTC().Format(time.RFC3339),
-		"masterConfig": map[string]interface{}{
-			"platform":     mergedConfig.Infrastructure.Platform,
-			"provider":     mergedConfig.Infrastructure.Provider,
-			"orchestrator": mergedConfig.ContainerOrchestration.Orchestrator,
+	// Step 8: Generate metadata.json
+	fmt.Fprintln(w, "\n[8/8] Generating metadata...")
+	generatedAt, reproducible, err := generationTime()
+	if err != nil {
+		return nil, nil, err
+	}
+	if reproducible {
+		outputs.modTime = generatedAt
+		fmt.Fprintf(w, "  ✓ Reproducible: timestamps from SOURCE_DATE_EPOCH (%s)\n", generatedAt.Format(time.RFC3339))
+	}
+	pluginsFile := filepath.Join(rt.RepoRoot, "config", "packages", configPackage, "plugins.yaml")
+	if _, err := os.Stat(pluginsFile); err == nil {
+		templateInputs = append(templateInputs, pluginsFile)
+	}
+	inputs, err := metadata.Inputs(rt.RepoRoot, append(loader.Inputs(), templateInputs...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate metadata.json: %w", err)
+	}
+	files, err := outputs.records(rt.RepoRoot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate metadata.json: %w", err)
+	}
+	meta := metadata.Metadata{
+		SchemaVersion: metadata.SchemaVersion,
+		Environment:   envID,
+		ConfigPackage: metadata.Package{
+			ID:      configPackage,
+			Version: packageVersion,
 		},
-		"files": map[string]string{
-			"infrastructure":           outputPaths.Infrastructure,
-			"provisioner":              outputPaths.Provisioner,
-			"platform":                 outputPaths.Platform,
-			"business":                 outputPaths.Business,
-			"orchestrator_inventory":   outputPaths.ContainerOrchestration.Inventory,
-			"orchestrator_config":      outputPaths.ContainerOrchestration.Config,
-			"orchestrator_group_vars":  outputPaths.ContainerOrchestration.GroupVarsDir,
+		CLIVersion:  cliVersion(),
+		GeneratedAt: generatedAt.Format(time.RFC3339),
+		MasterConfig: metadata.Choices{
+			Platform:             mergedConfig.Infrastructure.Platform,
+			Provider:             mergedConfig.Infrastructure.Provider,
+			Format:               mergedConfig.Infrastructure.Format,
+			Orchestrator:         orchestrator,
+			OrchestratorProvider: mergedConfig.ContainerOrchestration.Provider,
+			PlatformDeployment:   mergedConfig.MasterConfig.Platform.DeploymentMethod,
+			BusinessDeployment:   mergedConfig.MasterConfig.Business.DeploymentMethod,
 		},
+		Files:     files,
+		Templates: templates,
+		Inputs:    inputs,
+		Hosts:     hostSnapshots,
+	}
+	if err := outputs.addJSON("metadata", outputPaths.Metadata, meta); err != nil {
+		return nil, nil, fmt.Errorf("generate metadata.json: %w", err)
+	}
+	return outputPaths, outputs, nil
+}
+
+// templateRecord returns the metadata record of a resolved template
+func templateRecord(repoRoot string, src template.Source) (metadata.Template, error) {
+	path, err := metadata.RepoPath(repoRoot, src.Path)
+	if err != nil {
+		return metadata.Template{}, err
+	}
+	record := metadata.Template{Path: path, Origin: src.Origin}
+	for _, override := range src.Overrides {
+		relative, err := metadata.RepoPath(repoRoot, override)
+		if err != nil {
+			return metadata.Template{}, err
+		}
+		record.Overrides = append(record.Overrides, relative)
+	}
+	return record, nil
+}
+
+// templateNote describes a template that does not come unchanged from the
+// built-in templates, for the rendered output log line
+func templateNote(src template.Source) string {
+	switch {
+	case src.Origin != template.OriginBuiltin && len(src.Overrides) > 0:
+		return fmt.Sprintf(" (%s template, %d override(s))", src.Origin, len(src.Overrides))
+	case src.Origin != template.OriginBuiltin:
+		return fmt.Sprintf(" (%s template)", src.Origin)
+	case len(src.Overrides) > 0:
+		return fmt.Sprintf(" (%d override(s))", len(src.Overrides))
 	}
+	return ""
+}
 
-	if err := writeJSONFile(outputPaths.Metadata, metadata); err != nil {
-		return fmt.Errorf("write metadata.json: %w", err)
+// handEditedOutputs returns the outputs of the previous generation whose
+// content no longer matches the checksums in its metadata.json
+func handEditedOutputs(repoRoot string, outputPaths *template.OutputPaths) ([]metadata.Change, error) {
+	if _, err := os.Stat(outputPaths.Metadata); os.IsNotExist(err) {
+		return nil, nil
+	}
+	previous, err := metadata.Read(outputPaths.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("read previous metadata: %w", err)
+	}
+	changes, err := previous.Modified(repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("check outputs for edits: %w", err)
 	}
-	fmt.Printf("  ✓ Generated: metadata.json\n")
+	return changes, nil
+}
 
-	fmt.Printf("\n✅ Environment '%s' artifacts generated successfully!\n", *envID)
-	fmt.Printf("📁 Output directory: %s\n", outputPaths.OutputDir)
+// relativeOutput returns an output path relative to the environment output directory
+func relativeOutput(outputPaths *template.OutputPaths, path string) string {
+	relative, err := filepath.Rel(outputPaths.OutputDir, path)
+	if err != nil {
+		return path
+	}
+	return relative
+}
 
+// runPlugins executes the generator plugins declared in the config package's
+// plugins.yaml and records the files they return. Plugins may only produce
+// files inside the output directory and cannot replace generated outputs.
+func (rt *Runtime) runPlugins(ctx context.Context, w io.Writer, envID, configPackage string, mergedConfig *config.MergedConfig, outputPaths *template.OutputPaths, outputs *outputSet) error {
+	packageDir := filepath.Join(rt.RepoRoot, "config", "packages", configPackage)
+	pluginConfig, err := plugin.LoadConfig(packageDir)
+	if err != nil {
+		return fmt.Errorf("load plugins: %w", err)
+	}
+
+	runner := plugin.NewRunner(packageDir)
+	for _, spec := range pluginConfig.Plugins {
+		response, err := runner.Run(ctx, spec, plugin.Request{
+			Environment:   envID,
+			ConfigPackage: configPackage,
+			Config:        mergedConfig,
+		})
+		if err != nil {
+			return err
+		}
+		for _, d := range response.Diagnostics {
+			fmt.Fprintf(w, "  • %s %s: %s\n", spec.Name, d.Severity, d.Message)
+		}
+		if response.HasErrors() {
+			return fmt.Errorf("plugin %s reported errors", spec.Name)
+		}
+
+		for _, file := range response.Files {
+			path, err := plugin.SandboxPath(outputPaths.OutputDir, file.Path)
+			if err != nil {
+				return fmt.Errorf("plugin %s: %w", spec.Name, err)
+			}
+			if err := validatePluginOutput(path, []byte(file.Content)); err != nil {
+				return fmt.Errorf("plugin %s: invalid output: %w", spec.Name, err)
+			}
+			if err := outputs.add("plugin:"+spec.Name+":"+filepath.Clean(file.Path), path, []byte(file.Content)); err != nil {
+				return fmt.Errorf("plugin %s: %w", spec.Name, err)
+			}
+			fmt.Fprintf(w, "  ✓ Rendered: %s (plugin %s)\n", filepath.Clean(file.Path), spec.Name)
+		}
+	}
 	return nil
 }
 
+// validatePluginOutput checks a plugin file like a rendered output, except
+// that YAML may hold several documents, as Kubernetes manifests do
+func validatePluginOutput(path string, content []byte) error {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		return validate.YAMLStream(path, content)
+	}
+	return validate.Output(path, content)
+}
+
+// planOperations diffs the current hosts against those the cluster runs and
+// returns the Kubespray operations needed to converge, with the inventory of
+// the running hosts when there are any. The running hosts are those of a
+// pending plan, unless applied is set, or else those recorded in the
+// previous metadata.json. The plan is nil when there is no previous host
+// record to compare against.
+func (rt *Runtime) planOperations(w io.Writer, envID string, outputPaths *template.OutputPaths, hosts []plan.HostSnapshot, applied bool) (*plan.OperationsPlan, []byte, error) {
+	if _, err := os.Stat(outputPaths.Metadata); os.IsNotExist(err) {
+		fmt.Fprintln(w, "  ⊘ Skipped: no previous generation to compare against")
+		return nil, nil, nil
+	}
+
+	previous, err := metadata.Read(outputPaths.Metadata)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read previous metadata: %w", err)
+	}
+	if previous.Hosts == nil {
+		fmt.Fprintln(w, "  ⊘ Skipped: previous metadata has no host record")
+		return nil, nil, nil
+	}
+
+	// Until a plan is applied, its removed nodes are still in the cluster
+	// and the inventory written with it is the only one that lists them
+	running, inventory := previous.Hosts, plan.CurrentInventory
+	pending, err := readOperationsPlan(outputPaths.Operations)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pending != nil && pending.Pending() {
+		if applied {
+			fmt.Fprintln(w, "  ✓ Pending plan marked as applied (--operations-applied)")
+		} else {
+			fmt.Fprintln(w, "  ! Planning against the hosts of the pending plan; pass --operations-applied once it has been run")
+			running, inventory = pending.AppliedHosts, plan.PreviousInventory
+		}
+	}
+	runningInventory, err := os.ReadFile(outputPaths.Path(inventory))
+	if os.IsNotExist(err) && inventory == plan.CurrentInventory {
+		fmt.Fprintln(w, "  ⊘ Skipped: previous generation has no Kubespray inventory")
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read inventory of the running hosts: %w", err)
+	}
+
+	operations := plan.BuildOperations(envID, plan.DiffHosts(running, hosts))
+
+	for _, change := range operations.Changes {
+		fmt.Fprintf(w, "  • %s: %s\n", change.Host, change.Kind)
+	}
+	for _, op := range operations.Operations {
+		limit := ""
+		if len(op.Limit) > 0 {
+			limit = " --limit=" + strings.Join(op.Limit, ",")
+		}
+		fmt.Fprintf(w, "  %d. ansible-playbook -i %s %s%s\n", op.Order, op.Inventory, op.Playbook, limit)
+	}
+	if operations.Empty() {
+		fmt.Fprintln(w, "  ✓ No host changes detected")
+		return operations, nil, nil
+	}
+	operations.AppliedHosts = running
+	return operations, runningInventory, nil
+}
+
+// readOperationsPlan reads the operations.json of the previous generation,
+// returning nil when there is none
+func readOperationsPlan(path string) (*plan.OperationsPlan, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read previous operations plan: %w", err)
+	}
+	var operations plan.OperationsPlan
+	if err := json.Unmarshal(data, &operations); err != nil {
+		return nil, fmt.Errorf("parse previous operations plan: %w", err)
+	}
+	return &operations, nil
+}
+
 // validateEnvironments validates environment override files against schemas
-func (rt *Runtime) validateEnvironments(envID string) error {
+func (rt *Runtime) validateEnvironments(w io.Writer, envID string) error {
 	// TODO: Implement schema validation using api/schemas/environments/*.yaml
 	// For now, just check if files exist
 	modules := []string{"infrastructure", "container-orchestration", "platform", "provisioner", "business"}
@@ -209,8 +675,8 @@ func (rt *Runtime) validateEnvironments(envID string) error {
 		envPath := filepath.Join(rt.RepoRoot, module, "environments", fmt.Sprintf("%s.yaml", envID))
 		if _, err := os.Stat(envPath); err == nil {
 			// File exists - in a full implementation, validate against schema
-			fmt.Printf("  • Checking %s environment override... ", module)
-			fmt.Println("(schema validation not yet implemented)")
+			fmt.Fprintf(w, "  • Checking %s environment override... ", module)
+			fmt.Fprintln(w, "(schema validation not yet implemented)")
 		}
 	}
 
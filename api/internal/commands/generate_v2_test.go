@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/template"
+)
+
+func TestRunPluginsAcceptsYAMLStreams(t *testing.T) {
+	repo := t.TempDir()
+	packageDir := filepath.Join(repo, "config", "packages", "core")
+	if err := os.MkdirAll(filepath.Join(packageDir, "plugins"), 0o755); err != nil {
+		t.Fatalf("mkdir plugins: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(packageDir, "plugins.yaml"), []byte("plugins:\n  - name: claims\n    command: ./plugins/claims\n"), 0o644); err != nil {
+		t.Fatalf("write plugins.yaml: %v", err)
+	}
+	writeResponse := func(content string) {
+		script := "#!/bin/sh\ncat >/dev/null\necho '{\"apiVersion\":\"pn-infra.io/v1alpha1\",\"kind\":\"GeneratorResponse\",\"files\":[{\"path\":\"claims/claims.yaml\",\"content\":\"" + content + "\"}]}'\n"
+		if err := os.WriteFile(filepath.Join(packageDir, "plugins", "claims"), []byte(script), 0o755); err != nil {
+			t.Fatalf("write plugin: %v", err)
+		}
+	}
+
+	rt := &Runtime{RepoRoot: repo}
+	outputPaths := &template.OutputPaths{OutputDir: filepath.Join(repo, "api", "outputs", "development")}
+	writeResponse(`kind: A\\n---\\nkind: B\\n`)
+	outputs := newOutputSet()
+	if err := rt.runPlugins(context.Background(), io.Discard, "development", "core", &config.MergedConfig{}, outputPaths, outputs); err != nil {
+		t.Fatalf("run plugins: %v", err)
+	}
+	if !outputs.has(filepath.Join(outputPaths.OutputDir, "claims", "claims.yaml")) {
+		t.Fatalf("expected the plugin file in the outputs")
+	}
+
+	writeResponse(`kind: A\\n---\\nkind: B\\nkind: C\\n`)
+	if err := rt.runPlugins(context.Background(), io.Discard, "development", "core", &config.MergedConfig{}, outputPaths, newOutputSet()); err == nil {
+		t.Fatalf("expected an error for a duplicate key in the second document")
+	}
+}
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"pn-infra/api/internal/config"
+)
+
+// Graph formats of graph apps
+const (
+	formatDOT     = "dot"
+	formatMermaid = "mermaid"
+)
+
+// graphApps prints the business application dependency graph of a config
+// package, each application labelled with its sync wave, for reviews
+func (rt *Runtime) graphApps(args []string) error {
+	fs := flag.NewFlagSet("graph apps", flag.ContinueOnError)
+	configPackage := fs.String("config", "core", "config package identifier")
+	format := fs.String("format", formatDOT, "graph format: dot or mermaid")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != formatDOT && *format != formatMermaid {
+		return fmt.Errorf("invalid --format %q: must be %s or %s", *format, formatDOT, formatMermaid)
+	}
+
+	apps, err := config.NewLoader(rt.RepoRoot, *configPackage, "").LoadBusinessApps()
+	if err != nil {
+		return err
+	}
+	graph, err := config.BuildAppGraph(apps.Applications)
+	if err != nil {
+		return fmt.Errorf("business applications: %w", err)
+	}
+	if *format == formatMermaid {
+		writeMermaid(os.Stdout, graph)
+	} else {
+		writeDOT(os.Stdout, graph)
+	}
+	return nil
+}
+
+// waveLabel describes the sync wave of an application
+func waveLabel(node config.AppNode) string {
+	label := fmt.Sprintf("wave %d", node.SyncWave)
+	if node.Derived {
+		label += ", derived"
+	}
+	if !node.Enabled {
+		label += ", disabled"
+	}
+	return label
+}
+
+// writeDOT writes the graph in Graphviz DOT, edges pointing from each
+// dependency to its dependents; disabled applications are dashed
+func writeDOT(w io.Writer, graph *config.AppGraph) {
+	fmt.Fprintln(w, "digraph apps {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, node := range graph.Apps {
+		style := ""
+		if !node.Enabled {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(w, "  %s [label=%s%s];\n", strconv.Quote(node.Name), strconv.Quote(node.Name+"\n"+waveLabel(node)), style)
+	}
+	for _, node := range graph.Apps {
+		for _, dependency := range node.Dependencies {
+			fmt.Fprintf(w, "  %s -> %s;\n", strconv.Quote(dependency), strconv.Quote(node.Name))
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// writeMermaid writes the graph as a Mermaid flowchart. Nodes get generated
+// ids, since application names may contain characters Mermaid reserves.
+func writeMermaid(w io.Writer, graph *config.AppGraph) {
+	ids := make(map[string]string, len(graph.Apps))
+	fmt.Fprintln(w, "flowchart LR")
+	for i, node := range graph.Apps {
+		ids[node.Name] = fmt.Sprintf("app%d", i)
+		label := strings.ReplaceAll(node.Name+"<br/>"+waveLabel(node), `"`, "#quot;")
+		fmt.Fprintf(w, "  %s[\"%s\"]\n", ids[node.Name], label)
+	}
+	for _, node := range graph.Apps {
+		for _, dependency := range node.Dependencies {
+			fmt.Fprintf(w, "  %s --> %s\n", ids[dependency], ids[node.Name])
+		}
+	}
+	var disabled []string
+	for _, node := range graph.Apps {
+		if !node.Enabled {
+			disabled = append(disabled, ids[node.Name])
+		}
+	}
+	if len(disabled) > 0 {
+		fmt.Fprintln(w, "  classDef disabled stroke-dasharray: 5 5")
+		fmt.Fprintf(w, "  class %s disabled\n", strings.Join(disabled, ","))
+	}
+}
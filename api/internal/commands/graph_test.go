@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"pn-infra/api/internal/config"
+)
+
+func testAppGraph(t *testing.T) *config.AppGraph {
+	t.Helper()
+	wave := -1
+	graph, err := config.BuildAppGraph([]config.Application{
+		{Name: "db", Enabled: true, SyncWave: &wave},
+		{Name: "api", Enabled: true, Dependencies: []string{"db"}},
+		{Name: "legacy \"v1\"", Dependencies: []string{"db", "api"}},
+	})
+	if err != nil {
+		t.Fatalf("BuildAppGraph: %v", err)
+	}
+	return graph
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	writeDOT(&buf, testAppGraph(t))
+	want := `digraph apps {
+  rankdir=LR;
+  node [shape=box];
+  "db" [label="db\nwave -1"];
+  "api" [label="api\nwave 0, derived"];
+  "legacy \"v1\"" [label="legacy \"v1\"\nwave 1, derived, disabled", style=dashed];
+  "db" -> "api";
+  "db" -> "legacy \"v1\"";
+  "api" -> "legacy \"v1\"";
+}
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected DOT:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	writeMermaid(&buf, testAppGraph(t))
+	want := `flowchart LR
+  app0["db<br/>wave -1"]
+  app1["api<br/>wave 0, derived"]
+  app2["legacy #quot;v1#quot;<br/>wave 1, derived, disabled"]
+  app0 --> app1
+  app0 --> app2
+  app1 --> app2
+  classDef disabled stroke-dasharray: 5 5
+  class app2 disabled
+`
+	if buf.String() != want {
+		t.Fatalf("unexpected Mermaid:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/diff"
+	"pn-infra/api/internal/template"
+	"pn-infra/api/internal/validate"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of TestGoldenMatrix")
+
+// matrixProviders are the infrastructure providers each platform is rendered with
+var matrixProviders = []string{"terraform", "pulumi"}
+
+type matrixCombination struct {
+	Platform, Provider, Orchestrator string
+}
+
+func (c matrixCombination) String() string {
+	if c.Platform == "none" {
+		return "none-" + c.Orchestrator
+	}
+	return c.Platform + "-" + c.Provider + "-" + c.Orchestrator
+}
+
+// matrixCombinations pairs every registered platform and provider, and no
+// platform, with every registered orchestrator
+func matrixCombinations() []matrixCombination {
+	var combinations []matrixCombination
+	for _, orchestrator := range config.Orchestrators() {
+		combinations = append(combinations, matrixCombination{"none", "none", orchestrator})
+		for _, platform := range config.Platforms() {
+			for _, provider := range matrixProviders {
+				combinations = append(combinations, matrixCombination{platform, provider, orchestrator})
+			}
+		}
+	}
+	return combinations
+}
+
+// TestGoldenMatrix renders the built-in templates for every combination of
+// the fixture package in testdata/matrix, loading and merging its config as
+// if config.yaml chose the combination, and compares the checked outputs with
+// testdata/matrix/golden/<combination>.golden. Run with -update to rewrite
+// the golden files after an intended template change.
+func TestGoldenMatrix(t *testing.T) {
+	fixture, err := filepath.Abs(filepath.Join("testdata", "matrix"))
+	if err != nil {
+		t.Fatalf("fixture: %v", err)
+	}
+	templates, err := filepath.Abs(filepath.Join("..", "..", "templates"))
+	if err != nil {
+		t.Fatalf("templates: %v", err)
+	}
+
+	combinations := matrixCombinations()
+	expected := map[string]bool{}
+	for _, combination := range combinations {
+		expected[combination.String()+".golden"] = true
+		t.Run(combination.String(), func(t *testing.T) {
+			outputs, err := renderCombination(fixture, templates, combination)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			golden := filepath.Join(fixture, "golden", combination.String()+".golden")
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+					t.Fatalf("create golden directory: %v", err)
+				}
+				if err := os.WriteFile(golden, outputs, 0644); err != nil {
+					t.Fatalf("write golden: %v", err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden (run go test -run TestGoldenMatrix -update to create it): %v", err)
+			}
+			if !bytes.Equal(outputs, want) {
+				t.Fatalf("outputs differ from %s (run go test -run TestGoldenMatrix -update to accept them):\n%s",
+					golden, diff.Unified("golden", "rendered", want, outputs))
+			}
+		})
+	}
+
+	// Golden files of combinations that no longer exist are stale
+	entries, err := os.ReadDir(filepath.Join(fixture, "golden"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("list golden files: %v", err)
+	}
+	for _, entry := range entries {
+		if expected[entry.Name()] {
+			continue
+		}
+		if *updateGolden {
+			if err := os.Remove(filepath.Join(fixture, "golden", entry.Name())); err != nil {
+				t.Fatalf("remove stale golden file: %v", err)
+			}
+			continue
+		}
+		t.Errorf("stale golden file %s (run go test -run TestGoldenMatrix -update to remove it)", entry.Name())
+	}
+}
+
+// renderCombination runs load, merge, provider validation, template
+// resolution, rendering and output checks for one combination, and returns
+// the outputs in render order, each under a "-- <output> --" header
+func renderCombination(fixture, templates string, combination matrixCombination) ([]byte, error) {
+	loader := config.NewLoader(fixture, "matrix", "development")
+	master, err := loader.LoadMasterConfig()
+	if err != nil {
+		return nil, err
+	}
+	master.Infrastructure.Platform = combination.Platform
+	master.Infrastructure.Provider = combination.Provider
+	master.ContainerOrchestration.Orchestrator = combination.Orchestrator
+	merged, err := loader.LoadAndMergeFor(master)
+	if err != nil {
+		return nil, fmt.Errorf("load configuration: %w", err)
+	}
+	if err := config.ValidateProviders(merged); err != nil {
+		return nil, fmt.Errorf("validate configuration: %w", err)
+	}
+
+	resolver := template.NewPathResolver(fixture)
+	resolver.SearchPath = []template.SearchDir{{Dir: templates, Origin: template.OriginBuiltin}}
+	paths, err := resolver.Resolve(&merged.MasterConfig)
+	if err != nil {
+		return nil, fmt.Errorf("resolve template paths: %w", err)
+	}
+	targets := append(paths.Infrastructure, paths.ContainerOrchestration...)
+	targets = append(targets,
+		template.Target{Name: "provisioner", Template: paths.Provisioner, Output: "provisioner.json"},
+		template.Target{Name: "platform", Template: paths.Platform, Output: "platform.yaml"},
+		template.Target{Name: "business", Template: paths.Business, Output: "business.yaml"},
+	)
+
+	renderer := template.NewRenderer(fixture)
+	var outputs bytes.Buffer
+	for _, target := range targets {
+		output := strings.ReplaceAll(target.Output, config.EnvironmentPlaceholder, merged.Environment)
+		content, err := renderer.RenderChecked(target.Template, output, merged, validate.Output)
+		if err != nil {
+			return nil, fmt.Errorf("render %s: %w", target.Name, err)
+		}
+		fmt.Fprintf(&outputs, "-- %s --\n%s", filepath.ToSlash(output), content)
+		if !strings.HasSuffix(content, "\n") {
+			outputs.WriteString("\n")
+		}
+	}
+	return outputs.Bytes(), nil
+}
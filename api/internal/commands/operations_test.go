@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/metadata"
+	"pn-infra/api/internal/plan"
+	"pn-infra/api/internal/template"
+)
+
+func TestPlanOperationsKeepsPendingPlanUntilApplied(t *testing.T) {
+	repo := t.TempDir()
+	outputPaths := template.NewPathResolver(repo).ResolveOutputPaths("development")
+	rt := &Runtime{RepoRoot: repo}
+
+	// The last generation ran the cluster on two workers
+	workers := plan.Snapshot([]config.Host{
+		{Name: "worker-01", Groups: []string{"kube_node"}},
+		{Name: "worker-02", Groups: []string{"kube_node"}},
+	})
+	generate := func(hosts []plan.HostSnapshot, inventory string, operations *plan.OperationsPlan, previousInventory []byte) {
+		t.Helper()
+		outputs := newOutputSet()
+		if err := outputs.add("inventory", outputPaths.Path(plan.CurrentInventory), []byte(inventory)); err != nil {
+			t.Fatalf("add inventory: %v", err)
+		}
+		if operations != nil {
+			if err := outputs.addJSON("operations", outputPaths.Operations, operations); err != nil {
+				t.Fatalf("add operations: %v", err)
+			}
+		}
+		if previousInventory != nil {
+			if err := outputs.add("operations_inventory", outputPaths.Path(plan.PreviousInventory), previousInventory); err != nil {
+				t.Fatalf("add previous inventory: %v", err)
+			}
+		}
+		meta := metadata.Metadata{SchemaVersion: metadata.SchemaVersion, Environment: "development", Hosts: hosts}
+		if err := outputs.addJSON("metadata", outputPaths.Metadata, meta); err != nil {
+			t.Fatalf("add metadata: %v", err)
+		}
+		if _, err := outputs.commit(outputPaths.OutputDir); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+	}
+	generate(workers, "worker-01\nworker-02\n", nil, nil)
+
+	// Removing worker-02 plans remove-node.yml against an inventory that lists it
+	scaledIn := workers[:1]
+	operations, previousInventory, err := rt.planOperations(io.Discard, "development", outputPaths, scaledIn, false)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if len(operations.Operations) != 1 || operations.Operations[0].Inventory != plan.PreviousInventory {
+		t.Fatalf("expected remove-node.yml against %s, got %+v", plan.PreviousInventory, operations.Operations)
+	}
+	if string(previousInventory) != "worker-01\nworker-02\n" {
+		t.Fatalf("expected the inventory of the running hosts, got %q", previousInventory)
+	}
+	generate(scaledIn, "worker-01\n", operations, previousInventory)
+	if _, err := os.Stat(filepath.Join(outputPaths.OutputDir, plan.PreviousInventory)); err != nil {
+		t.Fatalf("expected the previous inventory on disk: %v", err)
+	}
+
+	// Regenerating without host changes keeps the pending plan
+	operations, previousInventory, err = rt.planOperations(io.Discard, "development", outputPaths, scaledIn, false)
+	if err != nil {
+		t.Fatalf("replan: %v", err)
+	}
+	if len(operations.Operations) != 1 || operations.Operations[0].ExtraVars["node"] != "worker-02" {
+		t.Fatalf("expected the pending removal of worker-02 to be kept, got %+v", operations.Operations)
+	}
+	if string(previousInventory) != "worker-01\nworker-02\n" {
+		t.Fatalf("expected the previous inventory to be kept, got %q", previousInventory)
+	}
+	generate(scaledIn, "worker-01\n", operations, previousInventory)
+
+	// Once applied, the plan is against the last generation
+	operations, previousInventory, err = rt.planOperations(io.Discard, "development", outputPaths, scaledIn, true)
+	if err != nil {
+		t.Fatalf("plan after apply: %v", err)
+	}
+	if !operations.Empty() || previousInventory != nil {
+		t.Fatalf("expected an empty plan without inventory, got %+v", operations.Operations)
+	}
+}
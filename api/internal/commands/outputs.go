@@ -0,0 +1,424 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"pn-infra/api/internal/diff"
+	"pn-infra/api/internal/metadata"
+)
+
+// errOutputsChanged is returned by --diff when the generated outputs differ
+// from those on disk, so CI can fail on stale committed outputs
+var errOutputsChanged = errors.New("generated outputs differ from the files on disk")
+
+// generatedFile is an output held in memory until generation completes
+type generatedFile struct {
+	Name    string // key in metadata.json files
+	Path    string // absolute output path
+	Content []byte
+}
+
+// outputSet collects the outputs of one generation in production order
+type outputSet struct {
+	files []generatedFile
+	paths map[string]bool
+
+	// modTime, when set, is applied to every written output so archives of
+	// the output directory are reproducible too
+	modTime time.Time
+}
+
+func newOutputSet() *outputSet {
+	return &outputSet{paths: map[string]bool{}}
+}
+
+// add records an output, rejecting a second output with the same path
+func (s *outputSet) add(name, path string, content []byte) error {
+	path = filepath.Clean(path)
+	if s.paths[path] {
+		return fmt.Errorf("%s is already generated", path)
+	}
+	s.paths[path] = true
+	s.files = append(s.files, generatedFile{Name: name, Path: path, Content: content})
+	return nil
+}
+
+// addJSON records data encoded the same way writeJSONFile writes it
+func (s *outputSet) addJSON(name, path string, data interface{}) error {
+	content, err := encodeJSON(data)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", filepath.Base(path), err)
+	}
+	return s.add(name, path, content)
+}
+
+func (s *outputSet) has(path string) bool {
+	return s.paths[filepath.Clean(path)]
+}
+
+// records returns the metadata entry of every output: its repo-relative
+// path and the SHA-256 of its content
+func (s *outputSet) records(repoRoot string) (map[string]metadata.File, error) {
+	records := make(map[string]metadata.File, len(s.files))
+	for _, file := range s.files {
+		path, err := metadata.RepoPath(repoRoot, file.Path)
+		if err != nil {
+			return nil, err
+		}
+		records[file.Name] = metadata.File{Path: path, SHA256: metadata.Hash(file.Content)}
+	}
+	return records, nil
+}
+
+// commit writes every output into a staging directory next to outputDir and
+// swaps it in, so a failed generation never leaves a mix of new and stale
+// files. Files in outputDir that this generation did not produce are pruned,
+// unless preserved; their paths, relative to outputDir, are returned.
+//
+// The swap is not atomic: it is two renames, outputDir aside to .previous
+// and staging into place, with .previous renamed back if the second rename
+// fails. Between the renames outputDir does not exist, so a reader sees the
+// old outputs, no outputs or the new outputs, never a partial write. A run
+// that dies between the renames leaves the old outputs in .previous, where
+// restoreOutputs finds them on the next run.
+func (s *outputSet) commit(outputDir string) ([]string, error) {
+	parent, base := filepath.Split(filepath.Clean(outputDir))
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("create output directory: %w", err)
+	}
+	if err := restoreOutputs(outputDir); err != nil {
+		return nil, err
+	}
+
+	staging, err := os.MkdirTemp(parent, "."+base+".staging-")
+	if err != nil {
+		return nil, fmt.Errorf("create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	if err := os.Chmod(staging, 0755); err != nil {
+		return nil, fmt.Errorf("create staging directory: %w", err)
+	}
+
+	for _, file := range s.files {
+		relative, err := filepath.Rel(outputDir, file.Path)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("output %s is outside %s", file.Path, outputDir)
+		}
+		path := filepath.Join(staging, relative)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("create output directory: %w", err)
+		}
+		if err := os.WriteFile(path, file.Content, 0644); err != nil {
+			return nil, fmt.Errorf("write output %s: %w", file.Path, err)
+		}
+		if !s.modTime.IsZero() {
+			if err := os.Chtimes(path, s.modTime, s.modTime); err != nil {
+				return nil, fmt.Errorf("write output %s: %w", file.Path, err)
+			}
+		}
+	}
+
+	pruned, preserved, err := s.scan(outputDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, relative := range preserved {
+		if err := copyFile(filepath.Join(outputDir, relative), filepath.Join(staging, relative)); err != nil {
+			return nil, fmt.Errorf("preserve %s: %w", relative, err)
+		}
+	}
+
+	previous := previousOutputs(outputDir)
+	if err := os.RemoveAll(previous); err != nil {
+		return nil, fmt.Errorf("remove previous outputs: %w", err)
+	}
+	hadPrevious := true
+	if err := os.Rename(outputDir, previous); os.IsNotExist(err) {
+		hadPrevious = false
+	} else if err != nil {
+		return nil, fmt.Errorf("move aside %s: %w", outputDir, err)
+	}
+	if err := os.Rename(staging, outputDir); err != nil {
+		if hadPrevious {
+			if restoreErr := os.Rename(previous, outputDir); restoreErr != nil {
+				return nil, fmt.Errorf("swap in outputs: %w (restoring previous outputs from %s failed: %v)", err, previous, restoreErr)
+			}
+		}
+		return nil, fmt.Errorf("swap in outputs: %w", err)
+	}
+	if err := os.RemoveAll(previous); err != nil {
+		return nil, fmt.Errorf("remove previous outputs: %w", err)
+	}
+	return pruned, nil
+}
+
+// previousOutputs returns where commit moves the outputs it replaces
+func previousOutputs(outputDir string) string {
+	parent, base := filepath.Split(filepath.Clean(outputDir))
+	return filepath.Join(parent, "."+base+".previous")
+}
+
+// restoreOutputs moves the previous outputs back into place when a commit
+// died after moving them aside and before swapping in the staging directory,
+// leaving them as the only copy of the outputs and preserved files
+func restoreOutputs(outputDir string) error {
+	previous := previousOutputs(outputDir)
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(previous); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.Rename(previous, outputDir); err != nil {
+		return fmt.Errorf("restore outputs left aside in %s: %w", previous, err)
+	}
+	return nil
+}
+
+// preserveFile lists glob patterns, relative to the output directory, of
+// files that generation does not produce but must keep, in addition to
+// defaultPreservePatterns. A pattern ending in / keeps the whole directory.
+const preserveFile = ".preserve"
+
+// defaultPreservePatterns are kept in every environment, with or without a
+// .preserve file: the credentials Kubespray writes next to its inventory
+var defaultPreservePatterns = []string{
+	"kubespray/credentials/",
+	"kubesprayInventory/credentials/",
+}
+
+// scan splits the existing files under outputDir that this generation does
+// not produce into stale files, to be pruned, and preserved files, to be
+// carried over. Paths are relative to outputDir.
+func (s *outputSet) scan(outputDir string) (stale, preserved []string, err error) {
+	patterns, err := readPreservePatterns(outputDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == outputDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || s.has(path) {
+			return nil
+		}
+		relative, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		if relative == preserveFile || preservedPath(patterns, filepath.ToSlash(relative)) {
+			preserved = append(preserved, relative)
+		} else {
+			stale = append(stale, relative)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("scan existing outputs: %w", err)
+	}
+	return stale, preserved, nil
+}
+
+func readPreservePatterns(outputDir string) ([]string, error) {
+	patterns := append([]string(nil), defaultPreservePatterns...)
+	data, err := os.ReadFile(filepath.Join(outputDir, preserveFile))
+	if os.IsNotExist(err) {
+		return patterns, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", preserveFile, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, nil
+}
+
+func preservedPath(patterns []string, relative string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(relative, pattern) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, relative); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lockOutputs takes an exclusive lock on an environment's output directory by
+// creating a lock file next to it. Concurrent generations of the same
+// environment fail instead of interleaving their writes. The lock records the
+// holder's PID and host; a lock whose process no longer runs on this host was
+// left by a killed run and is taken over.
+func lockOutputs(outputDir string) (release func(), err error) {
+	parent, base := filepath.Split(filepath.Clean(outputDir))
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("create output directory: %w", err)
+	}
+	path := filepath.Join(parent, "."+base+".lock")
+	host, _ := os.Hostname()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		holder, _ := os.ReadFile(path)
+		if !staleLock(string(holder), host) {
+			return nil, fmt.Errorf("outputs for %s are locked by another generation (%s); remove %s if no generation is running",
+				base, strings.TrimSpace(string(holder)), path)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("remove stale lock file: %w", err)
+		}
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("outputs for %s are locked by another generation; remove %s if no generation is running", base, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create lock file: %w", err)
+	}
+	fmt.Fprintf(file, "pid %d on %s since %s\n", os.Getpid(), host, time.Now().UTC().Format(time.RFC3339))
+	file.Close()
+	release = func() { os.Remove(path) }
+
+	// The previous generation's metadata and operations plan are read
+	// before commit, so restore outputs an interrupted swap left aside now
+	if err := restoreOutputs(outputDir); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// staleLock reports whether a lock file was written by a process of this
+// host that has exited. Locks from other hosts, or that cannot be parsed,
+// are never stale.
+func staleLock(holder, host string) bool {
+	var pid int
+	var holderHost string
+	if _, err := fmt.Sscanf(holder, "pid %d on %s since", &pid, &holderHost); err != nil || pid <= 0 {
+		return false
+	}
+	if host == "" || holderHost != host {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return true
+	}
+	return errors.Is(process.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
+
+// compare reports each output that would be added, modified or pruned
+// relative to the files on disk, printing a unified diff per file when showDiff is set.
+// It returns the number of changed files.
+func (s *outputSet) compare(w io.Writer, outputDir string, showDiff bool) (int, error) {
+	changed := 0
+	for _, file := range s.files {
+		relative, err := filepath.Rel(outputDir, file.Path)
+		if err != nil {
+			relative = file.Path
+		}
+
+		existing, err := os.ReadFile(file.Path)
+		status := "modified"
+		if os.IsNotExist(err) {
+			status = "added"
+			existing = nil
+		} else if err != nil {
+			return 0, fmt.Errorf("read existing output %s: %w", file.Path, err)
+		}
+
+		var patch string
+		if relative == "metadata.json" {
+			patch = diff.Files(relative, withoutTimestamp(existing), withoutTimestamp(file.Content))
+		} else {
+			patch = diff.Files(relative, existing, file.Content)
+		}
+		if patch == "" {
+			continue
+		}
+
+		changed++
+		fmt.Fprintf(w, "  ~ %s (%s)\n", relative, status)
+		if showDiff {
+			fmt.Fprint(w, patch)
+		}
+	}
+
+	stale, _, err := s.scan(outputDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, relative := range stale {
+		changed++
+		fmt.Fprintf(w, "  ~ %s (removed)\n", relative)
+		if showDiff {
+			existing, err := os.ReadFile(filepath.Join(outputDir, relative))
+			if err != nil {
+				return 0, fmt.Errorf("read existing output %s: %w", relative, err)
+			}
+			fmt.Fprint(w, diff.Unified("a/"+relative, "/dev/null", existing, nil))
+		}
+	}
+	return changed, nil
+}
+
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, info.Mode().Perm())
+}
+
+// withoutTimestamp drops metadata.json's generatedAt so a regeneration with
+// identical outputs is not reported as a change
+func withoutTimestamp(content []byte) []byte {
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return content
+	}
+	delete(metadata, "generatedAt")
+	stripped, err := encodeJSON(metadata)
+	if err != nil {
+		return content
+	}
+	return stripped
+}
+
+// encodeJSON formats data as indented JSON with a trailing newline
+func encodeJSON(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitPrunesStaleAndKeepsPreservedFiles(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "development")
+	existing := map[string]string{
+		".preserve":                           "notes/\n",
+		"notes/runbook.md":                    "# runbook\n",
+		"kubespray/credentials/kubeadm_certs": "secret",
+		"kubespray/stale.ini":                 "stale",
+		"business.yaml":                       "old: true\n",
+	}
+	for relative, content := range existing {
+		path := filepath.Join(outputDir, relative)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", relative, err)
+		}
+	}
+
+	outputs := newOutputSet()
+	if err := outputs.add("business", filepath.Join(outputDir, "business.yaml"), []byte("new: true\n")); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	pruned, err := outputs.commit(outputDir)
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0] != filepath.Join("kubespray", "stale.ini") {
+		t.Fatalf("expected only kubespray/stale.ini pruned, got %v", pruned)
+	}
+	if data, err := os.ReadFile(filepath.Join(outputDir, "kubespray", "credentials", "kubeadm_certs")); err != nil || string(data) != "secret" {
+		t.Fatalf("preserved credentials lost: %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "notes", "runbook.md")); err != nil {
+		t.Fatalf("file listed in .preserve lost: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, ".preserve")); err != nil {
+		t.Fatalf(".preserve lost: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(outputDir, "business.yaml")); string(data) != "new: true\n" {
+		t.Fatalf("business.yaml not replaced: %q", data)
+	}
+}
+
+func TestCommitKeepsCredentialsWithoutPreserveFile(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "staging")
+	credentials := []string{
+		filepath.Join("kubespray", "credentials", "kubeadm_certs"),
+		filepath.Join("kubesprayInventory", "credentials", "kubeadm_certs"),
+	}
+	for _, relative := range credentials {
+		path := filepath.Join(outputDir, relative)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("secret"), 0644); err != nil {
+			t.Fatalf("write %s: %v", relative, err)
+		}
+	}
+
+	pruned, err := newOutputSet().commit(outputDir)
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if len(pruned) != 0 {
+		t.Fatalf("expected nothing pruned, got %v", pruned)
+	}
+	for _, relative := range credentials {
+		if data, err := os.ReadFile(filepath.Join(outputDir, relative)); err != nil || string(data) != "secret" {
+			t.Fatalf("credentials %s lost: %q (%v)", relative, data, err)
+		}
+	}
+}
+
+func TestCommitRestoresOutputsLeftAsideByInterruptedSwap(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "development")
+	// A run died after moving the outputs aside and before swapping in
+	previous := previousOutputs(outputDir)
+	credentials := filepath.Join(previous, "kubespray", "credentials", "kubeadm_certs")
+	if err := os.MkdirAll(filepath.Dir(credentials), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(previous, ".preserve"), []byte("kubespray/credentials/\n"), 0644); err != nil {
+		t.Fatalf("write .preserve: %v", err)
+	}
+	if err := os.WriteFile(credentials, []byte("secret"), 0644); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+
+	if _, err := newOutputSet().commit(outputDir); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(outputDir, "kubespray", "credentials", "kubeadm_certs")); err != nil || string(data) != "secret" {
+		t.Fatalf("credentials left aside were not restored: %q (%v)", data, err)
+	}
+	if _, err := os.Stat(previous); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be gone, got %v", previous, err)
+	}
+}
+
+func TestLockOutputsTakesOverLocksOfExitedProcesses(t *testing.T) {
+	outputDir := filepath.Join(t.TempDir(), "development")
+	lock := filepath.Join(filepath.Dir(outputDir), ".development.lock")
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skipf("hostname: %v", err)
+	}
+
+	release, err := lockOutputs(outputDir)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if _, err := lockOutputs(outputDir); err == nil || !strings.Contains(err.Error(), "remove "+lock) {
+		t.Fatalf("expected the running holder to keep the lock, got %v", err)
+	}
+	release()
+
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatalf("run child process: %v", err)
+	}
+	stale := fmt.Sprintf("pid %d on %s since 2024-01-01T00:00:00Z\n", exited.Process.Pid, host)
+	if err := os.WriteFile(lock, []byte(stale), 0644); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	release, err = lockOutputs(outputDir)
+	if err != nil {
+		t.Fatalf("expected the lock of an exited process to be taken over: %v", err)
+	}
+	release()
+
+	other := fmt.Sprintf("pid %d on %s-other since 2024-01-01T00:00:00Z\n", exited.Process.Pid, host)
+	if err := os.WriteFile(lock, []byte(other), 0644); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	if _, err := lockOutputs(outputDir); err == nil {
+		t.Fatalf("expected a lock held on another host to be kept")
+	}
+}
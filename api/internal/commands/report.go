@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"pn-infra/api/internal/template"
+)
+
+// Failure report formats of generate env
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// errorReport is the --format json report: one entry per failure. Template
+// errors carry their location, snippet and data path; other failures only a
+// message.
+type errorReport struct {
+	Errors []reportedError `json:"errors"`
+}
+
+type reportedError struct {
+	Environment string `json:"environment"`
+	template.RenderError
+}
+
+// progressWriter returns where progress logs go: stdout, unless stdout
+// carries the JSON report
+func progressWriter(format string) io.Writer {
+	if format == formatJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// writeErrorReport writes the failures of results as an indented JSON
+// errorReport. The errors list is empty, not null, when everything passed.
+func writeErrorReport(w io.Writer, results []envResult) error {
+	report := errorReport{Errors: []reportedError{}}
+	for _, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		for _, err := range leafErrors(result.Err) {
+			entry := reportedError{Environment: result.ID}
+			var renderErr *template.RenderError
+			if errors.As(err, &renderErr) {
+				entry.RenderError = *renderErr
+			} else {
+				entry.Message = err.Error()
+			}
+			report.Errors = append(report.Errors, entry)
+		}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode error report: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// leafErrors flattens errors.Join trees, looking through the wrappers around
+// them, so each failure of a run is reported on its own
+func leafErrors(err error) []error {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if joined, ok := e.(interface{ Unwrap() []error }); ok {
+			var leaves []error
+			for _, inner := range joined.Unwrap() {
+				leaves = append(leaves, leafErrors(inner)...)
+			}
+			return leaves
+		}
+	}
+	return []error{err}
+}
+
+// indentLines prefixes every non-empty line of s
+func indentLines(s, prefix string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "")
+}
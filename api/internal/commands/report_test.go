@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"pn-infra/api/internal/template"
+)
+
+func TestWriteErrorReportListsEachFailure(t *testing.T) {
+	renderErr := &template.RenderError{Template: "api/templates/platform/platform.yaml.tmpl", Line: 4, Column: 21, DataPath: ".Platform.Node", Message: `map has no entry for key "Node"`}
+	joined := errors.Join(
+		fmt.Errorf("render platform template: %w", renderErr),
+		errors.New("render business template: boom"),
+	)
+	results := []envResult{
+		{ID: "development", Err: joined},
+		{ID: "production"},
+		{ID: "staging", Err: fmt.Errorf("load configuration: %w", errors.New("missing config.yaml"))},
+	}
+
+	var out bytes.Buffer
+	if err := writeErrorReport(&out, results); err != nil {
+		t.Fatalf("write report: %v", err)
+	}
+	var report struct {
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, out.String())
+	}
+	if len(report.Errors) != 3 {
+		t.Fatalf("expected 3 errors, got %s", out.String())
+	}
+	first := report.Errors[0]
+	if first["environment"] != "development" || first["template"] != renderErr.Template || first["line"] != 4.0 || first["dataPath"] != ".Platform.Node" {
+		t.Fatalf("render error fields missing: %v", first)
+	}
+	if report.Errors[2]["environment"] != "staging" || report.Errors[2]["message"] != "load configuration: missing config.yaml" {
+		t.Fatalf("unexpected plain error entry: %v", report.Errors[2])
+	}
+
+	out.Reset()
+	if err := writeErrorReport(&out, results[1:2]); err != nil || out.String() != "{\n  \"errors\": []\n}\n" {
+		t.Fatalf("expected an empty errors list, got %q (%v)", out.String(), err)
+	}
+}
@@ -0,0 +1,25 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// generationTime returns the time recorded as metadata.json's generatedAt.
+// When SOURCE_DATE_EPOCH is set (https://reproducible-builds.org/specs/source-date-epoch/)
+// it is used instead of the clock, so identical inputs produce byte-identical
+// outputs; reproducible reports whether it was.
+func generationTime() (t time.Time, reproducible bool, err error) {
+	value, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || strings.TrimSpace(value) == "" {
+		return time.Now().UTC(), false, nil
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, false, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: want a non-negative number of seconds since 1970-01-01 UTC", value)
+	}
+	return time.Unix(seconds, 0).UTC(), true, nil
+}
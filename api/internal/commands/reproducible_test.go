@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerationTimeHonorsSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	got, reproducible, err := generationTime()
+	if err != nil {
+		t.Fatalf("generationTime: %v", err)
+	}
+	if !reproducible || !got.Equal(time.Unix(1700000000, 0)) || got.Location() != time.UTC {
+		t.Fatalf("got %v (reproducible %v), want 2023-11-14T22:13:20Z", got, reproducible)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, _, err := generationTime(); err == nil {
+		t.Fatalf("expected an error for a non-numeric SOURCE_DATE_EPOCH")
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	if _, reproducible, err := generationTime(); err != nil || reproducible {
+		t.Fatalf("empty SOURCE_DATE_EPOCH must fall back to the clock, got reproducible %v (%v)", reproducible, err)
+	}
+}
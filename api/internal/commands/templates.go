@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/coverage"
+	"pn-infra/api/internal/templatetest"
+)
+
+// errTemplateTestsFailed is returned by templates test when any test failed
+var errTemplateTestsFailed = errors.New("template tests failed")
+
+// templatesTest runs the template test suites (tests/*_test.yaml beside the
+// templates) under the given paths, or every suite of the built-in, package
+// and environment templates
+func (rt *Runtime) templatesTest(args []string) error {
+	fs := flag.NewFlagSet("templates test", flag.ContinueOnError)
+	update := fs.Bool("update-snapshots", false, "rewrite snapshots that differ from the rendered output and remove unused ones")
+	fs.BoolVar(update, "u", false, "shorthand for --update-snapshots")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		absolute, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, absolute)
+	}
+	suites, err := templatetest.Discover(rt.RepoRoot, paths)
+	if err != nil {
+		return err
+	}
+	if len(suites) == 0 {
+		return fmt.Errorf("no template test suites found (tests/*%s beside templates)", templatetest.SuiteSuffix)
+	}
+
+	var passed, failed, broken, written, updated, removed int
+	for _, suite := range suites {
+		result := templatetest.Run(rt.RepoRoot, suite, *update)
+		status := "PASS"
+		if !result.Passed() {
+			status = "FAIL"
+		}
+		fmt.Printf("%s  %s (%s)\n", status, suite.Name, rt.relative(suite.Path))
+		if result.Err != nil {
+			broken++
+			fmt.Printf("  ✗ %v\n", result.Err)
+		}
+		for _, test := range result.Tests {
+			if len(test.Failures) == 0 {
+				passed++
+				continue
+			}
+			failed++
+			fmt.Printf("  ✗ %s\n", test.It)
+			for _, failure := range test.Failures {
+				fmt.Print(indentLines(failure+"\n", "      "))
+			}
+		}
+		written += result.SnapshotsWritten
+		updated += result.SnapshotsUpdated
+		removed += result.SnapshotsRemoved
+	}
+
+	fmt.Printf("\nTests: %d passed, %d failed (%d suites)\n", passed, failed, len(suites))
+	if written+updated+removed > 0 {
+		fmt.Printf("Snapshots: %d written, %d updated, %d removed\n", written, updated, removed)
+	}
+	if failed > 0 || broken > 0 {
+		return errTemplateTestsFailed
+	}
+	return nil
+}
+
+// coverageEntry is a combination of the templates coverage --format json
+// report; Error is set when the combination could not be analyzed
+type coverageEntry struct {
+	*coverage.Report
+	Platform     string `json:"platform"`
+	Orchestrator string `json:"orchestrator"`
+	Error        string `json:"error,omitempty"`
+}
+
+// templatesCoverage reports, for each platform and orchestrator combination,
+// the settable MergedConfig fields that neither the selected templates nor
+// the provider artifacts use
+func (rt *Runtime) templatesCoverage(args []string) error {
+	fs := flag.NewFlagSet("templates coverage", flag.ContinueOnError)
+	configPackage := fs.String("config", "core", "config package identifier")
+	envID := fs.String("id", "development", "environment whose overrides are merged")
+	platforms := fs.String("platform", "", "comma-separated platforms to analyze (default: all registered, and none)")
+	orchestrators := fs.String("orchestrator", "", "comma-separated orchestrators to analyze (default: all registered)")
+	provider := fs.String("provider", "", "infrastructure provider of the platforms (default: config.yaml's, or "+coverage.DefaultProvider+" when it is none)")
+	all := fs.Bool("all", false, "list every settable field and how it is used, not only the ignored ones")
+	format := fs.String("format", formatText, "report format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != formatText && *format != formatJSON {
+		return fmt.Errorf("invalid --format %q: must be %s or %s", *format, formatText, formatJSON)
+	}
+
+	platformNames := splitList(*platforms)
+	if len(platformNames) == 0 {
+		platformNames = append(config.Platforms(), "none")
+	}
+	orchestratorNames := splitList(*orchestrators)
+	if len(orchestratorNames) == 0 {
+		orchestratorNames = config.Orchestrators()
+	}
+
+	var entries []coverageEntry
+	failed := false
+	for _, platform := range platformNames {
+		for _, orchestrator := range orchestratorNames {
+			report, err := coverage.Combination(rt.RepoRoot, *configPackage, *envID, platform, *provider, orchestrator)
+			entry := coverageEntry{Report: report, Platform: platform, Orchestrator: orchestrator}
+			if err != nil {
+				failed = true
+				entry.Error = err.Error()
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if *format == formatJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			return err
+		}
+	} else {
+		for _, entry := range entries {
+			printCoverage(entry, *all)
+		}
+	}
+	if failed {
+		return errors.New("some combinations could not be analyzed")
+	}
+	return nil
+}
+
+func printCoverage(entry coverageEntry, all bool) {
+	fmt.Printf("%s + %s", entry.Platform, entry.Orchestrator)
+	if entry.Error != "" {
+		fmt.Printf(": ✗ %s\n\n", entry.Error)
+		return
+	}
+	report := entry.Report
+	ignored := report.Ignored()
+	fmt.Printf(": %d templates, %d artifacts, %d of %d settable fields ignored\n",
+		len(report.Templates), len(report.Artifacts), len(ignored), len(report.Fields))
+	for _, unrendered := range report.Unrendered {
+		fmt.Printf("  ⚠ %s does not render, traced statically only: %s\n", unrendered.Template, unrendered.Error)
+	}
+	for _, field := range report.Fields {
+		switch {
+		case field.Ignored():
+			fmt.Printf("  ✗ %s\n", field.Path)
+		case !all:
+		case field.Static && field.Dynamic:
+			fmt.Printf("  ✓ %s (read, changes output)\n", field.Path)
+		case field.Static:
+			fmt.Printf("  ✓ %s (read)\n", field.Path)
+		default:
+			fmt.Printf("  ✓ %s (changes output)\n", field.Path)
+		}
+	}
+	fmt.Println()
+}
+
+// relative returns path relative to the repository root when it is inside it
+func (rt *Runtime) relative(path string) string {
+	if relative, err := filepath.Rel(rt.RepoRoot, path); err == nil {
+		return relative
+	}
+	return path
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/metadata"
+	"pn-infra/api/internal/template"
+)
+
+// errOutputsDrifted is returned by outputs verify when any output drifted
+var errOutputsDrifted = errors.New("outputs drifted from metadata.json or their sources")
+
+// verifyOutputs checks an environment's committed outputs without writing
+// anything. Outputs edited by hand are found by comparing them with the
+// checksums in metadata.json; stale outputs by regenerating in memory and
+// comparing with the checksums recorded at the last generation.
+func (rt *Runtime) verifyOutputs(args []string) error {
+	fs := flag.NewFlagSet("outputs verify", flag.ContinueOnError)
+	envID := fs.String("id", "", "environment identifier (e.g., development)")
+	configPackage := fs.String("config", "", "config package identifier (default: the package recorded in metadata.json)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *envID == "" {
+		return errors.New("missing required --id flag")
+	}
+
+	outputPaths := template.NewPathResolver(rt.RepoRoot).ResolveOutputPaths(*envID)
+	if _, err := os.Stat(outputPaths.Metadata); os.IsNotExist(err) {
+		return fmt.Errorf("no metadata.json in %s; run generate env first", outputPaths.OutputDir)
+	}
+	recorded, err := metadata.Read(outputPaths.Metadata)
+	if err != nil {
+		return err
+	}
+	if recorded.SchemaVersion < 1 {
+		return fmt.Errorf("%s has no checksums (schema version %d); regenerate the environment to record them", outputPaths.Metadata, recorded.SchemaVersion)
+	}
+	if *configPackage == "" {
+		*configPackage = recorded.ConfigPackage.ID
+	}
+
+	fmt.Printf("Verifying outputs for environment: %s\n", *envID)
+	drifts := map[string][]string{} // output path -> reasons
+	report := func(path, reason string) {
+		drifts[path] = append(drifts[path], reason)
+	}
+
+	// Hand edits: outputs on disk that no longer match their recorded checksum
+	edited, err := recorded.Modified(rt.RepoRoot)
+	if err != nil {
+		return fmt.Errorf("check outputs for edits: %w", err)
+	}
+	for _, change := range edited {
+		if change.Kind == metadata.ChangeDeleted {
+			report(change.Path, "deleted since generation")
+		} else {
+			report(change.Path, "edited by hand (checksum differs from metadata.json)")
+		}
+	}
+
+	// Stale outputs: regenerating from the current sources changes them
+	loader := config.NewLoader(rt.RepoRoot, *configPackage, *envID)
+	mergedConfig, err := loader.LoadAndMerge()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+	_, outputs, err := rt.renderOutputs(context.Background(), io.Discard, *envID, loader, mergedConfig, generateOptions{ConfigPackage: *configPackage, RenderCache: rt.renderCache()})
+	if err != nil {
+		return fmt.Errorf("regenerate outputs: %w", err)
+	}
+	current, err := outputs.records(rt.RepoRoot)
+	if err != nil {
+		return err
+	}
+
+	changedInputs, err := recorded.ChangedInputs(rt.RepoRoot)
+	if err != nil {
+		return fmt.Errorf("check inputs: %w", err)
+	}
+	cause := "the generator produces different content"
+	if len(changedInputs) > 0 {
+		paths := make([]string, len(changedInputs))
+		for i, change := range changedInputs {
+			paths[i] = change.Path
+		}
+		cause = "inputs changed: " + strings.Join(paths, ", ")
+	}
+
+	for name, file := range recorded.Files {
+		regenerated, ok := current[name]
+		switch {
+		case !ok:
+			report(file.Path, "stale, no longer generated ("+cause+")")
+		case regenerated.SHA256 != file.SHA256:
+			report(file.Path, "stale, "+cause)
+		}
+	}
+	for name, file := range current {
+		// The first generation has no hosts to plan operations against
+		if _, ok := recorded.Files[name]; !ok && name != "metadata" && name != "operations" {
+			report(file.Path, "missing, now generated ("+cause+")")
+		}
+	}
+
+	if len(drifts) == 0 {
+		fmt.Printf("✅ %d outputs match metadata.json and the current sources\n", len(recorded.Files))
+		return nil
+	}
+
+	paths := make([]string, 0, len(drifts))
+	for path := range drifts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Printf("  ✗ %s: %s\n", path, strings.Join(drifts[path], "; "))
+	}
+	fmt.Printf("\n%d output(s) drifted; run generate env (with --force to discard hand edits)\n", len(drifts))
+	return errOutputsDrifted
+}
@@ -0,0 +1,28 @@
+package commands
+
+import "runtime/debug"
+
+// Version is the CLI version recorded in metadata.json. Release builds set it
+// with -ldflags "-X pn-infra/api/internal/commands.Version=v1.2.3".
+var Version = ""
+
+// cliVersion returns Version, falling back to the version or VCS revision
+// recorded in the binary's build info
+func cliVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return "devel+" + setting.Value[:12]
+		}
+	}
+	return "devel"
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Wave returns the sync wave of the application, 0 when none is set
+func (a Application) Wave() int {
+	if a.SyncWave == nil {
+		return 0
+	}
+	return *a.SyncWave
+}
+
+// AppGraph is the dependency graph of the business applications, a DAG
+// whose edges run from each dependency to the applications depending on it
+type AppGraph struct {
+	Apps []AppNode // in apps.yaml order
+}
+
+// AppNode is an application of the graph with its resolved sync wave
+type AppNode struct {
+	Name         string
+	Enabled      bool
+	Dependencies []string
+	SyncWave     int
+	Derived      bool // SyncWave was derived from the dependencies
+}
+
+// BuildAppGraph checks that application dependencies name defined
+// applications and form no cycle, and resolves sync waves. An explicit
+// sync_wave must be greater than the waves of the application's
+// dependencies, so that they sync first; an omitted one is one more than
+// the highest of them, or 0 without dependencies.
+func BuildAppGraph(apps []Application) (*AppGraph, error) {
+	index := make(map[string]int, len(apps))
+	var errs []error
+	for i, app := range apps {
+		if app.Name == "" {
+			errs = append(errs, fmt.Errorf("application %d has no name", i+1))
+			continue
+		}
+		if _, dup := index[app.Name]; dup {
+			errs = append(errs, fmt.Errorf("application %s is defined twice", app.Name))
+			continue
+		}
+		index[app.Name] = i
+	}
+	for _, app := range apps {
+		for _, dependency := range app.Dependencies {
+			if _, ok := index[dependency]; !ok {
+				errs = append(errs, fmt.Errorf("application %s depends on unknown application %s", app.Name, dependency))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(apps))
+	nodes := make([]AppNode, len(apps))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		app := apps[i]
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			for start, name := range path {
+				if name == app.Name {
+					return fmt.Errorf("dependency cycle: %s", strings.Join(append(path[start:], app.Name), " -> "))
+				}
+			}
+		}
+		state[i] = visiting
+		path = append(path, app.Name)
+		for _, dependency := range app.Dependencies {
+			if err := visit(index[dependency]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+
+		node := AppNode{Name: app.Name, Enabled: app.Enabled, Dependencies: app.Dependencies}
+		if app.SyncWave != nil {
+			node.SyncWave = *app.SyncWave
+			for _, dependency := range app.Dependencies {
+				if wave := nodes[index[dependency]].SyncWave; wave >= node.SyncWave {
+					return fmt.Errorf("application %s has sync_wave %d but depends on %s at sync_wave %d; it must sync in a later wave",
+						app.Name, node.SyncWave, dependency, wave)
+				}
+			}
+		} else {
+			node.Derived = true
+			for j, dependency := range app.Dependencies {
+				if wave := nodes[index[dependency]].SyncWave + 1; j == 0 || wave > node.SyncWave {
+					node.SyncWave = wave
+				}
+			}
+		}
+		nodes[i] = node
+		state[i] = visited
+		return nil
+	}
+	for i := range apps {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return &AppGraph{Apps: nodes}, nil
+}
+
+// ResolveSyncWaves validates the application dependencies with
+// BuildAppGraph and sets the derived sync wave of every application that
+// sets none
+func ResolveSyncWaves(apps []Application) error {
+	graph, err := BuildAppGraph(apps)
+	if err != nil {
+		return err
+	}
+	for i, node := range graph.Apps {
+		if apps[i].SyncWave == nil {
+			wave := node.SyncWave
+			apps[i].SyncWave = &wave
+		}
+	}
+	return nil
+}
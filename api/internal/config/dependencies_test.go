@@ -0,0 +1,92 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func wave(n int) *int { return &n }
+
+func TestResolveSyncWavesDerivesOmittedWaves(t *testing.T) {
+	apps := []Application{
+		{Name: "frontend", Dependencies: []string{"api", "cache"}},
+		{Name: "api", Dependencies: []string{"db"}},
+		{Name: "db", SyncWave: wave(-2)},
+		{Name: "cache", SyncWave: wave(3)},
+		{Name: "docs"},
+	}
+	if err := ResolveSyncWaves(apps); err != nil {
+		t.Fatalf("ResolveSyncWaves: %v", err)
+	}
+	want := map[string]int{"frontend": 4, "api": -1, "db": -2, "cache": 3, "docs": 0}
+	for _, app := range apps {
+		if app.SyncWave == nil || *app.SyncWave != want[app.Name] {
+			t.Errorf("%s: sync wave %v, want %d", app.Name, app.SyncWave, want[app.Name])
+		}
+	}
+
+	graph, err := BuildAppGraph([]Application{{Name: "db", SyncWave: wave(0)}, {Name: "api", Dependencies: []string{"db"}}})
+	if err != nil {
+		t.Fatalf("BuildAppGraph: %v", err)
+	}
+	if graph.Apps[0].Derived || !graph.Apps[1].Derived {
+		t.Fatalf("expected only api to have a derived wave, got %+v", graph.Apps)
+	}
+}
+
+func TestBuildAppGraphRejectsInvalidDependencies(t *testing.T) {
+	tests := []struct {
+		name string
+		apps []Application
+		want []string
+	}{
+		{
+			name: "unknown dependencies",
+			apps: []Application{{Name: "api", Dependencies: []string{"db", "cache"}}},
+			want: []string{"application api depends on unknown application db", "application api depends on unknown application cache"},
+		},
+		{
+			name: "duplicate name",
+			apps: []Application{{Name: "api"}, {Name: "api"}},
+			want: []string{"application api is defined twice"},
+		},
+		{
+			name: "cycle",
+			apps: []Application{
+				{Name: "docs"},
+				{Name: "api", Dependencies: []string{"db"}},
+				{Name: "db", Dependencies: []string{"queue"}},
+				{Name: "queue", Dependencies: []string{"api"}},
+			},
+			want: []string{"dependency cycle: api -> db -> queue -> api"},
+		},
+		{
+			name: "self dependency",
+			apps: []Application{{Name: "api", Dependencies: []string{"api"}}},
+			want: []string{"dependency cycle: api -> api"},
+		},
+		{
+			name: "wave before dependency",
+			apps: []Application{{Name: "api", SyncWave: wave(1), Dependencies: []string{"db"}}, {Name: "db", SyncWave: wave(1)}},
+			want: []string{"application api has sync_wave 1 but depends on db at sync_wave 1"},
+		},
+		{
+			name: "wave before derived dependency",
+			apps: []Application{{Name: "db", SyncWave: wave(2)}, {Name: "api", Dependencies: []string{"db"}}, {Name: "web", SyncWave: wave(3), Dependencies: []string{"api"}}},
+			want: []string{"application web has sync_wave 3 but depends on api at sync_wave 3"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := BuildAppGraph(test.apps)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import "fmt"
+
+// Deployment methods of the platform and business modules (config.yaml
+// platform.deployment_method and business.deployment_method)
+const (
+	DeploymentHelm      = "helm"
+	DeploymentKustomize = "kustomize"
+	DeploymentArgoCD    = "argocd"
+)
+
+// Method returns the platform deployment method, helm when none is set
+func (d PlatformDeployment) Method() (string, error) {
+	return deploymentMethod("platform", d.DeploymentMethod, DeploymentHelm)
+}
+
+// Method returns the business deployment method, argocd when none is set
+func (d BusinessDeployment) Method() (string, error) {
+	return deploymentMethod("business", d.DeploymentMethod, DeploymentArgoCD)
+}
+
+func deploymentMethod(module, method, fallback string) (string, error) {
+	switch method {
+	case "":
+		return fallback, nil
+	case DeploymentHelm, DeploymentKustomize, DeploymentArgoCD:
+		return method, nil
+	}
+	return "", fmt.Errorf("unsupported %s deployment method: %s", module, method)
+}
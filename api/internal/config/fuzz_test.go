@@ -0,0 +1,190 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fuzzPackage is the smallest package that loads: a platform, an
+// orchestrator and an environment override of each kind
+var fuzzPackage = []string{
+	"version: v1.0.0\ninfrastructure:\n  platform: proxmox\n  provider: terraform\ncontainer_orchestration:\n  orchestrator: kubespray\n",
+	"hosts:\n  - name: node1\n    role: master\n    ip: 10.0.0.10\n    cpu: 2\n    memory: 4096\n    groups: [kube_control_plane, etcd, kube_node]\n",
+	"networks:\n  - name: management\n    cidr: 10.0.0.0/24\ndns:\n  domain: example.local\nntp:\n  servers: [pool.ntp.org]\n",
+	"proxmox:\n  node_name: pve\n  template:\n    id: 9000\n",
+	"kubespray:\n  kube_version: v1.28.3\n",
+	"ssh:\n  user: ops\n  port: 2222\nproxmox:\n  endpoint: https://pve:8006\n",
+	"cluster_overrides:\n  kube_proxy_mode: ipvs\n",
+}
+
+// writeFuzzPackage writes a package whose platform and orchestrator files
+// all hold the same content, so that config.yaml can choose any of them
+func writeFuzzPackage(t *testing.T, master, hosts, networks, platform, orchestrator, infraEnv, orchestrationEnv string) string {
+	t.Helper()
+	root := t.TempDir()
+	pkg := filepath.Join(root, "config", "packages", "fuzz")
+	files := map[string]string{
+		filepath.Join(pkg, "config.yaml"):                                           master,
+		filepath.Join(pkg, "hosts.yaml"):                                            hosts,
+		filepath.Join(pkg, "networks.yaml"):                                         networks,
+		filepath.Join(pkg, "platform", "stacks.yaml"):                               "stacks: {}\n",
+		filepath.Join(pkg, "business", "apps.yaml"):                                 "applications: []\n",
+		filepath.Join(root, "infrastructure", "environments", "fuzz.yaml"):          infraEnv,
+		filepath.Join(root, "container-orchestration", "environments", "fuzz.yaml"): orchestrationEnv,
+	}
+	for _, name := range Platforms() {
+		files[filepath.Join(pkg, "platforms", name+".yaml")] = platform
+	}
+	for _, name := range Orchestrators() {
+		files[filepath.Join(pkg, "orchestrators", name+".yaml")] = orchestrator
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+	return root
+}
+
+// FuzzLoadAndMerge loads generated packages. Loading must not panic, loading
+// the same files twice must give the same config or the same error, and an
+// override of the wrong type must be an error rather than a default.
+func FuzzLoadAndMerge(f *testing.F) {
+	f.Add(fuzzPackage[0], fuzzPackage[1], fuzzPackage[2], fuzzPackage[3], fuzzPackage[4], fuzzPackage[5], fuzzPackage[6])
+	f.Add("infrastructure:\n  platform: none\ncontainer_orchestration:\n  orchestrator: kind\n", "", "", "", "kind:\n  name: dev\n", "ssh: 22\n", "")
+	f.Add("infrastructure:\n  platform: aws\ncontainer_orchestration:\n  orchestrator: kubekey\n", "hosts: {}\n", "networks: 1\n", "aws: []\n", "kubekey: [1]\n", "ssh:\n  port: \"22\"\naws: 1\n", "cluster_overrides: []\n")
+	f.Add("infrastructure:\n  platform: gcp\ncontainer_orchestration:\n  orchestrator: kubespray\n", "~", "~", "~", "~", "~", "~")
+	f.Add("infrastructure:\n  platform: azure\n", "", "", "azure:\n  location: &a [*a]\n", "", "ssh:\n  port: 22.0\nazure: {location: 1}\n", "")
+	f.Add("infrastructure:\n  platform: gcp\n", "", "", "gcp:\n  project_id: p\n", "", "gcp:\n  credentials_json: {type: service_account}\n", "")
+
+	f.Fuzz(func(t *testing.T, master, hosts, networks, platform, orchestrator, infraEnv, orchestrationEnv string) {
+		root := writeFuzzPackage(t, master, hosts, networks, platform, orchestrator, infraEnv, orchestrationEnv)
+		first, firstErr := NewLoader(root, "fuzz", "fuzz").LoadAndMerge()
+		second, secondErr := NewLoader(root, "fuzz", "fuzz").LoadAndMerge()
+		if (firstErr == nil) != (secondErr == nil) || (firstErr != nil && firstErr.Error() != secondErr.Error()) {
+			t.Fatalf("loading twice gave different errors: %v, %v", firstErr, secondErr)
+		}
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("loading twice gave different configs:\n%#v\n%#v", first, second)
+		}
+		if firstErr != nil {
+			return
+		}
+		if field := mistypedField(first, orchestrator, infraEnv, orchestrationEnv); field != "" {
+			t.Fatalf("%s has the wrong type but loading succeeded", field)
+		}
+		// A loaded config may be invalid, which must be reported as an error
+		_ = ValidateProviders(first)
+		_, _ = ProviderArtifacts(first)
+	})
+}
+
+// platformStrings are the string overrides read from each platform section
+// of the infrastructure environment
+var platformStrings = map[string][]string{
+	"proxmox": {"endpoint", "api_token_id", "api_token_secret"},
+	"aws":     {"region", "access_key", "secret_key"},
+	"gcp":     {"region", "credentials_json"},
+	"azure":   {"location", "subscription_id", "client_id", "client_secret", "tenant_id"},
+}
+
+// mistypedField returns the first setting the loaded config reads from the
+// orchestrator file or the environment overrides that is present with the
+// wrong type, or "" when there is none
+func mistypedField(merged *MergedConfig, orchestratorFile, infraEnv, orchestrationEnv string) string {
+	parse := func(content string) map[string]interface{} {
+		var m map[string]interface{}
+		_ = yaml.Unmarshal([]byte(content), &m)
+		return m
+	}
+	isMap := func(v interface{}) bool {
+		_, ok := v.(map[string]interface{})
+		return v == nil || ok
+	}
+	isString := func(v interface{}) bool {
+		_, ok := v.(string)
+		return v == nil || ok
+	}
+
+	infra := parse(infraEnv)
+	if !isMap(infra["ssh"]) {
+		return "ssh"
+	}
+	if ssh, _ := infra["ssh"].(map[string]interface{}); ssh != nil {
+		for _, key := range []string{"user", "key_path", "public_key"} {
+			if !isString(ssh[key]) {
+				return "ssh." + key
+			}
+		}
+		if _, ok := ssh["port"].(int); !ok && ssh["port"] != nil {
+			return "ssh.port"
+		}
+	}
+	if platform := merged.Infrastructure.Platform; platform != "none" {
+		if !isMap(infra[platform]) {
+			return platform
+		}
+		section, _ := infra[platform].(map[string]interface{})
+		for _, key := range platformStrings[platform] {
+			if !isString(section[key]) {
+				return platform + "." + key
+			}
+		}
+	}
+	switch name := merged.ContainerOrchestration.Orchestrator; name {
+	case "kubespray":
+		if !isMap(parse(orchestrationEnv)["cluster_overrides"]) {
+			return "cluster_overrides"
+		}
+	case "kind", "kubekey":
+		if !isMap(parse(orchestratorFile)[name]) {
+			return name
+		}
+	}
+	return ""
+}
+
+func TestLoadAndMergeRejectsMistypedOverrides(t *testing.T) {
+	cases := map[string]string{
+		"ssh.port":         "ssh:\n  port: \"2222\"\n",
+		"ssh.port float":   "ssh:\n  port: 2222.0\n",
+		"ssh.user":         "ssh:\n  user: [ops]\n",
+		"ssh":              "ssh: 22\n",
+		"platform section": "ssh:\n  port: 2222\nproxmox: https://pve:8006\n",
+	}
+	for platform, keys := range platformStrings {
+		for _, key := range keys {
+			cases[platform+"."+key] = platform + ":\n  " + key + ": [x]\n"
+		}
+	}
+	for name, infraEnv := range cases {
+		t.Run(name, func(t *testing.T) {
+			platform := strings.SplitN(name, ".", 2)[0]
+			master := fuzzPackage[0]
+			if _, ok := platformStrings[platform]; ok {
+				master = strings.Replace(master, "platform: proxmox", "platform: "+platform, 1)
+			}
+			root := writeFuzzPackage(t, master, fuzzPackage[1], fuzzPackage[2], fuzzPackage[3], fuzzPackage[4], infraEnv, fuzzPackage[6])
+			if _, err := NewLoader(root, "fuzz", "fuzz").LoadAndMerge(); err == nil {
+				t.Fatalf("expected an error for %q", infraEnv)
+			}
+		})
+	}
+
+	root := writeFuzzPackage(t, fuzzPackage[0], fuzzPackage[1], fuzzPackage[2], fuzzPackage[3], fuzzPackage[4], fuzzPackage[5], fuzzPackage[6])
+	merged, err := NewLoader(root, "fuzz", "fuzz").LoadAndMerge()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if merged.SSH.Port != 2222 || merged.SSH.User != "ops" {
+		t.Fatalf("unexpected ssh config %+v", merged.SSH)
+	}
+}
@@ -13,6 +13,8 @@ type Loader struct {
 	RepoRoot      string
 	ConfigPackage string
 	Environment   string
+
+	inputs []string // files read, in load order
 }
 
 // NewLoader creates a new config loader
@@ -28,7 +30,7 @@ func NewLoader(repoRoot, configPackage, environment string) *Loader {
 func (l *Loader) LoadMasterConfig() (*MasterConfig, error) {
 	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "config.yaml")
 	var config MasterConfig
-	if err := readYAML(path, &config); err != nil {
+	if err := l.readYAML(path, &config); err != nil {
 		return nil, fmt.Errorf("load master config: %w", err)
 	}
 	return &config, nil
@@ -38,7 +40,7 @@ func (l *Loader) LoadMasterConfig() (*MasterConfig, error) {
 func (l *Loader) LoadHosts() (*HostsConfig, error) {
 	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "hosts.yaml")
 	var config HostsConfig
-	if err := readYAML(path, &config); err != nil {
+	if err := l.readYAML(path, &config); err != nil {
 		return nil, fmt.Errorf("load hosts config: %w", err)
 	}
 	return &config, nil
@@ -48,74 +50,39 @@ func (l *Loader) LoadHosts() (*HostsConfig, error) {
 func (l *Loader) LoadNetworks() (*NetworksConfig, error) {
 	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "networks.yaml")
 	var config NetworksConfig
-	if err := readYAML(path, &config); err != nil {
+	if err := l.readYAML(path, &config); err != nil {
 		return nil, fmt.Errorf("load networks config: %w", err)
 	}
 	return &config, nil
 }
 
-// LoadPlatformConfig loads platform-specific configuration based on master config
+// LoadPlatformConfig loads platform-specific configuration using the registered platform
 func (l *Loader) LoadPlatformConfig(platform string) (interface{}, error) {
-	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "platforms", fmt.Sprintf("%s.yaml", platform))
-
-	switch platform {
-	case "proxmox":
-		var config ProxmoxConfig
-		if err := readYAML(path, &config); err != nil {
-			return nil, fmt.Errorf("load proxmox config: %w", err)
-		}
-		return &config, nil
-	case "aws":
-		var config AWSConfig
-		if err := readYAML(path, &config); err != nil {
-			return nil, fmt.Errorf("load aws config: %w", err)
-		}
-		return &config, nil
-	case "gcp":
-		var config GCPConfig
-		if err := readYAML(path, &config); err != nil {
-			return nil, fmt.Errorf("load gcp config: %w", err)
-		}
-		return &config, nil
-	case "azure":
-		var config AzureConfig
-		if err := readYAML(path, &config); err != nil {
-			return nil, fmt.Errorf("load azure config: %w", err)
-		}
-		return &config, nil
-	default:
-		return nil, fmt.Errorf("unsupported platform: %s", platform)
+	provider, err := LookupPlatform(platform)
+	if err != nil {
+		return nil, err
 	}
+	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "platforms", fmt.Sprintf("%s.yaml", platform))
+	l.inputs = append(l.inputs, path)
+	return provider.Load(path)
 }
 
-// LoadOrchestratorConfig loads orchestrator-specific configuration
+// LoadOrchestratorConfig loads orchestrator-specific configuration using the registered orchestrator
 func (l *Loader) LoadOrchestratorConfig(orchestrator string) (interface{}, error) {
-	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "orchestrators", fmt.Sprintf("%s.yaml", orchestrator))
-
-	switch orchestrator {
-	case "kubespray":
-		var config KubesprayConfig
-		if err := readYAML(path, &config); err != nil {
-			return nil, fmt.Errorf("load kubespray config: %w", err)
-		}
-		return &config, nil
-	case "kubekey", "kind":
-		// Load as generic map for now (can be extended later)
-		var config map[string]interface{}
-		if err := readYAML(path, &config); err != nil {
-			return nil, fmt.Errorf("load %s config: %w", orchestrator, err)
-		}
-		return config, nil
-	default:
-		return nil, fmt.Errorf("unsupported orchestrator: %s", orchestrator)
+	provider, err := LookupOrchestrator(orchestrator)
+	if err != nil {
+		return nil, err
 	}
+	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "orchestrators", fmt.Sprintf("%s.yaml", orchestrator))
+	l.inputs = append(l.inputs, path)
+	return provider.Load(path)
 }
 
 // LoadPlatformStacks loads platform services configuration
 func (l *Loader) LoadPlatformStacks() (*PlatformConfig, error) {
 	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "platform", "stacks.yaml")
 	var config PlatformConfig
-	if err := readYAML(path, &config); err != nil {
+	if err := l.readYAML(path, &config); err != nil {
 		return nil, fmt.Errorf("load platform stacks: %w", err)
 	}
 	return &config, nil
@@ -125,7 +92,7 @@ func (l *Loader) LoadPlatformStacks() (*PlatformConfig, error) {
 func (l *Loader) LoadBusinessApps() (*BusinessConfig, error) {
 	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "business", "apps.yaml")
 	var config BusinessConfig
-	if err := readYAML(path, &config); err != nil {
+	if err := l.readYAML(path, &config); err != nil {
 		return nil, fmt.Errorf("load business apps: %w", err)
 	}
 	return &config, nil
@@ -142,7 +109,7 @@ func (l *Loader) LoadModuleEnv(module string) (map[string]interface{}, error) {
 	}
 
 	var config map[string]interface{}
-	if err := readYAML(path, &config); err != nil {
+	if err := l.readYAML(path, &config); err != nil {
 		return nil, fmt.Errorf("load module env %s: %w", module, err)
 	}
 	return config, nil
@@ -155,7 +122,12 @@ func (l *Loader) LoadAndMerge() (*MergedConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	return l.LoadAndMergeFor(masterConfig)
+}
 
+// LoadAndMergeFor loads and merges the configuration files for the platform
+// and orchestrator chosen in masterConfig instead of those in config.yaml
+func (l *Loader) LoadAndMergeFor(masterConfig *MasterConfig) (*MergedConfig, error) {
 	// 2. Load platform-agnostic configs
 	hostsConfig, err := l.LoadHosts()
 	if err != nil {
@@ -189,11 +161,14 @@ func (l *Loader) LoadAndMerge() (*MergedConfig, error) {
 		return nil, err
 	}
 
-	// 6. Load business apps
+	// 6. Load business apps and resolve their sync waves
 	businessApps, err := l.LoadBusinessApps()
 	if err != nil {
 		return nil, err
 	}
+	if err := ResolveSyncWaves(businessApps.Applications); err != nil {
+		return nil, fmt.Errorf("load business apps: %w", err)
+	}
 
 	// 7. Load environment overrides
 	infraEnv, err := l.LoadModuleEnv("infrastructure")
@@ -206,7 +181,29 @@ func (l *Loader) LoadAndMerge() (*MergedConfig, error) {
 		return nil, err
 	}
 
+	platformEnv, err := l.LoadModuleEnv("platform")
+	if err != nil {
+		return nil, err
+	}
+
+	businessEnv, err := l.LoadModuleEnv("business")
+	if err != nil {
+		return nil, err
+	}
+
 	// 8. Build merged config
+	global, err := getMap(businessEnv, "global")
+	if err != nil {
+		return nil, fmt.Errorf("load module env business: %w", err)
+	}
+	namespaceConfigs, err := getMap(businessEnv, "namespace_configs")
+	if err != nil {
+		return nil, fmt.Errorf("load module env business: %w", err)
+	}
+	appOverrides, err := getMap(businessEnv, "app_overrides")
+	if err != nil {
+		return nil, fmt.Errorf("load module env business: %w", err)
+	}
 	merged := &MergedConfig{
 		ConfigPackage:          l.ConfigPackage,
 		Environment:            l.Environment,
@@ -219,85 +216,68 @@ func (l *Loader) LoadAndMerge() (*MergedConfig, error) {
 		ContainerOrchestration: masterConfig.ContainerOrchestration,
 		Stacks:                 platformStacks.Stacks,
 		Applications:           businessApps.Applications,
+		PlatformOverrides:      platformEnv,
+		Global:                 global,
+		NamespaceConfigs:       namespaceConfigs,
+		AppOverrides:           appOverrides,
+	}
+
+	// Decode business.argocd before its overrides rather than copying it, so
+	// that overrides do not write through its pointers into the master config
+	for _, layer := range []interface{}{masterConfig.Business.ArgoCD, businessEnv["argocd"]} {
+		if layer == nil {
+			continue
+		}
+		if err := decodeOverrides(layer, &merged.ArgoCD); err != nil {
+			return nil, fmt.Errorf("merge business argocd overrides: %w", err)
+		}
 	}
 
 	// Extract SSH config from infrastructure environment
-	if sshData, ok := infraEnv["ssh"].(map[string]interface{}); ok {
-		merged.SSH = SSHConfig{
-			User:      getStringOrDefault(sshData, "user", "ansible"),
-			Port:      getIntOrDefault(sshData, "port", 22),
-			KeyPath:   getStringOrDefault(sshData, "key_path", ""),
-			PublicKey: getStringOrDefault(sshData, "public_key", ""),
+	sshData, err := getMap(infraEnv, "ssh")
+	if err != nil {
+		return nil, fmt.Errorf("load module env infrastructure: %w", err)
+	}
+	if sshData != nil {
+		if merged.SSH, err = sshConfig(sshData); err != nil {
+			return nil, fmt.Errorf("load module env infrastructure: ssh: %w", err)
 		}
 	}
 
 	// Populate platform-specific config (skip if platform is "none")
 	if platformConfig != nil {
-		switch masterConfig.Infrastructure.Platform {
-		case "proxmox":
-			if cfg, ok := platformConfig.(*ProxmoxConfig); ok {
-				merged.Proxmox = &cfg.Proxmox
-				// Apply environment overrides
-				if proxmoxEnv, ok := infraEnv["proxmox"].(map[string]interface{}); ok {
-					applyProxmoxOverrides(merged.Proxmox, proxmoxEnv)
-				}
-			}
-		case "aws":
-			if cfg, ok := platformConfig.(*AWSConfig); ok {
-				merged.AWS = &cfg.AWS
-				// Apply environment overrides
-				if awsEnv, ok := infraEnv["aws"].(map[string]interface{}); ok {
-					applyAWSOverrides(merged.AWS, awsEnv)
-				}
-			}
-		case "gcp":
-			if cfg, ok := platformConfig.(*GCPConfig); ok {
-				merged.GCP = &cfg.GCP
-				// Apply environment overrides
-				if gcpEnv, ok := infraEnv["gcp"].(map[string]interface{}); ok {
-					applyGCPOverrides(merged.GCP, gcpEnv)
-				}
-			}
-		case "azure":
-			if cfg, ok := platformConfig.(*AzureConfig); ok {
-				merged.Azure = &cfg.Azure
-				// Apply environment overrides
-				if azureEnv, ok := infraEnv["azure"].(map[string]interface{}); ok {
-					applyAzureOverrides(merged.Azure, azureEnv)
-				}
-			}
+		platform, err := LookupPlatform(masterConfig.Infrastructure.Platform)
+		if err != nil {
+			return nil, err
+		}
+		if err := platform.Merge(merged, platformConfig, infraEnv); err != nil {
+			return nil, fmt.Errorf("merge platform config: %w", err)
 		}
 	}
 
 	// Populate orchestrator-specific config
-	switch masterConfig.ContainerOrchestration.Orchestrator {
-	case "kubespray":
-		if cfg, ok := orchestratorConfig.(*KubesprayConfig); ok {
-			merged.Kubespray = &cfg.Kubespray
-			// Apply cluster overrides from environment
-			if clusterOverrides, ok := orchestrationEnv["cluster_overrides"].(map[string]interface{}); ok {
-				merged.ClusterOverrides = clusterOverrides
-			}
-		}
-	case "kind":
-		if cfg, ok := orchestratorConfig.(map[string]interface{}); ok {
-			// Extract the "kind" key from the loaded map
-			if kindCfg, ok := cfg["kind"].(map[string]interface{}); ok {
-				merged.Kind = kindCfg
-			}
-		}
-	case "kubekey":
-		if cfg, ok := orchestratorConfig.(map[string]interface{}); ok {
-			// Extract the "kubekey" key from the loaded map
-			if kubekeyCfg, ok := cfg["kubekey"].(map[string]interface{}); ok {
-				merged.Kubekey = kubekeyCfg
-			}
-		}
+	orchestrator, err := LookupOrchestrator(masterConfig.ContainerOrchestration.Orchestrator)
+	if err != nil {
+		return nil, err
+	}
+	if err := orchestrator.Merge(merged, orchestratorConfig, orchestrationEnv); err != nil {
+		return nil, fmt.Errorf("merge orchestrator config: %w", err)
 	}
 
 	return merged, nil
 }
 
+// Inputs returns the configuration files read so far, in load order
+func (l *Loader) Inputs() []string {
+	return append([]string(nil), l.inputs...)
+}
+
+// readYAML reads a YAML file and records it as an input
+func (l *Loader) readYAML(path string, target interface{}) error {
+	l.inputs = append(l.inputs, path)
+	return readYAML(path, target)
+}
+
 // readYAML reads and unmarshals a YAML file
 func readYAML(path string, target interface{}) error {
 	data, err := os.ReadFile(path)
@@ -312,43 +292,131 @@ func readYAML(path string, target interface{}) error {
 	return nil
 }
 
-// Helper functions to extract values from maps
-func getStringOrDefault(m map[string]interface{}, key, defaultVal string) string {
-	if val, ok := m[key].(string); ok {
-		return val
+// decodeOverrides decodes environment overrides onto target, keeping the
+// fields they do not set
+func decodeOverrides(overrides interface{}, target interface{}) error {
+	data, err := yaml.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, target)
+}
+
+// sshConfig reads the ssh section of the infrastructure environment
+func sshConfig(m map[string]interface{}) (SSHConfig, error) {
+	var ssh SSHConfig
+	var err error
+	if ssh.User, err = getString(m, "user", "ansible"); err != nil {
+		return SSHConfig{}, err
+	}
+	if ssh.Port, err = getInt(m, "port", 22); err != nil {
+		return SSHConfig{}, err
+	}
+	if ssh.KeyPath, err = getString(m, "key_path", ""); err != nil {
+		return SSHConfig{}, err
+	}
+	if ssh.PublicKey, err = getString(m, "public_key", ""); err != nil {
+		return SSHConfig{}, err
+	}
+	return ssh, nil
+}
+
+// The get functions below read environment overrides: an absent or null key
+// gives the default, while a value of another type is an error rather than
+// silently falling back to it
+
+func getString(m map[string]interface{}, key, defaultVal string) (string, error) {
+	switch val := m[key].(type) {
+	case nil:
+		return defaultVal, nil
+	case string:
+		return val, nil
+	default:
+		return "", fmt.Errorf("%s must be a string, got %T %v", key, val, val)
+	}
+}
+
+func getInt(m map[string]interface{}, key string, defaultVal int) (int, error) {
+	switch val := m[key].(type) {
+	case nil:
+		return defaultVal, nil
+	case int:
+		return val, nil
+	default:
+		return 0, fmt.Errorf("%s must be an integer, got %T %v", key, val, val)
 	}
-	return defaultVal
 }
 
-func getIntOrDefault(m map[string]interface{}, key string, defaultVal int) int {
-	if val, ok := m[key].(int); ok {
-		return val
+func getMap(m map[string]interface{}, key string) (map[string]interface{}, error) {
+	switch val := m[key].(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return val, nil
+	default:
+		return nil, fmt.Errorf("%s must be a mapping, got %T %v", key, val, val)
 	}
-	return defaultVal
 }
 
-// Apply environment overrides (simple implementation - can be enhanced)
-func applyProxmoxOverrides(config *ProxmoxSettings, overrides map[string]interface{}) {
-	if endpoint, ok := overrides["endpoint"].(string); ok {
-		// Store in a separate field or handle differently
-		_ = endpoint // Endpoint should be in environment override, not base config
+// overrideStrings reads the string overrides named by keys, "" when unset
+func overrideStrings(overrides map[string]interface{}, keys ...string) (map[string]string, error) {
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, err := getString(overrides, key, "")
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
 	}
+	return values, nil
 }
 
-func applyAWSOverrides(config *AWSSettings, overrides map[string]interface{}) {
-	if region, ok := overrides["region"].(string); ok && region != "" {
+// Apply environment overrides. Credentials stay in the overrides map, where
+// the templates and tfvars builders read them, but are type-checked here so
+// that a mistyped value fails the load rather than rendering as "".
+func applyProxmoxOverrides(config *ProxmoxSettings, overrides map[string]interface{}) error {
+	_, err := overrideStrings(overrides, "endpoint", "api_token_id", "api_token_secret")
+	return err
+}
+
+func applyAWSOverrides(config *AWSSettings, overrides map[string]interface{}) error {
+	if _, err := overrideStrings(overrides, "access_key", "secret_key"); err != nil {
+		return err
+	}
+	region, err := getString(overrides, "region", "")
+	if err != nil {
+		return err
+	}
+	if region != "" {
 		config.Region = region
 	}
+	return nil
 }
 
-func applyGCPOverrides(config *GCPSettings, overrides map[string]interface{}) {
-	if region, ok := overrides["region"].(string); ok && region != "" {
+func applyGCPOverrides(config *GCPSettings, overrides map[string]interface{}) error {
+	if _, err := overrideStrings(overrides, "credentials_json"); err != nil {
+		return err
+	}
+	region, err := getString(overrides, "region", "")
+	if err != nil {
+		return err
+	}
+	if region != "" {
 		config.Region = region
 	}
+	return nil
 }
 
-func applyAzureOverrides(config *AzureSettings, overrides map[string]interface{}) {
-	if location, ok := overrides["location"].(string); ok && location != "" {
+func applyAzureOverrides(config *AzureSettings, overrides map[string]interface{}) error {
+	if _, err := overrideStrings(overrides, "subscription_id", "client_id", "client_secret", "tenant_id"); err != nil {
+		return err
+	}
+	location, err := getString(overrides, "location", "")
+	if err != nil {
+		return err
+	}
+	if location != "" {
 		config.Location = location
 	}
+	return nil
 }
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PackageManifest is the package.json manifest of a config package
+type PackageManifest struct {
+	ID          string `json:"id"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// LoadPackageManifest loads the config package's package.json. It returns
+// nil without error when the package has no manifest.
+func (l *Loader) LoadPackageManifest() (*PackageManifest, error) {
+	path := filepath.Join(l.RepoRoot, "config", "packages", l.ConfigPackage, "package.json")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", path, err)
+	}
+	l.inputs = append(l.inputs, path)
+
+	var manifest PackageManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse package manifest %s: %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// PackageVersion returns the config package version from package.json,
+// falling back to the version declared in config.yaml
+func (l *Loader) PackageVersion(master *MasterConfig) (string, error) {
+	manifest, err := l.LoadPackageManifest()
+	if err != nil {
+		return "", err
+	}
+	if manifest != nil && manifest.Version != "" {
+		return manifest.Version, nil
+	}
+	return master.Version, nil
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+func init() {
+	RegisterOrchestrator(kubesprayOrchestrator{})
+	RegisterOrchestrator(kubekeyOrchestrator{})
+	RegisterOrchestrator(kindOrchestrator{})
+}
+
+// Kubespray
+
+type kubesprayOrchestrator struct{}
+
+func (kubesprayOrchestrator) Name() string { return "kubespray" }
+
+func (kubesprayOrchestrator) Load(path string) (interface{}, error) {
+	var config KubesprayConfig
+	if err := readYAML(path, &config); err != nil {
+		return nil, fmt.Errorf("load kubespray config: %w", err)
+	}
+	return &config, nil
+}
+
+func (kubesprayOrchestrator) Merge(merged *MergedConfig, settings interface{}, env map[string]interface{}) error {
+	cfg, ok := settings.(*KubesprayConfig)
+	if !ok {
+		return fmt.Errorf("kubespray: unexpected settings type %T", settings)
+	}
+	merged.Kubespray = &cfg.Kubespray
+	// Apply cluster overrides from environment
+	clusterOverrides, err := getMap(env, "cluster_overrides")
+	if err != nil {
+		return err
+	}
+	merged.ClusterOverrides = clusterOverrides
+	return nil
+}
+
+func (kubesprayOrchestrator) Validate(merged *MergedConfig) error {
+	var controlPlane, etcd int
+	for _, host := range merged.Hosts {
+		for _, group := range host.Groups {
+			switch group {
+			case "kube_control_plane":
+				controlPlane++
+			case "etcd":
+				etcd++
+			}
+		}
+	}
+	if controlPlane == 0 {
+		return errors.New("kubespray: at least one host must be in the kube_control_plane group")
+	}
+	if etcd == 0 {
+		return errors.New("kubespray: at least one host must be in the etcd group")
+	}
+	return nil
+}
+
+func (kubesprayOrchestrator) Templates() []TemplateSpec {
+	dir := filepath.Join("container-orchestration", "kubespray")
+	return []TemplateSpec{
+		{
+			Name:     "inventory",
+			Template: filepath.Join(dir, "inventory.ini.tmpl"),
+			Output:   filepath.Join("kubespray", "inventory.ini"),
+		},
+		{
+			Name:     "group_vars_all",
+			Template: filepath.Join(dir, "group_vars", "all.yaml.tmpl"),
+			Output:   filepath.Join("kubespray", "group_vars", "all.yaml"),
+		},
+		{
+			Name:     "group_vars_k8s_cluster",
+			Template: filepath.Join(dir, "group_vars", "k8s_cluster.yaml.tmpl"),
+			Output:   filepath.Join("kubespray", "group_vars", "k8s_cluster.yaml"),
+		},
+	}
+}
+
+// Artifacts emits kubesprayConfig.json, consumed by the Docker-based
+// kubespray.sh wrapper
+func (kubesprayOrchestrator) Artifacts(merged *MergedConfig) ([]Artifact, error) {
+	return []Artifact{{
+		Name:   "kubesprayConfig",
+		Output: "kubesprayConfig.json",
+		Data: map[string]interface{}{
+			"image": map[string]string{
+				"registry": "quay.io",
+				"version":  "v2.28.1",
+			},
+			"ssh": map[string]interface{}{
+				"keyPath": merged.SSH.KeyPath,
+				"user":    merged.SSH.User,
+				"port":    merged.SSH.Port,
+			},
+		},
+	}}, nil
+}
+
+// Kubekey
+
+type kubekeyOrchestrator struct{}
+
+func (kubekeyOrchestrator) Name() string { return "kubekey" }
+
+func (kubekeyOrchestrator) Load(path string) (interface{}, error) {
+	// Load as generic map for now (can be extended later)
+	var config map[string]interface{}
+	if err := readYAML(path, &config); err != nil {
+		return nil, fmt.Errorf("load kubekey config: %w", err)
+	}
+	return config, nil
+}
+
+func (kubekeyOrchestrator) Merge(merged *MergedConfig, settings interface{}, _ map[string]interface{}) error {
+	cfg, ok := settings.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("kubekey: unexpected settings type %T", settings)
+	}
+	// Extract the "kubekey" key from the loaded map
+	kubekeyCfg, err := getMap(cfg, "kubekey")
+	if err != nil {
+		return err
+	}
+	merged.Kubekey = kubekeyCfg
+	return nil
+}
+
+func (kubekeyOrchestrator) Validate(*MergedConfig) error { return nil }
+
+func (kubekeyOrchestrator) Templates() []TemplateSpec {
+	return []TemplateSpec{{
+		Name:     "config",
+		Template: filepath.Join("container-orchestration", "kubekey", "config.yaml.tmpl"),
+		Output:   filepath.Join("kubekey", "config.yaml"),
+	}}
+}
+
+func (kubekeyOrchestrator) Artifacts(*MergedConfig) ([]Artifact, error) { return nil, nil }
+
+// Kind
+
+type kindOrchestrator struct{}
+
+func (kindOrchestrator) Name() string { return "kind" }
+
+func (kindOrchestrator) Load(path string) (interface{}, error) {
+	var config map[string]interface{}
+	if err := readYAML(path, &config); err != nil {
+		return nil, fmt.Errorf("load kind config: %w", err)
+	}
+	return config, nil
+}
+
+func (kindOrchestrator) Merge(merged *MergedConfig, settings interface{}, _ map[string]interface{}) error {
+	cfg, ok := settings.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("kind: unexpected settings type %T", settings)
+	}
+	// Extract the "kind" key from the loaded map
+	kindCfg, err := getMap(cfg, "kind")
+	if err != nil {
+		return err
+	}
+	merged.Kind = kindCfg
+	return nil
+}
+
+func (kindOrchestrator) Validate(*MergedConfig) error { return nil }
+
+func (kindOrchestrator) Templates() []TemplateSpec {
+	return []TemplateSpec{{
+		Name:     "config",
+		Template: filepath.Join("container-orchestration", "kind", "config-simple.yaml.tmpl"),
+		Output:   filepath.Join("kind", "config.yaml"),
+	}}
+}
+
+func (kindOrchestrator) Artifacts(*MergedConfig) ([]Artifact, error) { return nil, nil }
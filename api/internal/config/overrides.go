@@ -0,0 +1,124 @@
+package config
+
+import "fmt"
+
+// AppOverride is an application's entry in app_overrides of
+// business/environments/<env>.yaml
+type AppOverride struct {
+	Enabled   *bool
+	Namespace string
+	Values    map[string]interface{} // every other key, merged into Helm values
+
+	// Image and Replicas are read from Values for sources that are not
+	// rendered from Helm values
+	Image    *ImageOverride
+	Replicas *int
+}
+
+// ImageOverride replaces the registry or tag of the image named by its
+// repository
+type ImageOverride struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// NewName returns the image name with the registry prepended, or "" when
+// the registry is kept
+func (i ImageOverride) NewName() string {
+	if i.Registry == "" {
+		return ""
+	}
+	return i.Registry + "/" + i.Repository
+}
+
+// AppOverride returns the app_overrides entry of an application; an
+// application without one gets the zero AppOverride
+func (m *MergedConfig) AppOverride(name string) (AppOverride, error) {
+	var override AppOverride
+	entry, err := getMap(m.AppOverrides, name)
+	if err != nil {
+		return override, fmt.Errorf("app_overrides.%w", err)
+	}
+	for key, value := range entry {
+		switch key {
+		case "enabled":
+			if value == nil {
+				continue
+			}
+			enabled, ok := value.(bool)
+			if !ok {
+				return override, fmt.Errorf("app_overrides.%s.enabled must be a boolean, got %T %v", name, value, value)
+			}
+			override.Enabled = &enabled
+		case "namespace":
+			if override.Namespace, err = getString(entry, key, ""); err != nil {
+				return override, fmt.Errorf("app_overrides.%s.%w", name, err)
+			}
+		default:
+			if override.Values == nil {
+				override.Values = map[string]interface{}{}
+			}
+			override.Values[key] = value
+		}
+	}
+
+	if override.Values["replicas"] != nil {
+		replicas, err := getInt(override.Values, "replicas", 0)
+		if err != nil {
+			return override, fmt.Errorf("app_overrides.%s.%w", name, err)
+		}
+		override.Replicas = &replicas
+	}
+	image, err := getMap(override.Values, "image")
+	if err != nil {
+		return override, fmt.Errorf("app_overrides.%s.%w", name, err)
+	}
+	if repository, _ := image["repository"].(string); repository != "" {
+		registry, _ := image["registry"].(string)
+		tag, _ := image["tag"].(string)
+		override.Image = &ImageOverride{Registry: registry, Repository: repository, Tag: tag}
+	}
+	return override, nil
+}
+
+// ResolveApplication returns app with its app_overrides entry applied:
+// enabled and namespace replace the application's, and the other keys are
+// merged into its values. Generators resolve applications through it so
+// that every deployment method honours the same overrides.
+func (m *MergedConfig) ResolveApplication(app Application) (Application, AppOverride, error) {
+	override, err := m.AppOverride(app.Name)
+	if err != nil {
+		return app, override, err
+	}
+	if override.Enabled != nil {
+		app.Enabled = *override.Enabled
+	}
+	if override.Namespace != "" {
+		app.Namespace = override.Namespace
+	}
+	app.Values = MergeValues(app.Values, override.Values)
+	return app, override, nil
+}
+
+// MergeValues returns base with overrides merged in; nested maps are merged
+// key by key and other values replaced. Neither argument is modified.
+func MergeValues(base, overrides map[string]interface{}) map[string]interface{} {
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := make(map[string]interface{}, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		baseMap, baseOK := merged[key].(map[string]interface{})
+		overrideMap, overrideOK := value.(map[string]interface{})
+		if baseOK && overrideOK {
+			merged[key] = MergeValues(baseMap, overrideMap)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
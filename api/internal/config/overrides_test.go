@@ -0,0 +1,59 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveApplicationAppliesAppOverrides(t *testing.T) {
+	merged := &MergedConfig{AppOverrides: map[string]interface{}{
+		"docs": map[string]interface{}{
+			"enabled":   false,
+			"namespace": "docs-staging",
+			"replicas":  3,
+			"image":     map[string]interface{}{"registry": "registry.local", "repository": "docs", "tag": "1.25"},
+		},
+	}}
+	values := map[string]interface{}{"replicas": 1, "image": map[string]interface{}{"repository": "docs", "pullPolicy": "Always"}}
+	app, override, err := merged.ResolveApplication(Application{Name: "docs", Enabled: true, Namespace: "docs", Values: values})
+	if err != nil {
+		t.Fatalf("ResolveApplication: %v", err)
+	}
+	if app.Enabled || app.Namespace != "docs-staging" {
+		t.Fatalf("enabled and namespace not overridden: %+v", app)
+	}
+	wantValues := map[string]interface{}{"replicas": 3, "image": map[string]interface{}{"registry": "registry.local", "repository": "docs", "pullPolicy": "Always", "tag": "1.25"}}
+	if !reflect.DeepEqual(app.Values, wantValues) {
+		t.Fatalf("values = %+v, want %+v", app.Values, wantValues)
+	}
+	if values["replicas"] != 1 {
+		t.Fatalf("the application's values were modified: %+v", values)
+	}
+	if override.Replicas == nil || *override.Replicas != 3 || override.Image == nil || override.Image.NewName() != "registry.local/docs" {
+		t.Fatalf("unexpected workload overrides %+v", override)
+	}
+
+	// Applications without an override are unchanged
+	unchanged, _, err := merged.ResolveApplication(Application{Name: "api", Enabled: true, Namespace: "apps"})
+	if err != nil || !unchanged.Enabled || unchanged.Namespace != "apps" || unchanged.Values != nil {
+		t.Fatalf("expected api unchanged, got %+v (%v)", unchanged, err)
+	}
+
+	tests := []struct {
+		entry interface{}
+		want  string
+	}{
+		{map[string]interface{}{"enabled": "yes"}, "app_overrides.docs.enabled must be a boolean"},
+		{map[string]interface{}{"namespace": 1}, "app_overrides.docs.namespace must be a string"},
+		{map[string]interface{}{"replicas": "two"}, "app_overrides.docs.replicas must be an integer"},
+		{map[string]interface{}{"image": "nginx"}, "app_overrides.docs.image must be a mapping"},
+		{"disabled", "app_overrides.docs must be a mapping"},
+	}
+	for _, test := range tests {
+		merged := &MergedConfig{AppOverrides: map[string]interface{}{"docs": test.entry}}
+		if _, _, err := merged.ResolveApplication(Application{Name: "docs"}); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: expected an error containing %q, got %v", test.entry, test.want, err)
+		}
+	}
+}
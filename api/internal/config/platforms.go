@@ -0,0 +1,270 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+func init() {
+	RegisterPlatform(proxmoxPlatform{})
+	RegisterPlatform(awsPlatform{})
+	RegisterPlatform(gcpPlatform{})
+	RegisterPlatform(azurePlatform{})
+}
+
+// infrastructureTemplates returns the infrastructure templates shared by every
+// platform for the given infrastructure provider. Terraform variables in json
+// format are not templated; they are emitted by terraformVariablesArtifacts.
+func infrastructureTemplates(platform string, infra InfrastructureChoice) ([]TemplateSpec, error) {
+	provider := infra.Provider
+	switch provider {
+	case "terraform":
+		switch infra.Format {
+		case "", TerraformFormatHCL:
+		case TerraformFormatJSON:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("unsupported terraform variables format: %s", infra.Format)
+		}
+		return []TemplateSpec{{
+			Name:     "infrastructure",
+			Template: filepath.Join("infrastructure", platform, provider, "terraform.tfvars.tmpl"),
+			Output:   "terraform.tfvars",
+		}}, nil
+	case "pulumi":
+		return []TemplateSpec{{
+			Name:     "infrastructure",
+			Template: filepath.Join("infrastructure", platform, provider, "Pulumi.stack.yaml.tmpl"),
+			Output:   "Pulumi." + EnvironmentPlaceholder + ".yaml",
+		}}, nil
+	default:
+		return nil, fmt.Errorf("platform %s does not support provider %s", platform, provider)
+	}
+}
+
+// Proxmox
+
+type proxmoxPlatform struct{}
+
+func (proxmoxPlatform) Name() string { return "proxmox" }
+
+func (proxmoxPlatform) Load(path string) (interface{}, error) {
+	var config ProxmoxConfig
+	if err := readYAML(path, &config); err != nil {
+		return nil, fmt.Errorf("load proxmox config: %w", err)
+	}
+	return &config, nil
+}
+
+func (proxmoxPlatform) Merge(merged *MergedConfig, settings interface{}, env map[string]interface{}) error {
+	cfg, ok := settings.(*ProxmoxConfig)
+	if !ok {
+		return fmt.Errorf("proxmox: unexpected settings type %T", settings)
+	}
+	merged.Proxmox = &cfg.Proxmox
+	proxmoxEnv, err := getMap(env, "proxmox")
+	if err != nil {
+		return err
+	}
+	if proxmoxEnv != nil {
+		merged.InfrastructureOverrides = proxmoxEnv
+		if err := applyProxmoxOverrides(merged.Proxmox, proxmoxEnv); err != nil {
+			return fmt.Errorf("proxmox.%w", err)
+		}
+	}
+	return nil
+}
+
+func (proxmoxPlatform) Validate(merged *MergedConfig) error {
+	if merged.Proxmox == nil || merged.Proxmox.NodeName == "" {
+		return errors.New("proxmox: node_name is required")
+	}
+	return nil
+}
+
+func (proxmoxPlatform) Artifacts(merged *MergedConfig) ([]Artifact, error) {
+	if !terraformJSON(merged.Infrastructure) {
+		return nil, nil
+	}
+	vars, err := newProxmoxVariables(merged)
+	if err != nil {
+		return nil, fmt.Errorf("proxmox.%w", err)
+	}
+	return terraformVariablesArtifacts(vars), nil
+}
+
+func (proxmoxPlatform) Templates(infra InfrastructureChoice) ([]TemplateSpec, error) {
+	return infrastructureTemplates("proxmox", infra)
+}
+
+// AWS
+
+type awsPlatform struct{}
+
+func (awsPlatform) Name() string { return "aws" }
+
+func (awsPlatform) Load(path string) (interface{}, error) {
+	var config AWSConfig
+	if err := readYAML(path, &config); err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+	return &config, nil
+}
+
+func (awsPlatform) Merge(merged *MergedConfig, settings interface{}, env map[string]interface{}) error {
+	cfg, ok := settings.(*AWSConfig)
+	if !ok {
+		return fmt.Errorf("aws: unexpected settings type %T", settings)
+	}
+	merged.AWS = &cfg.AWS
+	awsEnv, err := getMap(env, "aws")
+	if err != nil {
+		return err
+	}
+	if awsEnv != nil {
+		merged.InfrastructureOverrides = awsEnv
+		if err := applyAWSOverrides(merged.AWS, awsEnv); err != nil {
+			return fmt.Errorf("aws.%w", err)
+		}
+	}
+	return nil
+}
+
+func (awsPlatform) Validate(merged *MergedConfig) error {
+	if merged.AWS == nil || merged.AWS.Region == "" {
+		return errors.New("aws: region is required")
+	}
+	return nil
+}
+
+func (awsPlatform) Artifacts(merged *MergedConfig) ([]Artifact, error) {
+	if !terraformJSON(merged.Infrastructure) {
+		return nil, nil
+	}
+	vars, err := newAWSVariables(merged)
+	if err != nil {
+		return nil, fmt.Errorf("aws.%w", err)
+	}
+	return terraformVariablesArtifacts(vars), nil
+}
+
+func (awsPlatform) Templates(infra InfrastructureChoice) ([]TemplateSpec, error) {
+	return infrastructureTemplates("aws", infra)
+}
+
+// GCP
+
+type gcpPlatform struct{}
+
+func (gcpPlatform) Name() string { return "gcp" }
+
+func (gcpPlatform) Load(path string) (interface{}, error) {
+	var config GCPConfig
+	if err := readYAML(path, &config); err != nil {
+		return nil, fmt.Errorf("load gcp config: %w", err)
+	}
+	return &config, nil
+}
+
+func (gcpPlatform) Merge(merged *MergedConfig, settings interface{}, env map[string]interface{}) error {
+	cfg, ok := settings.(*GCPConfig)
+	if !ok {
+		return fmt.Errorf("gcp: unexpected settings type %T", settings)
+	}
+	merged.GCP = &cfg.GCP
+	gcpEnv, err := getMap(env, "gcp")
+	if err != nil {
+		return err
+	}
+	if gcpEnv != nil {
+		merged.InfrastructureOverrides = gcpEnv
+		if err := applyGCPOverrides(merged.GCP, gcpEnv); err != nil {
+			return fmt.Errorf("gcp.%w", err)
+		}
+	}
+	return nil
+}
+
+func (gcpPlatform) Validate(merged *MergedConfig) error {
+	if merged.GCP == nil || merged.GCP.ProjectID == "" {
+		return errors.New("gcp: project_id is required")
+	}
+	if merged.GCP.Region == "" {
+		return errors.New("gcp: region is required")
+	}
+	return nil
+}
+
+func (gcpPlatform) Artifacts(merged *MergedConfig) ([]Artifact, error) {
+	if !terraformJSON(merged.Infrastructure) {
+		return nil, nil
+	}
+	vars, err := newGCPVariables(merged)
+	if err != nil {
+		return nil, fmt.Errorf("gcp.%w", err)
+	}
+	return terraformVariablesArtifacts(vars), nil
+}
+
+func (gcpPlatform) Templates(infra InfrastructureChoice) ([]TemplateSpec, error) {
+	return infrastructureTemplates("gcp", infra)
+}
+
+// Azure
+
+type azurePlatform struct{}
+
+func (azurePlatform) Name() string { return "azure" }
+
+func (azurePlatform) Load(path string) (interface{}, error) {
+	var config AzureConfig
+	if err := readYAML(path, &config); err != nil {
+		return nil, fmt.Errorf("load azure config: %w", err)
+	}
+	return &config, nil
+}
+
+func (azurePlatform) Merge(merged *MergedConfig, settings interface{}, env map[string]interface{}) error {
+	cfg, ok := settings.(*AzureConfig)
+	if !ok {
+		return fmt.Errorf("azure: unexpected settings type %T", settings)
+	}
+	merged.Azure = &cfg.Azure
+	azureEnv, err := getMap(env, "azure")
+	if err != nil {
+		return err
+	}
+	if azureEnv != nil {
+		merged.InfrastructureOverrides = azureEnv
+		if err := applyAzureOverrides(merged.Azure, azureEnv); err != nil {
+			return fmt.Errorf("azure.%w", err)
+		}
+	}
+	return nil
+}
+
+func (azurePlatform) Validate(merged *MergedConfig) error {
+	if merged.Azure == nil || merged.Azure.Location == "" {
+		return errors.New("azure: location is required")
+	}
+	if merged.Azure.ResourceGroupName == "" {
+		return errors.New("azure: resource_group_name is required")
+	}
+	return nil
+}
+
+func (azurePlatform) Artifacts(merged *MergedConfig) ([]Artifact, error) {
+	if !terraformJSON(merged.Infrastructure) {
+		return nil, nil
+	}
+	vars, err := newAzureVariables(merged)
+	if err != nil {
+		return nil, fmt.Errorf("azure.%w", err)
+	}
+	return terraformVariablesArtifacts(vars), nil
+}
+
+func (azurePlatform) Templates(infra InfrastructureChoice) ([]TemplateSpec, error) {
+	return infrastructureTemplates("azure", infra)
+}
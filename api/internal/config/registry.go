@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// EnvironmentPlaceholder in an output path is replaced by the environment id,
+// e.g. Pulumi.{environment}.yaml
+const EnvironmentPlaceholder = "{environment}"
+
+// TemplateSpec pairs a template with the output it renders to.
+// Template is relative to api/templates, Output to the environment output directory.
+type TemplateSpec struct {
+	Name     string
+	Template string
+	Output   string
+}
+
+// Artifact is a non-template output produced after rendering, written as JSON
+// relative to the environment output directory
+type Artifact struct {
+	Name   string
+	Output string
+	Data   interface{}
+}
+
+// Provider is the behaviour shared by platforms and orchestrators
+type Provider interface {
+	// Name is the identifier used in config.yaml
+	Name() string
+	// Load decodes the provider's settings file
+	Load(path string) (interface{}, error)
+	// Merge populates the merged config from the loaded settings and the
+	// module environment overrides
+	Merge(merged *MergedConfig, settings interface{}, env map[string]interface{}) error
+	// Validate checks the merged config before anything is rendered
+	Validate(merged *MergedConfig) error
+	// Artifacts returns outputs generated after the templates are rendered
+	Artifacts(merged *MergedConfig) ([]Artifact, error)
+}
+
+// PlatformProvider is an infrastructure platform (proxmox, aws, ...)
+type PlatformProvider interface {
+	Provider
+	// Templates lists the infrastructure templates for the infrastructure
+	// provider and output format chosen in config.yaml
+	Templates(infra InfrastructureChoice) ([]TemplateSpec, error)
+}
+
+// OrchestratorProvider is a container orchestrator (kubespray, kind, ...)
+type OrchestratorProvider interface {
+	Provider
+	// Templates lists the orchestrator templates in render order
+	Templates() []TemplateSpec
+}
+
+var (
+	registryMu    sync.RWMutex
+	platforms     = make(map[string]PlatformProvider)
+	orchestrators = make(map[string]OrchestratorProvider)
+)
+
+// RegisterPlatform makes a platform available to the loader and resolver.
+// It panics if a platform with the same name is already registered.
+func RegisterPlatform(p PlatformProvider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := platforms[p.Name()]; dup {
+		panic(fmt.Sprintf("config: platform %s registered twice", p.Name()))
+	}
+	platforms[p.Name()] = p
+}
+
+// RegisterOrchestrator makes an orchestrator available to the loader and resolver.
+// It panics if an orchestrator with the same name is already registered.
+func RegisterOrchestrator(o OrchestratorProvider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := orchestrators[o.Name()]; dup {
+		panic(fmt.Sprintf("config: orchestrator %s registered twice", o.Name()))
+	}
+	orchestrators[o.Name()] = o
+}
+
+// LookupPlatform returns the registered platform with the given name
+func LookupPlatform(name string) (PlatformProvider, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := platforms[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported platform: %s", name)
+	}
+	return p, nil
+}
+
+// LookupOrchestrator returns the registered orchestrator with the given name
+func LookupOrchestrator(name string) (OrchestratorProvider, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	o, ok := orchestrators[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported orchestrator: %s", name)
+	}
+	return o, nil
+}
+
+// Platforms returns the names of all registered platforms, sorted
+func Platforms() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(platforms))
+	for name := range platforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Orchestrators returns the names of all registered orchestrators, sorted
+func Orchestrators() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(orchestrators))
+	for name := range orchestrators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateProviders runs the validation hooks of the selected platform and
+// orchestrator against the merged config
+func ValidateProviders(merged *MergedConfig) error {
+	if merged.Infrastructure.Platform != "none" {
+		platform, err := LookupPlatform(merged.Infrastructure.Platform)
+		if err != nil {
+			return err
+		}
+		if err := platform.Validate(merged); err != nil {
+			return err
+		}
+	}
+
+	orchestrator, err := LookupOrchestrator(merged.ContainerOrchestration.Orchestrator)
+	if err != nil {
+		return err
+	}
+	return orchestrator.Validate(merged)
+}
+
+// ProviderArtifacts collects the post-render artifacts of the selected
+// platform and orchestrator
+func ProviderArtifacts(merged *MergedConfig) ([]Artifact, error) {
+	var providers []Provider
+	if merged.Infrastructure.Platform != "none" {
+		platform, err := LookupPlatform(merged.Infrastructure.Platform)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, platform)
+	}
+	orchestrator, err := LookupOrchestrator(merged.ContainerOrchestration.Orchestrator)
+	if err != nil {
+		return nil, err
+	}
+	providers = append(providers, orchestrator)
+
+	var artifacts []Artifact
+	for _, provider := range providers {
+		produced, err := provider.Artifacts(merged)
+		if err != nil {
+			return nil, fmt.Errorf("%s artifacts: %w", provider.Name(), err)
+		}
+		artifacts = append(artifacts, produced...)
+	}
+	return artifacts, nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuiltinProvidersRegistered(t *testing.T) {
+	for _, name := range []string{"proxmox", "aws", "gcp", "azure"} {
+		platform, err := LookupPlatform(name)
+		if err != nil {
+			t.Fatalf("lookup platform %s: %v", name, err)
+		}
+		specs, err := platform.Templates(InfrastructureChoice{Platform: name, Provider: "terraform"})
+		if err != nil || len(specs) == 0 {
+			t.Fatalf("platform %s has no terraform templates: %v", name, err)
+		}
+	}
+	for _, name := range []string{"kubespray", "kubekey", "kind"} {
+		orchestrator, err := LookupOrchestrator(name)
+		if err != nil {
+			t.Fatalf("lookup orchestrator %s: %v", name, err)
+		}
+		if len(orchestrator.Templates()) == 0 {
+			t.Fatalf("orchestrator %s has no templates", name)
+		}
+	}
+}
+
+func TestLookupUnknownProvider(t *testing.T) {
+	if _, err := LookupPlatform("openstack"); err == nil || !strings.Contains(err.Error(), "unsupported platform") {
+		t.Fatalf("expected unsupported platform error, got %v", err)
+	}
+	if _, err := LookupOrchestrator("rke2"); err == nil || !strings.Contains(err.Error(), "unsupported orchestrator") {
+		t.Fatalf("expected unsupported orchestrator error, got %v", err)
+	}
+}
+
+func TestKubesprayValidateRequiresControlPlane(t *testing.T) {
+	orchestrator, err := LookupOrchestrator("kubespray")
+	if err != nil {
+		t.Fatalf("lookup kubespray: %v", err)
+	}
+	merged := &MergedConfig{Hosts: []Host{{Name: "worker-01", Groups: []string{"kube_node"}}}}
+	if err := orchestrator.Validate(merged); err == nil {
+		t.Fatalf("expected validation error without control plane hosts")
+	}
+
+	merged.Hosts = append(merged.Hosts, Host{Name: "master-01", Groups: []string{"kube_control_plane", "etcd"}})
+	if err := orchestrator.Validate(merged); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+}
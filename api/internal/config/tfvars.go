@@ -0,0 +1,485 @@
+package config
+
+import "fmt"
+
+// Terraform variable files are emitted either as HCL from the text templates
+// (infrastructure.format: hcl, the default) or as terraform.tfvars.json by
+// marshaling the typed structs below (infrastructure.format: json). The JSON
+// form gets typing and escaping from encoding/json, so quotes or backslashes
+// in keys and tokens cannot break the file.
+
+// Terraform variables formats selected by infrastructure.format
+const (
+	TerraformFormatHCL  = "hcl"
+	TerraformFormatJSON = "json"
+)
+
+// TerraformVariablesFile is the output written in json format
+const TerraformVariablesFile = "terraform.tfvars.json"
+
+func terraformJSON(infra InfrastructureChoice) bool {
+	return infra.Provider == "terraform" && infra.Format == TerraformFormatJSON
+}
+
+func terraformVariablesArtifacts(vars interface{}) []Artifact {
+	return []Artifact{{Name: "infrastructure", Output: TerraformVariablesFile, Data: vars}}
+}
+
+// ProxmoxVariables mirrors the variables of the Proxmox Terraform module
+type ProxmoxVariables struct {
+	ProxmoxAPIURL         string `json:"proxmox_api_url"`
+	ProxmoxAPITokenID     string `json:"proxmox_api_token_id"`
+	ProxmoxAPITokenSecret string `json:"proxmox_api_token_secret"`
+
+	ProxmoxNode       string `json:"proxmox_node"`
+	ProxmoxDatastore  string `json:"proxmox_datastore"`
+	ProxmoxIsoStorage string `json:"proxmox_iso_storage"`
+	ResourcePool      string `json:"resource_pool"`
+
+	NetworkBridge   string   `json:"network_bridge"`
+	NetworkModel    string   `json:"network_model"`
+	NetworkFirewall bool     `json:"network_firewall"`
+	VlanID          int      `json:"vlan_id"`
+	Gateway         string   `json:"gateway"`
+	DNSServers      []string `json:"dns_servers"`
+
+	TemplateID   int    `json:"template_id"`
+	TemplateName string `json:"template_name"`
+
+	VMOsType    string `json:"vm_os_type"`
+	VMBootOrder string `json:"vm_boot_order"`
+	VMScsihw    string `json:"vm_scsihw"`
+	VMAgent     string `json:"vm_agent"`
+	VMBalloon   int    `json:"vm_balloon"`
+	VMCpuType   string `json:"vm_cpu_type"`
+	VMHotplug   string `json:"vm_hotplug"`
+
+	CloudinitEnabled bool   `json:"cloudinit_enabled"`
+	CloudinitStorage string `json:"cloudinit_storage"`
+
+	SSHPublicKey string `json:"ssh_public_key"`
+	SSHUser      string `json:"ssh_user"`
+
+	Hosts map[string]ProxmoxHostVariables `json:"hosts"`
+	Tags  map[string]string               `json:"tags"`
+}
+
+// ProxmoxHostVariables is a single VM in the Proxmox hosts map
+type ProxmoxHostVariables struct {
+	VMID       int      `json:"vmid"`
+	Name       string   `json:"name"`
+	TargetNode string   `json:"target_node"`
+	Cores      int      `json:"cores"`
+	Sockets    int      `json:"sockets"`
+	Memory     int      `json:"memory"`
+	DiskSize   string   `json:"disk_size"`
+	IPAddress  string   `json:"ip_address"`
+	CIDR       string   `json:"cidr"`
+	Gateway    string   `json:"gateway"`
+	Role       string   `json:"role"`
+	Labels     []string `json:"labels,omitempty"`
+}
+
+// AWSVariables mirrors the variables of the AWS Terraform module
+type AWSVariables struct {
+	AWSRegion    string `json:"aws_region"`
+	AWSAccessKey string `json:"aws_access_key"`
+	AWSSecretKey string `json:"aws_secret_key"`
+
+	VPCCIDRBlock       string               `json:"vpc_cidr_block"`
+	EnableDNSHostnames bool                 `json:"enable_dns_hostnames"`
+	EnableDNSSupport   bool                 `json:"enable_dns_support"`
+	AvailabilityZones  []string             `json:"availability_zones"`
+	Subnets            []AWSSubnetVariables `json:"subnets"`
+
+	AMI            string `json:"ami"`
+	InstanceType   string `json:"instance_type"`
+	KeyName        string `json:"key_name"`
+	Monitoring     bool   `json:"monitoring"`
+	EBSOptimized   bool   `json:"ebs_optimized"`
+	RootVolumeType string `json:"root_volume_type"`
+	RootVolumeSize int    `json:"root_volume_size"`
+
+	SSHPublicKey   string        `json:"ssh_public_key"`
+	SSHUser        string        `json:"ssh_user"`
+	SecurityGroups []interface{} `json:"security_groups"`
+
+	Instances map[string]AWSInstanceVariables `json:"instances"`
+	Tags      map[string]string               `json:"tags"`
+}
+
+// GCPVariables mirrors the variables of the GCP Terraform module
+type GCPVariables struct {
+	ProjectID       string `json:"project_id"`
+	Region          string `json:"region"`
+	Zone            string `json:"zone"`
+	CredentialsJSON string `json:"credentials_json"`
+
+	NetworkName           string               `json:"network_name"`
+	AutoCreateSubnetworks bool                 `json:"auto_create_subnetworks"`
+	Subnets               []GCPSubnetVariables `json:"subnets"`
+
+	MachineType  string   `json:"machine_type"`
+	ImageFamily  string   `json:"image_family"`
+	ImageProject string   `json:"image_project"`
+	BootDiskSize int      `json:"boot_disk_size"`
+	BootDiskType string   `json:"boot_disk_type"`
+	NetworkTags  []string `json:"network_tags"`
+
+	SSHPublicKey  string        `json:"ssh_public_key"`
+	SSHUser       string        `json:"ssh_user"`
+	FirewallRules []interface{} `json:"firewall_rules"`
+
+	Instances map[string]GCPInstanceVariables `json:"instances"`
+	Labels    map[string]string               `json:"labels"`
+}
+
+// AzureVariables mirrors the variables of the Azure Terraform module
+type AzureVariables struct {
+	SubscriptionID string `json:"subscription_id"`
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	TenantID       string `json:"tenant_id"`
+
+	Location          string `json:"location"`
+	ResourceGroupName string `json:"resource_group_name"`
+
+	VNetName         string                 `json:"vnet_name"`
+	VNetAddressSpace []string               `json:"vnet_address_space"`
+	Subnets          []AzureSubnetVariables `json:"subnets"`
+
+	VMSize                        string `json:"vm_size"`
+	AdminUsername                 string `json:"admin_username"`
+	DisablePasswordAuthentication bool   `json:"disable_password_authentication"`
+	OSDiskCaching                 string `json:"os_disk_caching"`
+	OSDiskStorageAccountType      string `json:"os_disk_storage_account_type"`
+	OSDiskSizeGB                  int    `json:"os_disk_size_gb"`
+
+	SourceImagePublisher string `json:"source_image_publisher"`
+	SourceImageOffer     string `json:"source_image_offer"`
+	SourceImageSKU       string `json:"source_image_sku"`
+	SourceImageVersion   string `json:"source_image_version"`
+
+	SSHPublicKey  string        `json:"ssh_public_key"`
+	NSGName       string        `json:"nsg_name"`
+	SecurityRules []interface{} `json:"security_rules"`
+
+	VMs  map[string]AzureVMVariables `json:"vms"`
+	Tags map[string]string           `json:"tags"`
+}
+
+// AWSSubnetVariables is a single entry of the AWS subnets list
+type AWSSubnetVariables struct {
+	Name                string `json:"name"`
+	CIDRBlock           string `json:"cidr_block"`
+	AvailabilityZone    string `json:"availability_zone"`
+	MapPublicIPOnLaunch bool   `json:"map_public_ip_on_launch"`
+}
+
+// GCPSubnetVariables is a single entry of the GCP subnets list
+type GCPSubnetVariables struct {
+	Name                  string                       `json:"name"`
+	IPCIDRRange           string                       `json:"ip_cidr_range"`
+	Region                string                       `json:"region"`
+	PrivateIPGoogleAccess bool                         `json:"private_ip_google_access"`
+	SecondaryIPRanges     []GCPSecondaryRangeVariables `json:"secondary_ip_ranges"`
+}
+
+// GCPSecondaryRangeVariables is a secondary range of a GCP subnet
+type GCPSecondaryRangeVariables struct {
+	RangeName   string `json:"range_name"`
+	IPCIDRRange string `json:"ip_cidr_range"`
+}
+
+// AzureSubnetVariables is a single entry of the Azure subnets list
+type AzureSubnetVariables struct {
+	Name            string   `json:"name"`
+	AddressPrefixes []string `json:"address_prefixes"`
+}
+
+// AWSInstanceVariables is a single EC2 instance in the AWS instances map
+type AWSInstanceVariables struct {
+	Name         string   `json:"name"`
+	InstanceType string   `json:"instance_type"`
+	PrivateIP    string   `json:"private_ip"`
+	Role         string   `json:"role"`
+	Labels       []string `json:"labels,omitempty"`
+}
+
+// GCPInstanceVariables is a single instance in the GCP instances map
+type GCPInstanceVariables struct {
+	Name        string `json:"name"`
+	MachineType string `json:"machine_type"`
+	Zone        string `json:"zone"`
+	PrivateIP   string `json:"private_ip"`
+	Role        string `json:"role"`
+}
+
+// AzureVMVariables is a single VM in the Azure vms map
+type AzureVMVariables struct {
+	Name      string `json:"name"`
+	VMSize    string `json:"vm_size"`
+	PrivateIP string `json:"private_ip"`
+	Role      string `json:"role"`
+}
+
+func newProxmoxVariables(merged *MergedConfig) (*ProxmoxVariables, error) {
+	p := merged.Proxmox
+	credentials, err := overrideStrings(merged.InfrastructureOverrides, "endpoint", "api_token_id", "api_token_secret")
+	if err != nil {
+		return nil, err
+	}
+	management := managementNetwork(merged)
+
+	vars := &ProxmoxVariables{
+		ProxmoxAPIURL:         credentials["endpoint"],
+		ProxmoxAPITokenID:     credentials["api_token_id"],
+		ProxmoxAPITokenSecret: credentials["api_token_secret"],
+		ProxmoxNode:           p.NodeName,
+		ProxmoxDatastore:      p.Datastore,
+		ProxmoxIsoStorage:     p.IsoStorage,
+		ResourcePool:          p.Pool,
+		NetworkBridge:         p.Network.Bridge,
+		NetworkModel:          p.Network.Model,
+		NetworkFirewall:       p.Network.Firewall,
+		VlanID:                management.VlanID,
+		Gateway:               management.Gateway,
+		DNSServers:            nonNilStrings(management.DNSServers),
+		TemplateID:            p.Template.ID,
+		TemplateName:          p.Template.Name,
+		VMOsType:              p.VmDefaults.OsType,
+		VMBootOrder:           p.VmDefaults.BootOrder,
+		VMScsihw:              p.VmDefaults.Scsihw,
+		VMAgent:               p.VmDefaults.Agent,
+		VMBalloon:             p.VmDefaults.Balloon,
+		VMCpuType:             p.VmDefaults.CpuType,
+		VMHotplug:             p.VmDefaults.Hotplug,
+		CloudinitEnabled:      p.Cloudinit.Enabled,
+		CloudinitStorage:      p.Cloudinit.Storage,
+		SSHPublicKey:          merged.SSH.PublicKey,
+		SSHUser:               merged.SSH.User,
+		Hosts:                 make(map[string]ProxmoxHostVariables, len(merged.Hosts)),
+		Tags:                  terraformTags(merged, nil),
+	}
+	for i, host := range merged.Hosts {
+		vars.Hosts[host.Name] = ProxmoxHostVariables{
+			VMID:       100 + i,
+			Name:       host.Name,
+			TargetNode: p.NodeName,
+			Cores:      host.CPU,
+			Sockets:    p.Template.Sockets,
+			Memory:     host.Memory,
+			DiskSize:   fmt.Sprintf("%dG", host.Disk),
+			IPAddress:  host.IP,
+			CIDR:       management.CIDR,
+			Gateway:    management.Gateway,
+			Role:       host.Role,
+			Labels:     host.Labels,
+		}
+	}
+	return vars, nil
+}
+
+func newAWSVariables(merged *MergedConfig) (*AWSVariables, error) {
+	a := merged.AWS
+	credentials, err := overrideStrings(merged.InfrastructureOverrides, "access_key", "secret_key")
+	if err != nil {
+		return nil, err
+	}
+
+	vars := &AWSVariables{
+		AWSRegion:          a.Region,
+		AWSAccessKey:       credentials["access_key"],
+		AWSSecretKey:       credentials["secret_key"],
+		VPCCIDRBlock:       a.VPC.CIDRBlock,
+		EnableDNSHostnames: a.VPC.EnableDNSHostnames,
+		EnableDNSSupport:   a.VPC.EnableDNSSupport,
+		AvailabilityZones:  nonNilStrings(a.AvailabilityZones),
+		Subnets:            make([]AWSSubnetVariables, 0, len(a.Subnets)),
+		AMI:                a.InstanceDefaults.AMI,
+		InstanceType:       a.InstanceDefaults.InstanceType,
+		KeyName:            a.InstanceDefaults.KeyName,
+		Monitoring:         a.InstanceDefaults.Monitoring,
+		EBSOptimized:       a.InstanceDefaults.EBSOptimized,
+		RootVolumeType:     a.InstanceDefaults.RootVolume.VolumeType,
+		RootVolumeSize:     a.InstanceDefaults.RootVolume.VolumeSize,
+		SSHPublicKey:       merged.SSH.PublicKey,
+		SSHUser:            merged.SSH.User,
+		SecurityGroups:     nonNilList(a.SecurityGroups),
+		Instances:          make(map[string]AWSInstanceVariables, len(merged.Hosts)),
+		Tags:               terraformTags(merged, a.Tags),
+	}
+	for _, subnet := range a.Subnets {
+		vars.Subnets = append(vars.Subnets, AWSSubnetVariables{
+			Name:                subnet.Name,
+			CIDRBlock:           subnet.CIDRBlock,
+			AvailabilityZone:    subnet.AvailabilityZone,
+			MapPublicIPOnLaunch: subnet.MapPublicIPOnLaunch,
+		})
+	}
+	for _, host := range merged.Hosts {
+		vars.Instances[host.Name] = AWSInstanceVariables{
+			Name:         host.Name,
+			InstanceType: a.InstanceDefaults.InstanceType,
+			PrivateIP:    host.IP,
+			Role:         host.Role,
+			Labels:       host.Labels,
+		}
+	}
+	return vars, nil
+}
+
+func newGCPVariables(merged *MergedConfig) (*GCPVariables, error) {
+	g := merged.GCP
+	credentials, err := overrideStrings(merged.InfrastructureOverrides, "credentials_json")
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		"environment": merged.Environment,
+		"managed_by":  "terraform",
+		"config_pkg":  merged.ConfigPackage,
+	}
+	for k, v := range g.Labels {
+		labels[k] = v
+	}
+
+	vars := &GCPVariables{
+		ProjectID:             g.ProjectID,
+		Region:                g.Region,
+		Zone:                  g.Zone,
+		CredentialsJSON:       credentials["credentials_json"],
+		NetworkName:           g.Network.Name,
+		AutoCreateSubnetworks: g.Network.AutoCreateSubnetworks,
+		Subnets:               make([]GCPSubnetVariables, 0, len(g.Subnets)),
+		MachineType:           g.InstanceDefaults.MachineType,
+		ImageFamily:           g.InstanceDefaults.ImageFamily,
+		ImageProject:          g.InstanceDefaults.ImageProject,
+		BootDiskSize:          g.InstanceDefaults.BootDisk.SizeGB,
+		BootDiskType:          g.InstanceDefaults.BootDisk.Type,
+		NetworkTags:           nonNilStrings(g.InstanceDefaults.NetworkTags),
+		SSHPublicKey:          merged.SSH.PublicKey,
+		SSHUser:               merged.SSH.User,
+		FirewallRules:         nonNilList(g.FirewallRules),
+		Instances:             make(map[string]GCPInstanceVariables, len(merged.Hosts)),
+		Labels:                labels,
+	}
+	for _, subnet := range g.Subnets {
+		ranges := make([]GCPSecondaryRangeVariables, 0, len(subnet.SecondaryIPRanges))
+		for _, r := range subnet.SecondaryIPRanges {
+			ranges = append(ranges, GCPSecondaryRangeVariables{RangeName: r.RangeName, IPCIDRRange: r.IPCIDRRange})
+		}
+		vars.Subnets = append(vars.Subnets, GCPSubnetVariables{
+			Name:                  subnet.Name,
+			IPCIDRRange:           subnet.IPCIDRRange,
+			Region:                subnet.Region,
+			PrivateIPGoogleAccess: subnet.PrivateIPGoogleAccess,
+			SecondaryIPRanges:     ranges,
+		})
+	}
+	for _, host := range merged.Hosts {
+		vars.Instances[host.Name] = GCPInstanceVariables{
+			Name:        host.Name,
+			MachineType: g.InstanceDefaults.MachineType,
+			Zone:        g.Zone,
+			PrivateIP:   host.IP,
+			Role:        host.Role,
+		}
+	}
+	return vars, nil
+}
+
+func newAzureVariables(merged *MergedConfig) (*AzureVariables, error) {
+	a := merged.Azure
+	credentials, err := overrideStrings(merged.InfrastructureOverrides, "subscription_id", "client_id", "client_secret", "tenant_id")
+	if err != nil {
+		return nil, err
+	}
+	vm := a.VMDefaults
+
+	vars := &AzureVariables{
+		SubscriptionID:                credentials["subscription_id"],
+		ClientID:                      credentials["client_id"],
+		ClientSecret:                  credentials["client_secret"],
+		TenantID:                      credentials["tenant_id"],
+		Location:                      a.Location,
+		ResourceGroupName:             a.ResourceGroupName,
+		VNetName:                      a.VNet.Name,
+		VNetAddressSpace:              nonNilStrings(a.VNet.AddressSpace),
+		Subnets:                       make([]AzureSubnetVariables, 0, len(a.Subnets)),
+		VMSize:                        vm.Size,
+		AdminUsername:                 vm.AdminUsername,
+		DisablePasswordAuthentication: vm.DisablePasswordAuthentication,
+		OSDiskCaching:                 vm.OSDisk.Caching,
+		OSDiskStorageAccountType:      vm.OSDisk.StorageAccountType,
+		OSDiskSizeGB:                  vm.OSDisk.DiskSizeGB,
+		SourceImagePublisher:          vm.SourceImageReference.Publisher,
+		SourceImageOffer:              vm.SourceImageReference.Offer,
+		SourceImageSKU:                vm.SourceImageReference.SKU,
+		SourceImageVersion:            vm.SourceImageReference.Version,
+		SSHPublicKey:                  merged.SSH.PublicKey,
+		NSGName:                       a.NetworkSecurityGroup.Name,
+		SecurityRules:                 nonNilList(a.NetworkSecurityGroup.SecurityRules),
+		VMs:                           make(map[string]AzureVMVariables, len(merged.Hosts)),
+		Tags:                          terraformTags(merged, a.Tags),
+	}
+	for _, subnet := range a.Subnets {
+		vars.Subnets = append(vars.Subnets, AzureSubnetVariables{
+			Name:            subnet.Name,
+			AddressPrefixes: nonNilStrings(subnet.AddressPrefixes),
+		})
+	}
+	for _, host := range merged.Hosts {
+		vars.VMs[host.Name] = AzureVMVariables{
+			Name:      host.Name,
+			VMSize:    vm.Size,
+			PrivateIP: host.IP,
+			Role:      host.Role,
+		}
+	}
+	return vars, nil
+}
+
+// managementNetwork returns the network named "management", falling back to
+// the first declared network. The Proxmox terraform.tfvars template picks
+// the same network, so both formats set the same variables.
+func managementNetwork(merged *MergedConfig) Network {
+	for _, network := range merged.Networks.Networks {
+		if network.Name == "management" {
+			return network
+		}
+	}
+	if len(merged.Networks.Networks) > 0 {
+		return merged.Networks.Networks[0]
+	}
+	return Network{}
+}
+
+// terraformTags returns the standard tags merged with platform tags
+func terraformTags(merged *MergedConfig, extra map[string]string) map[string]string {
+	tags := map[string]string{
+		"Environment": merged.Environment,
+		"ManagedBy":   "terraform",
+		"ConfigPkg":   merged.ConfigPackage,
+	}
+	for k, v := range extra {
+		tags[k] = v
+	}
+	return tags
+}
+
+// nonNilStrings keeps empty lists as [] rather than null in JSON
+func nonNilStrings(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
+
+func nonNilList(items []interface{}) []interface{} {
+	if items == nil {
+		return []interface{}{}
+	}
+	return items
+}
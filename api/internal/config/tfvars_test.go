@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTerraformVariablesJSONEscapingAndTypes(t *testing.T) {
+	secret := `pa"ss\word` + "\n"
+	merged := &MergedConfig{
+		Environment:   "development",
+		ConfigPackage: "core",
+		Infrastructure: InfrastructureChoice{
+			Platform: "proxmox",
+			Provider: "terraform",
+			Format:   TerraformFormatJSON,
+		},
+		Proxmox:                 &ProxmoxSettings{NodeName: "pve-01"},
+		InfrastructureOverrides: map[string]interface{}{"api_token_secret": secret},
+		Networks:                NetworksConfig{Networks: []Network{{Name: "management", CIDR: "10.0.0.0/24", VlanID: 10}}},
+		Hosts:                   []Host{{Name: "master-01", Role: "master", IP: "10.0.0.11", CPU: 4, Memory: 8192, Disk: 100}},
+	}
+
+	platform, err := LookupPlatform("proxmox")
+	if err != nil {
+		t.Fatalf("lookup proxmox: %v", err)
+	}
+	specs, err := platform.Templates(merged.Infrastructure)
+	if err != nil || len(specs) != 0 {
+		t.Fatalf("expected no templates in json format, got %v (%v)", specs, err)
+	}
+	artifacts, err := platform.Artifacts(merged)
+	if err != nil || len(artifacts) != 1 || artifacts[0].Output != TerraformVariablesFile {
+		t.Fatalf("expected %s artifact, got %+v (%v)", TerraformVariablesFile, artifacts, err)
+	}
+
+	data, err := json.Marshal(artifacts[0].Data)
+	if err != nil {
+		t.Fatalf("marshal variables: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal variables: %v", err)
+	}
+	if got := decoded["proxmox_api_token_secret"]; got != secret {
+		t.Fatalf("secret did not round-trip: %q", got)
+	}
+	if got, ok := decoded["vlan_id"].(float64); !ok || got != 10 {
+		t.Fatalf("expected numeric vlan_id 10, got %#v", decoded["vlan_id"])
+	}
+	host := decoded["hosts"].(map[string]interface{})["master-01"].(map[string]interface{})
+	if host["disk_size"] != "100G" || host["memory"] != float64(8192) {
+		t.Fatalf("unexpected host variables: %v", host)
+	}
+	if _, ok := decoded["dns_servers"].([]interface{}); !ok {
+		t.Fatalf("expected dns_servers to be a list, got %#v", decoded["dns_servers"])
+	}
+
+	merged.InfrastructureOverrides["endpoint"] = 8006
+	if _, err := platform.Artifacts(merged); err == nil {
+		t.Fatalf("expected an error for a mistyped endpoint")
+	}
+}
+
+func TestTerraformHCLFormatUsesTemplate(t *testing.T) {
+	platform, err := LookupPlatform("aws")
+	if err != nil {
+		t.Fatalf("lookup aws: %v", err)
+	}
+	infra := InfrastructureChoice{Platform: "aws", Provider: "terraform"}
+	specs, err := platform.Templates(infra)
+	if err != nil || len(specs) != 1 || specs[0].Output != "terraform.tfvars" {
+		t.Fatalf("expected terraform.tfvars template, got %v (%v)", specs, err)
+	}
+	infra.Format = "toml"
+	if _, err := platform.Templates(infra); err == nil {
+		t.Fatalf("expected unsupported format error")
+	}
+}
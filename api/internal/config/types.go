@@ -10,8 +10,9 @@ type MasterConfig struct {
 }
 
 type InfrastructureChoice struct {
-	Platform string `yaml:"platform"` // proxmox, aws, gcp, azure, baremetal
-	Provider string `yaml:"provider"` // terraform, pulumi, ansible
+	Platform string `yaml:"platform"`         // proxmox, aws, gcp, azure, baremetal
+	Provider string `yaml:"provider"`         // terraform, pulumi, ansible
+	Format   string `yaml:"format,omitempty"` // terraform variables: hcl (default), json
 }
 
 type ContainerOrchestrationChoice struct {
@@ -24,7 +25,27 @@ type PlatformDeployment struct {
 }
 
 type BusinessDeployment struct {
-	DeploymentMethod string `yaml:"deployment_method"` // argocd, helm, kustomize
+	DeploymentMethod string         `yaml:"deployment_method"` // argocd, helm, kustomize
+	ArgoCD           ArgoCDSettings `yaml:"argocd,omitempty"`
+}
+
+// ArgoCDSettings configures the Argo CD manifests of business applications.
+// The argocd section of business/environments/<env>.yaml overrides it.
+type ArgoCDSettings struct {
+	RepoURL        string            `yaml:"repo_url"`
+	TargetRevision string            `yaml:"target_revision,omitempty"` // for apps that set none, default HEAD
+	Project        string            `yaml:"project,omitempty"`         // default "default"
+	Namespace      string            `yaml:"namespace,omitempty"`       // of the Argo CD installation, default argocd
+	Destination    ArgoCDDestination `yaml:"destination,omitempty"`
+	Manifest       string            `yaml:"manifest,omitempty"` // applications (default) or applicationset
+	Retry          *ApplicationRetry `yaml:"retry,omitempty"`    // for apps that set none
+}
+
+// ArgoCDDestination is the cluster applications are deployed to, by API
+// server URL or by cluster name; the in-cluster server when neither is set
+type ArgoCDDestination struct {
+	Server string `yaml:"server,omitempty"`
+	Name   string `yaml:"name,omitempty"`
 }
 
 // HostsConfig represents platform-agnostic host definitions (hosts.yaml)
@@ -306,12 +327,13 @@ type StackConfig struct {
 	SyncWave            int                    `yaml:"sync_wave,omitempty"`
 	Components          []string               `yaml:"components,omitempty"`
 	Provider            string                 `yaml:"provider,omitempty"`
-	DefaultStorageClass string                 `yaml:"defaultStorageClass,omitempty"`
+	DefaultStorageClass string                 `yaml:"default_storage_class,omitempty"`
 	Controller          string                 `yaml:"controller,omitempty"`
 	Backend             string                 `yaml:"backend,omitempty"`
 	Retention           map[string]string      `yaml:"retention,omitempty"`
 	Storage             map[string]string      `yaml:"storage,omitempty"`
 	Schedule            string                 `yaml:"schedule,omitempty"`
+	Charts              []string               `yaml:"charts,omitempty"` // platform/stacks/<dir>/charts/<chart> as <dir>/<chart>, for the kustomize method
 }
 
 // BusinessConfig represents business applications configuration
@@ -323,11 +345,13 @@ type Application struct {
 	Name         string                 `yaml:"name"`
 	Enabled      bool                   `yaml:"enabled"`
 	Namespace    string                 `yaml:"namespace"`
-	SyncWave     int                    `yaml:"sync_wave,omitempty"`
+	SyncWave     *int                   `yaml:"sync_wave,omitempty"` // derived from Dependencies when omitted
 	Source       ApplicationSource      `yaml:"source"`
 	SyncPolicy   *ApplicationSyncPolicy `yaml:"sync_policy,omitempty"`
 	Values       map[string]interface{} `yaml:"values,omitempty"`
 	Dependencies []string               `yaml:"dependencies,omitempty"`
+
+	IgnoreDifferences []IgnoreDifference `yaml:"ignore_differences,omitempty"`
 }
 
 type ApplicationSource struct {
@@ -339,6 +363,7 @@ type ApplicationSource struct {
 type ApplicationSyncPolicy struct {
 	Automated   ApplicationSyncAutomated `yaml:"automated"`
 	SyncOptions []string                 `yaml:"sync_options,omitempty"`
+	Retry       *ApplicationRetry        `yaml:"retry,omitempty"`
 }
 
 type ApplicationSyncAutomated struct {
@@ -346,6 +371,30 @@ type ApplicationSyncAutomated struct {
 	SelfHeal bool `yaml:"self_heal"`
 }
 
+// ApplicationRetry is the Argo CD retry strategy of failed syncs
+type ApplicationRetry struct {
+	Limit   int                      `yaml:"limit"`
+	Backoff *ApplicationRetryBackoff `yaml:"backoff,omitempty"`
+}
+
+type ApplicationRetryBackoff struct {
+	Duration    string `yaml:"duration,omitempty"` // e.g. 5s
+	Factor      int    `yaml:"factor,omitempty"`
+	MaxDuration string `yaml:"max_duration,omitempty"`
+}
+
+// IgnoreDifference excludes fields of matching resources from Argo CD's
+// diff, e.g. replicas managed by an autoscaler
+type IgnoreDifference struct {
+	Group                 string   `yaml:"group,omitempty"`
+	Kind                  string   `yaml:"kind"`
+	Name                  string   `yaml:"name,omitempty"`
+	Namespace             string   `yaml:"namespace,omitempty"`
+	JSONPointers          []string `yaml:"json_pointers,omitempty"`
+	JQPathExpressions     []string `yaml:"jq_path_expressions,omitempty"`
+	ManagedFieldsManagers []string `yaml:"managed_fields_managers,omitempty"`
+}
+
 // SSHConfig represents SSH configuration
 type SSHConfig struct {
 	User      string `yaml:"user"`
@@ -381,9 +430,13 @@ type MergedConfig struct {
 	// Platform and Business
 	Stacks       map[string]StackConfig
 	Applications []Application
+	ArgoCD       ArgoCDSettings // business.argocd with the environment's overrides
 
 	// Environment overrides
+	InfrastructureOverrides map[string]interface{} // platform section of infrastructure/environments/<env>.yaml
 	ClusterOverrides   map[string]interface{}
-	Global             map[string]interface{}
+	PlatformOverrides  map[string]interface{} // platform/environments/<env>.yaml
+	Global             map[string]interface{} // sections of business/environments/<env>.yaml
 	NamespaceConfigs   map[string]interface{}
+	AppOverrides       map[string]interface{}
 }
@@ -0,0 +1,288 @@
+// Package coverage reports which MergedConfig fields the templates, provider
+// artifacts and generated manifests of a platform and orchestrator
+// combination use, so that config which silently does nothing is visible
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"pn-infra/api/internal/argocd"
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/kustomize"
+	"pn-infra/api/internal/manifest"
+	"pn-infra/api/internal/template"
+)
+
+// Field is a settable MergedConfig field and how it is used
+type Field struct {
+	Path string `json:"path"`
+
+	// Static is set when a template reads the field
+	Static bool `json:"static"`
+
+	// Dynamic is set when changing the field changes a rendered output or
+	// provider artifact
+	Dynamic bool `json:"dynamic"`
+}
+
+// Ignored reports whether nothing uses the field
+func (f Field) Ignored() bool {
+	return !f.Static && !f.Dynamic
+}
+
+// Unrendered is a template that failed to render with the config, so its
+// fields could only be traced statically, or a manifest generator that
+// failed, so its fields were not traced
+type Unrendered struct {
+	Template string `json:"template"`
+	Error    string `json:"error"`
+}
+
+// Report is the field coverage of one platform and orchestrator combination
+type Report struct {
+	Platform     string       `json:"platform"`
+	Orchestrator string       `json:"orchestrator"`
+	Templates    []string     `json:"templates"`           // relative to the repository root
+	Artifacts    []string     `json:"artifacts,omitempty"` // provider artifacts and generated manifests
+	Unrendered   []Unrendered `json:"unrendered,omitempty"`
+	Fields       []Field      `json:"fields"`
+}
+
+// Ignored returns the fields that nothing uses
+func (r *Report) Ignored() []Field {
+	var ignored []Field
+	for _, field := range r.Fields {
+		if field.Ignored() {
+			ignored = append(ignored, field)
+		}
+	}
+	return ignored
+}
+
+// DefaultProvider is the infrastructure provider analyzed for platforms when
+// config.yaml chooses none
+const DefaultProvider = "terraform"
+
+// Combination loads a config package's environment as if config.yaml chose
+// platform, provider and orchestrator, resolves its templates and reports
+// which of the settable fields they use. An empty provider keeps the one in
+// config.yaml, or DefaultProvider when that is none.
+func Combination(repoRoot, configPackage, environment, platform, provider, orchestrator string) (*Report, error) {
+	loader := config.NewLoader(repoRoot, configPackage, environment)
+	master, err := loader.LoadMasterConfig()
+	if err != nil {
+		return nil, err
+	}
+	master.Infrastructure.Platform = platform
+	if provider != "" {
+		master.Infrastructure.Provider = provider
+	} else if platform != "none" && (master.Infrastructure.Provider == "" || master.Infrastructure.Provider == "none") {
+		master.Infrastructure.Provider = DefaultProvider
+	}
+	master.ContainerOrchestration.Orchestrator = orchestrator
+	merged, err := loader.LoadAndMergeFor(master)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := template.NewPathResolver(repoRoot)
+	resolver.SearchPath = template.SearchPath(repoRoot, configPackage, environment)
+	paths, err := resolver.Resolve(&merged.MasterConfig)
+	if err != nil {
+		return nil, fmt.Errorf("resolve template paths: %w", err)
+	}
+	var sources []template.Source
+	for _, target := range append(paths.Infrastructure, paths.ContainerOrchestration...) {
+		sources = append(sources, target.Template)
+	}
+	sources = append(sources, paths.Provisioner)
+	platformMethod, err := merged.MasterConfig.Platform.Method()
+	if err != nil {
+		return nil, err
+	}
+	businessMethod, err := merged.MasterConfig.Business.Method()
+	if err != nil {
+		return nil, err
+	}
+	if platformMethod != config.DeploymentKustomize {
+		sources = append(sources, paths.Platform)
+	}
+	if businessMethod != config.DeploymentKustomize {
+		sources = append(sources, paths.Business)
+	}
+
+	report, err := Analyze(repoRoot, sources, merged)
+	if err != nil {
+		return nil, err
+	}
+	report.Platform, report.Orchestrator = platform, orchestrator
+	return report, nil
+}
+
+// Analyze reports which settable fields of merged the templates, the
+// provider artifacts and the manifests generated for its deployment methods
+// use. A field is used statically when a template reads it, and dynamically
+// when changing its value changes an output.
+func Analyze(repoRoot string, sources []template.Source, merged *config.MergedConfig) (*Report, error) {
+	report := &Report{}
+	renderer := template.NewRenderer(repoRoot)
+
+	var reads []template.FieldRead
+	var rendered []template.Source
+	baseline := make([]string, 0, len(sources))
+	for _, src := range sources {
+		relative := src.Path
+		if rel, err := filepath.Rel(repoRoot, src.Path); err == nil {
+			relative = rel
+		}
+		report.Templates = append(report.Templates, relative)
+
+		traced, err := template.FieldReads(src, reflect.TypeOf(merged))
+		if err != nil {
+			return nil, err
+		}
+		reads = append(reads, traced...)
+
+		output, err := renderer.RenderSource(src, merged)
+		if err != nil {
+			report.Unrendered = append(report.Unrendered, Unrendered{Template: relative, Error: firstLine(err.Error())})
+			continue
+		}
+		rendered = append(rendered, src)
+		baseline = append(baseline, output)
+	}
+
+	artifacts, err := artifactOutputs(merged)
+	if err != nil {
+		return nil, err
+	}
+	for name := range artifacts {
+		report.Artifacts = append(report.Artifacts, name)
+	}
+
+	generators, err := manifestGenerators(repoRoot, merged)
+	if err != nil {
+		return nil, err
+	}
+	var generatorNames []string
+	for name := range generators {
+		generatorNames = append(generatorNames, name)
+	}
+	sort.Strings(generatorNames)
+	generated := map[string]map[string]string{}
+	for _, name := range generatorNames {
+		files, err := generators[name](merged)
+		if err != nil {
+			report.Unrendered = append(report.Unrendered, Unrendered{Template: name, Error: firstLine(err.Error())})
+			continue
+		}
+		generated[name] = fileContents(files)
+		for path := range generated[name] {
+			report.Artifacts = append(report.Artifacts, path)
+		}
+	}
+	sort.Strings(report.Artifacts)
+
+	// outputsChange renders everything with a changed copy of the config
+	outputsChange := func(changed *config.MergedConfig) bool {
+		for i, src := range rendered {
+			if output, err := renderer.RenderSource(src, changed); err != nil || output != baseline[i] {
+				return true
+			}
+		}
+		changedArtifacts, err := artifactOutputs(changed)
+		if err != nil || len(changedArtifacts) != len(artifacts) {
+			return true
+		}
+		for name, content := range artifacts {
+			if changedArtifacts[name] != content {
+				return true
+			}
+		}
+		for name, contents := range generated {
+			files, err := generators[name](changed)
+			if err != nil || !reflect.DeepEqual(fileContents(files), contents) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, path := range settablePaths(merged) {
+		field := Field{Path: path, Static: readsPath(reads, path)}
+		changed := clone(reflect.ValueOf(merged)).Interface().(*config.MergedConfig)
+		probed := false
+		for _, alias := range aliasesOf(path) {
+			probed = perturb(reflect.ValueOf(changed).Elem(), splitPath(alias)) || probed
+		}
+		field.Dynamic = probed && outputsChange(changed)
+		report.Fields = append(report.Fields, field)
+	}
+	return report, nil
+}
+
+// artifactOutputs returns the provider artifacts as JSON, keyed by output
+func artifactOutputs(merged *config.MergedConfig) (map[string]string, error) {
+	artifacts, err := config.ProviderArtifacts(merged)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make(map[string]string, len(artifacts))
+	for _, artifact := range artifacts {
+		data, err := json.Marshal(artifact.Data)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s: %w", artifact.Output, err)
+		}
+		outputs[artifact.Output] = string(data)
+	}
+	return outputs, nil
+}
+
+// manifestGenerators returns the generators building the kustomization and
+// Argo CD manifests that the deployment methods of merged select, by name
+func manifestGenerators(repoRoot string, merged *config.MergedConfig) (map[string]func(*config.MergedConfig) ([]manifest.File, error), error) {
+	platformMethod, err := merged.MasterConfig.Platform.Method()
+	if err != nil {
+		return nil, err
+	}
+	businessMethod, err := merged.MasterConfig.Business.Method()
+	if err != nil {
+		return nil, err
+	}
+
+	// The header only depends on selection fields, so it is left out
+	outputDir := template.NewPathResolver(repoRoot).ResolveOutputPaths(merged.Environment).OutputDir
+	generator := kustomize.NewGenerator(repoRoot, outputDir, "")
+	generators := map[string]func(*config.MergedConfig) ([]manifest.File, error){}
+	if platformMethod == config.DeploymentKustomize {
+		generators["kustomize platform"] = generator.Platform
+	}
+	switch businessMethod {
+	case config.DeploymentKustomize:
+		generators["kustomize business"] = generator.Business
+	case config.DeploymentArgoCD:
+		generators["argocd manifests"] = func(merged *config.MergedConfig) ([]manifest.File, error) {
+			return argocd.Manifests(merged, "")
+		}
+	}
+	return generators, nil
+}
+
+// fileContents returns generated files as content by path
+func fileContents(files []manifest.File) map[string]string {
+	contents := make(map[string]string, len(files))
+	for _, file := range files {
+		contents[file.Path] = string(file.Content)
+	}
+	return contents
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,103 @@
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/template"
+)
+
+func TestAnalyzeTracesStaticallyAndDynamically(t *testing.T) {
+	repo := t.TempDir()
+	dir := filepath.Join(repo, "api", "templates")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	templates := map[string]string{
+		"inventory.ini.tmpl": "{{ range .Hosts }}{{ .Name }} ansible_host={{ .IP }}\n{{ end }}{{ if .Networks.DNS.Domain }}domain set{{ end }}\n",
+		"broken.yaml.tmpl":   "{{ .Kubespray.KubeVersion }} {{ .Missing }}\n",
+	}
+	var sources []template.Source
+	for name, content := range templates {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write template: %v", err)
+		}
+		sources = append(sources, template.Source{Path: path})
+	}
+
+	merged := &config.MergedConfig{
+		Environment:            "development",
+		Hosts:                  []config.Host{{Name: "node1", IP: "10.0.0.1", CPU: 2, Labels: []string{"ssd"}}},
+		DNS:                    config.DNSConfig{Domain: "example.com"},
+		Networks:               config.NetworksConfig{DNS: config.DNSConfig{Domain: "example.com"}},
+		SSH:                    config.SSHConfig{User: "ansible"},
+		Infrastructure:         config.InfrastructureChoice{Platform: "none"},
+		ContainerOrchestration: config.ContainerOrchestrationChoice{Orchestrator: "kubespray"},
+		Kubespray:              &config.KubespraySettings{KubeVersion: "v1.30.4"},
+		Kind:                   map[string]interface{}{"networking": map[string]interface{}{"pod_subnet": "10.244.0.0/16"}},
+		ArgoCD:                 config.ArgoCDSettings{RepoURL: "https://git.example.com/apps.git"},
+		Applications: []config.Application{{
+			Name: "docs", Enabled: true, Namespace: "docs",
+			Source:     config.ApplicationSource{Type: "helm", Path: "docs"},
+			SyncPolicy: &config.ApplicationSyncPolicy{SyncOptions: []string{"CreateNamespace=true"}},
+		}},
+	}
+	merged.MasterConfig.Business.DeploymentMethod = config.DeploymentArgoCD
+	report, err := Analyze(repo, sources, merged)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+
+	if len(report.Unrendered) != 1 || report.Unrendered[0].Template != filepath.Join("api", "templates", "broken.yaml.tmpl") {
+		t.Fatalf("expected the broken template to be reported, got %+v", report.Unrendered)
+	}
+	if want := []string{"argocd/docs.yaml", "kubesprayConfig.json"}; !reflect.DeepEqual(report.Artifacts, want) {
+		t.Fatalf("expected the argocd manifest and kubespray artifact, got %v", report.Artifacts)
+	}
+
+	fields := map[string]Field{}
+	for _, field := range report.Fields {
+		fields[field.Path] = field
+	}
+	tests := []struct {
+		path            string
+		static, dynamic bool
+	}{
+		{"Hosts[].Name", true, true},
+		{"Hosts[].IP", true, true},
+		{"Hosts[].Labels", false, false},
+		{"Hosts[].CPU", false, false},
+		{"DNS.Domain", true, false},            // read through its Networks.DNS alias, output unchanged
+		{"SSH.User", false, true},              // only the kubespray artifact uses it
+		{"Kubespray.KubeVersion", true, false}, // its template does not render
+		{"Kubespray.DockerRegistryMirrors", false, false},
+		{"Kind.networking.pod_subnet", false, false},
+
+		// Used by the Argo CD manifests, including fields of empty lists and
+		// unset sections
+		{"ArgoCD.Project", false, true},
+		{"Applications[].SyncPolicy.Retry.Limit", false, true},
+		{"Applications[].IgnoreDifferences[].JSONPointers", false, true},
+		{"Applications[].Dependencies", false, false},
+	}
+	for _, test := range tests {
+		field, ok := fields[test.path]
+		if !ok {
+			t.Fatalf("%s is not listed as settable", test.path)
+		}
+		if field.Static != test.static || field.Dynamic != test.dynamic {
+			t.Fatalf("%s: static %t, dynamic %t; want %t, %t", test.path, field.Static, field.Dynamic, test.static, test.dynamic)
+		}
+	}
+
+	// Selection fields, aliases and unloaded platforms are not listed
+	for _, path := range []string{"Environment", "Infrastructure.Platform", "ContainerOrchestration.Orchestrator", "Networks.DNS.Domain", "MasterConfig.Infrastructure.Platform", "Proxmox.Pool", "Kubekey", "MasterConfig.Business.DeploymentMethod", "MasterConfig.Business.ArgoCD.Project"} {
+		if _, ok := fields[path]; ok {
+			t.Fatalf("%s should not be listed", path)
+		}
+	}
+}
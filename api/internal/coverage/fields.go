@@ -0,0 +1,194 @@
+package coverage
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/template"
+)
+
+// aliases are MergedConfig fields copied from the same config, mapped to the
+// field they are reported as
+var aliases = map[string]string{
+	"MasterConfig.Infrastructure":         "Infrastructure",
+	"MasterConfig.ContainerOrchestration": "ContainerOrchestration",
+	"Networks.DNS":                        "DNS",
+	"Networks.NTP":                        "NTP",
+	"MasterConfig.Business.ArgoCD":        "ArgoCD",
+}
+
+// selection are fields set by the generator or used to select the
+// templates, which are not reported
+var selection = []string{
+	"ConfigPackage",
+	"Environment",
+	"MasterConfig.Version",
+	"Infrastructure.Platform",
+	"Infrastructure.Provider",
+	"Infrastructure.Format",
+	"ContainerOrchestration.Orchestrator",
+	"MasterConfig.Platform.DeploymentMethod",
+	"MasterConfig.Business.DeploymentMethod",
+}
+
+// settablePaths lists the fields of merged that config can set, once per
+// alias. Platform and orchestrator settings that were not loaded are left
+// out, as are the keys of generic maps that hold nothing.
+func settablePaths(merged *config.MergedConfig) []string {
+	var paths []string
+	settableValue(reflect.ValueOf(merged), "", &paths)
+
+	seen := map[string]bool{}
+	var settable []string
+	for _, path := range paths {
+		path = canonical(path)
+		if seen[path] || hasPrefix(path, selection) {
+			continue
+		}
+		seen[path] = true
+		settable = append(settable, path)
+	}
+	sort.Strings(settable)
+	return settable
+}
+
+// settableValue lists fields by value outside lists, so that nil settings
+// are skipped and generic maps are listed by the keys they hold
+func settableValue(v reflect.Value, path string, paths *[]string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			settableValue(v.Elem(), path, paths)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			settableValue(v.Field(i), joinPath(path, v.Type().Field(i).Name), paths)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.Interface {
+			settableType(v.Type(), path, paths)
+			return
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			settableValue(v.MapIndex(key), joinPath(path, key.String()), paths)
+		}
+	case reflect.Slice:
+		settableType(v.Type(), path, paths)
+	default:
+		*paths = append(*paths, path)
+	}
+}
+
+// settableType lists fields by type, so the fields of list elements are
+// listed even when the list is empty
+func settableType(t reflect.Type, path string, paths *[]string) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		settableType(t.Elem(), path, paths)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			settableType(t.Field(i).Type, joinPath(path, t.Field(i).Name), paths)
+		}
+	case reflect.Slice, reflect.Map:
+		element := t.Elem()
+		for element.Kind() == reflect.Ptr {
+			element = element.Elem()
+		}
+		if element.Kind() == reflect.Struct {
+			settableType(element, path+"[]", paths)
+			return
+		}
+		*paths = append(*paths, path)
+	default:
+		*paths = append(*paths, path)
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// splitPath splits a path into field names, map keys and [] elements
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var segments []string
+	for _, part := range strings.Split(path, ".") {
+		name := strings.TrimRight(part, "[]")
+		if name != "" {
+			segments = append(segments, name)
+		}
+		for i := 0; i < (len(part)-len(name))/2; i++ {
+			segments = append(segments, "[]")
+		}
+	}
+	return segments
+}
+
+// canonical rewrites an aliased path to the field it is reported as
+func canonical(path string) string {
+	for alias, field := range aliases {
+		if path == alias || strings.HasPrefix(path, alias+".") || strings.HasPrefix(path, alias+"[]") {
+			return field + path[len(alias):]
+		}
+	}
+	return path
+}
+
+// aliasesOf returns a reported path and every alias of it
+func aliasesOf(path string) []string {
+	paths := []string{path}
+	for alias, field := range aliases {
+		if path == field || strings.HasPrefix(path, field+".") || strings.HasPrefix(path, field+"[]") {
+			paths = append(paths, alias+path[len(field):])
+		}
+	}
+	return paths
+}
+
+func hasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[]") {
+			return true
+		}
+	}
+	return false
+}
+
+// readsPath reports whether a template reads the field at path: the field
+// itself, something inside it, or a value containing it as a whole
+func readsPath(reads []template.FieldRead, path string) bool {
+	field := splitPath(path)
+	for _, read := range reads {
+		segments := splitPath(canonical(read.Path))
+		switch {
+		case len(segments) >= len(field):
+			if matchSegments(segments[:len(field)], field) {
+				return true
+			}
+		case read.Deep:
+			if matchSegments(segments, field[:len(segments)]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSegments compares paths of equal length; [] matches any map key
+func matchSegments(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] && a[i] != "[]" && b[i] != "[]" {
+			return false
+		}
+	}
+	return true
+}
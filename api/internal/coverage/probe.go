@@ -0,0 +1,186 @@
+package coverage
+
+import "reflect"
+
+// probeText marks the values changed to find out whether a field is used
+const probeText = "coverage-probe"
+
+// perturb changes the field at the path segments in every list element and
+// map value it names, and reports whether anything was changed. Lists and
+// maps at the end of the path get a probe element. Nil pointers and empty
+// lists on the way are filled with a zero value holding the changed field,
+// so that fields of optional sections are probed too.
+func perturb(v reflect.Value, segments []string) bool {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			if !v.CanSet() {
+				return false
+			}
+			filled := reflect.New(v.Type().Elem())
+			if !perturb(filled.Elem(), segments) {
+				return false
+			}
+			v.Set(filled)
+			return true
+		}
+		return perturb(v.Elem(), segments)
+	case reflect.Interface:
+		if v.IsNil() {
+			if len(segments) > 0 {
+				return false
+			}
+			v.Set(reflect.ValueOf(probeText))
+			return true
+		}
+		// Values held in an interface cannot be set in place
+		inner := reflect.New(v.Elem().Type()).Elem()
+		inner.Set(v.Elem())
+		changed := perturb(inner, segments)
+		v.Set(inner)
+		return changed
+	}
+	if len(segments) == 0 {
+		return probe(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		field := v.FieldByName(segments[0])
+		return field.IsValid() && field.CanSet() && perturb(field, segments[1:])
+	case reflect.Slice:
+		if segments[0] != "[]" {
+			return false
+		}
+		if v.Len() == 0 {
+			element := reflect.New(v.Type().Elem()).Elem()
+			if !perturb(element, segments[1:]) {
+				return false
+			}
+			v.Set(reflect.Append(v, element))
+			return true
+		}
+		changed := false
+		for i := 0; i < v.Len(); i++ {
+			changed = perturb(v.Index(i), segments[1:]) || changed
+		}
+		return changed
+	case reflect.Map:
+		keys := v.MapKeys()
+		if segments[0] != "[]" {
+			keys = []reflect.Value{reflect.ValueOf(segments[0]).Convert(v.Type().Key())}
+		}
+		changed := false
+		for _, key := range keys {
+			value := v.MapIndex(key)
+			if !value.IsValid() {
+				continue
+			}
+			element := reflect.New(v.Type().Elem()).Elem()
+			element.Set(value)
+			if perturb(element, segments[1:]) {
+				v.SetMapIndex(key, element)
+				changed = true
+			}
+		}
+		return changed
+	}
+	return false
+}
+
+// probe changes a field's value: text is extended, flags are flipped,
+// numbers incremented, and lists and maps get an extra entry
+func probe(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		if v.String() == "" {
+			v.SetString(probeText)
+		} else {
+			v.SetString(v.String() + "-" + probeText)
+		}
+	case reflect.Bool:
+		v.SetBool(!v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(v.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(v.Uint() + 1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(v.Float() + 1)
+	case reflect.Slice:
+		element, ok := probeValue(v.Type().Elem())
+		if !ok {
+			return false
+		}
+		v.Set(reflect.Append(v, element))
+	case reflect.Map:
+		element, ok := probeValue(v.Type().Elem())
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return false
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(reflect.ValueOf(probeText).Convert(v.Type().Key()), element)
+	default:
+		return false
+	}
+	return true
+}
+
+// probeValue returns a new element for a list or map of type t
+func probeValue(t reflect.Type) (reflect.Value, bool) {
+	v := reflect.New(t).Elem()
+	if t.Kind() == reflect.Interface {
+		v.Set(reflect.ValueOf(probeText))
+		return v, true
+	}
+	return v, probe(v)
+}
+
+// clone deep-copies v, so that perturbing the copy leaves v unchanged
+func clone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(clone(v.Elem()))
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(clone(v.Elem()))
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if copied.Field(i).CanSet() {
+				copied.Field(i).Set(clone(v.Field(i)))
+			}
+		}
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(clone(v.Index(i)))
+		}
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), clone(iter.Value()))
+		}
+		return copied
+	}
+	return v
+}
@@ -0,0 +1,229 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+// Files returns a unified diff between the old and new content of an output,
+// or "" when they are equivalent. JSON and YAML are compared structurally:
+// both sides are normalized first so key order, formatting and comments are
+// not reported as changes.
+func Files(path string, old, new []byte) string {
+	oldNorm, oldOK := Normalize(path, old)
+	newNorm, newOK := Normalize(path, new)
+	if oldOK && newOK {
+		old, new = oldNorm, newNorm
+	}
+	return Unified("a/"+path, "b/"+path, old, new)
+}
+
+// Normalize returns the canonical form of JSON and YAML content with map keys
+// sorted. It reports false for other file types or content that fails to parse.
+func Normalize(path string, content []byte) ([]byte, bool) {
+	switch filepath.Ext(path) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		var v interface{}
+		if err := decoder.Decode(&v); err != nil {
+			return nil, false
+		}
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, false
+		}
+		return append(out, '\n'), true
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		var out bytes.Buffer
+		for documents := 0; ; documents++ {
+			var v interface{}
+			err := decoder.Decode(&v)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, false
+			}
+			data, err := yaml.Marshal(v)
+			if err != nil {
+				return nil, false
+			}
+			if documents > 0 {
+				out.WriteString("---\n")
+			}
+			out.Write(data)
+		}
+		return out.Bytes(), true
+	}
+	return nil, false
+}
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// Unified returns a unified diff of a and b, or "" when they are equal
+func Unified(oldName, newName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	ops := lineOps(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(ops); {
+		// Find the next change and the hunk around it
+		for start < len(ops) && ops[start].kind == opEqual {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		begin := start - contextLines
+		if begin < 0 {
+			begin = 0
+		}
+		// Extend the hunk while the next change is within 2*contextLines
+		lastChange := start
+		for end := start; end < len(ops); end++ {
+			if ops[end].kind != opEqual {
+				lastChange = end
+			} else if end-lastChange > 2*contextLines {
+				break
+			}
+		}
+		end := lastChange + 1 + contextLines
+		if end > len(ops) {
+			end = len(ops)
+		}
+		writeHunk(&out, ops, begin, end)
+		start = end
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []op, begin, end int) {
+	oldStart, newStart := 1, 1
+	for _, o := range ops[:begin] {
+		if o.kind != opInsert {
+			oldStart++
+		}
+		if o.kind != opDelete {
+			newStart++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, o := range ops[begin:end] {
+		if o.kind != opInsert {
+			oldCount++
+		}
+		if o.kind != opDelete {
+			newCount++
+		}
+	}
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, o := range ops[begin:end] {
+		prefix := " "
+		switch o.kind {
+		case opDelete:
+			prefix = "-"
+		case opInsert:
+			prefix = "+"
+		}
+		out.WriteString(prefix + o.line + "\n")
+	}
+}
+
+// lineOps computes a minimal edit script between a and b using the longest
+// common subsequence of lines, after stripping the common prefix and suffix
+func lineOps(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, op{opEqual, line})
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	lcs := make([][]int32, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			ops = append(ops, op{opEqual, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{opDelete, x[i]})
+			i++
+		default:
+			ops = append(ops, op{opInsert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		ops = append(ops, op{opDelete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		ops = append(ops, op{opInsert, y[j]})
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, op{opEqual, line})
+	}
+	return ops
+}
+
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
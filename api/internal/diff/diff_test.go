@@ -0,0 +1,44 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilesIgnoresKeyOrderInStructuredOutputs(t *testing.T) {
+	if patch := Files("provisioner.json", []byte(`{"b": 1, "a": [1, 2]}`), []byte("{\n  \"a\": [1, 2],\n  \"b\": 1\n}\n")); patch != "" {
+		t.Fatalf("expected no JSON diff, got:\n%s", patch)
+	}
+	if patch := Files("platform.yaml", []byte("# old\nb: 1\na: x\n"), []byte("a: x\nb: 1\n")); patch != "" {
+		t.Fatalf("expected no YAML diff, got:\n%s", patch)
+	}
+
+	patch := Files("platform.yaml", []byte("a: x\nb: 1\n"), []byte("b: 2\na: x\n"))
+	if !strings.Contains(patch, "-b: 1\n+b: 2\n") {
+		t.Fatalf("expected value change in diff, got:\n%s", patch)
+	}
+}
+
+func TestUnifiedHunks(t *testing.T) {
+	var old, new []string
+	for i := 1; i <= 20; i++ {
+		line := "line " + string(rune('a'+i))
+		old = append(old, line)
+		if i == 2 {
+			line = "changed"
+		}
+		new = append(new, line)
+	}
+	new = append(new, "appended")
+
+	patch := Unified("a/inventory.ini", "b/inventory.ini", []byte(strings.Join(old, "\n")+"\n"), []byte(strings.Join(new, "\n")+"\n"))
+	want := "--- a/inventory.ini\n+++ b/inventory.ini\n" +
+		"@@ -1,5 +1,5 @@\n line b\n-line c\n+changed\n line d\n line e\n line f\n" +
+		"@@ -18,3 +18,4 @@\n line s\n line t\n line u\n+appended\n"
+	if patch != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", patch, want)
+	}
+	if Unified("a", "b", []byte("same\n"), []byte("same\n")) != "" {
+		t.Fatalf("expected empty diff for identical content")
+	}
+}
@@ -0,0 +1,430 @@
+// Package kustomize generates the kustomization trees of the platform and
+// business modules when their deployment method is kustomize
+package kustomize
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/manifest"
+)
+
+// Kustomization API identifiers
+const (
+	APIVersion = "kustomize.config.k8s.io/v1beta1"
+	Kind       = "Kustomization"
+)
+
+// Kustomization is the subset of a kustomization.yaml the generator writes
+type Kustomization struct {
+	APIVersion  string       `yaml:"apiVersion"`
+	Kind        string       `yaml:"kind"`
+	Namespace   string       `yaml:"namespace,omitempty"`
+	Resources   []string     `yaml:"resources,omitempty"`
+	HelmGlobals *HelmGlobals `yaml:"helmGlobals,omitempty"`
+	HelmCharts  []HelmChart  `yaml:"helmCharts,omitempty"`
+	Images      []Image      `yaml:"images,omitempty"`
+	Replicas    []Replica    `yaml:"replicas,omitempty"`
+	Patches     []Patch      `yaml:"patches,omitempty"`
+}
+
+// HelmGlobals points the Helm inflator at a local chart directory
+type HelmGlobals struct {
+	ChartHome string `yaml:"chartHome"`
+}
+
+// HelmChart is a chart under HelmGlobals.ChartHome inflated by kustomize
+type HelmChart struct {
+	Name         string                 `yaml:"name"`
+	Version      string                 `yaml:"version,omitempty"`
+	ReleaseName  string                 `yaml:"releaseName"`
+	Namespace    string                 `yaml:"namespace"`
+	IncludeCRDs  bool                   `yaml:"includeCRDs"`
+	ValuesInline map[string]interface{} `yaml:"valuesInline,omitempty"`
+}
+
+// Image overrides the name or tag of a container image
+type Image struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+}
+
+// Replica overrides the replica count of a workload
+type Replica struct {
+	Name  string `yaml:"name"`
+	Count int    `yaml:"count"`
+}
+
+// Patch is an inline strategic merge patch applied to its target
+type Patch struct {
+	Target PatchTarget `yaml:"target"`
+	Patch  string      `yaml:"patch"`
+}
+
+// PatchTarget selects the resources a patch applies to
+type PatchTarget struct {
+	Kind string `yaml:"kind"`
+	Name string `yaml:"name"`
+}
+
+// Generator builds kustomization trees for an environment
+type Generator struct {
+	RepoRoot  string
+	OutputDir string
+	Header    string // provenance comment starting every file
+}
+
+// NewGenerator creates a generator writing under outputDir, with chart paths
+// resolved against repoRoot, starting files with header
+func NewGenerator(repoRoot, outputDir, header string) *Generator {
+	return &Generator{RepoRoot: repoRoot, OutputDir: outputDir, Header: header}
+}
+
+// module is a kustomization tree under one output directory: a root
+// kustomization listing the namespaces and one directory per stack or app
+type module struct {
+	dir        string
+	namespaces []string
+	metadata   map[string]map[string]interface{} // namespace labels and annotations, by namespace
+	entries    []entry
+}
+
+// entry is a stack or app kustomization, ordered by sync wave then name.
+// A stack with charts in several platform/stacks directories includes one
+// nested kustomization per directory, since a kustomization has a single
+// chart home.
+type entry struct {
+	name          string
+	syncWave      int
+	kustomization Kustomization
+	nested        []nested
+}
+
+type nested struct {
+	name          string
+	kustomization Kustomization
+}
+
+// Platform generates platform/kustomization.yaml and a kustomization per
+// enabled stack inflating the charts it lists, which are
+// platform/stacks/<dir>/charts/<chart> given as <dir>/<chart>. Stacks use
+// the namespace named after them, with _ replaced by -.
+// platform/environments/<env>.yaml may disable stacks and add namespace
+// labels and annotations.
+func (g *Generator) Platform(merged *config.MergedConfig) ([]manifest.File, error) {
+	overrides := merged.PlatformOverrides
+	stackOverrides := mapValue(overrides, "stacks")
+	namespaceOverrides := mapValue(overrides, "namespaces")
+
+	m := &module{dir: "platform", metadata: map[string]map[string]interface{}{}}
+	for name, stack := range merged.Stacks {
+		enabled := stack.Enabled
+		if value, ok := mapValue(stackOverrides, name)["enabled"].(bool); ok {
+			enabled = value
+		}
+		if !enabled {
+			continue
+		}
+		if len(stack.Charts) == 0 {
+			return nil, fmt.Errorf("stack %s is enabled but lists no charts", name)
+		}
+
+		namespace := strings.ReplaceAll(name, "_", "-")
+		charts, err := g.stackCharts(stack.Charts)
+		if err != nil {
+			return nil, fmt.Errorf("stack %s: %w", name, err)
+		}
+		dirs := make([]string, 0, len(charts))
+		for dir := range charts {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+
+		e := entry{name: name, syncWave: stack.SyncWave}
+		inflate := func(k *Kustomization, dir, output string) error {
+			home, err := g.relative(output, filepath.Join(g.RepoRoot, "platform", "stacks", dir, "charts"))
+			if err != nil {
+				return err
+			}
+			k.HelmGlobals = &HelmGlobals{ChartHome: home}
+			for _, chart := range charts[dir] {
+				k.HelmCharts = append(k.HelmCharts, HelmChart{
+					Name:        chart.name,
+					Version:     chart.version,
+					ReleaseName: chart.name,
+					Namespace:   namespace,
+					IncludeCRDs: true,
+				})
+			}
+			return nil
+		}
+		e.kustomization = Kustomization{APIVersion: APIVersion, Kind: Kind, Namespace: namespace}
+		if len(dirs) == 1 {
+			if err := inflate(&e.kustomization, dirs[0], path.Join(m.dir, name)); err != nil {
+				return nil, fmt.Errorf("stack %s: %w", name, err)
+			}
+		} else {
+			for _, dir := range dirs {
+				k := Kustomization{APIVersion: APIVersion, Kind: Kind, Namespace: namespace}
+				if err := inflate(&k, dir, path.Join(m.dir, name, dir)); err != nil {
+					return nil, fmt.Errorf("stack %s: %w", name, err)
+				}
+				e.kustomization.Resources = append(e.kustomization.Resources, dir)
+				e.nested = append(e.nested, nested{name: dir, kustomization: k})
+			}
+		}
+
+		m.addNamespace(namespace, mapValue(namespaceOverrides, namespace))
+		m.entries = append(m.entries, e)
+	}
+	return m.files(g.Header)
+}
+
+// Business generates business/kustomization.yaml and a kustomization per
+// enabled application. Helm sources are inflated with the application
+// values; kustomize and directory sources are included as resources.
+// business/environments/<env>.yaml may disable applications, move them to
+// another namespace and override their values, and add namespace labels
+// and annotations.
+func (g *Generator) Business(merged *config.MergedConfig) ([]manifest.File, error) {
+	m := &module{dir: "business", metadata: map[string]map[string]interface{}{}}
+	for _, app := range merged.Applications {
+		app, override, err := merged.ResolveApplication(app)
+		if err != nil {
+			return nil, fmt.Errorf("application %s: %w", app.Name, err)
+		}
+		if !app.Enabled {
+			continue
+		}
+
+		namespace := app.Namespace
+		if namespace == "" {
+			return nil, fmt.Errorf("application %s: no namespace", app.Name)
+		}
+		if app.Source.Path == "" {
+			return nil, fmt.Errorf("application %s: no source path", app.Name)
+		}
+
+		dir := path.Join(m.dir, app.Name)
+		source := filepath.Join(g.RepoRoot, filepath.FromSlash(app.Source.Path))
+		k := Kustomization{APIVersion: APIVersion, Kind: Kind, Namespace: namespace}
+		switch app.Source.Type {
+		case "helm":
+			home, err := g.relative(dir, filepath.Dir(source))
+			if err != nil {
+				return nil, fmt.Errorf("application %s: %w", app.Name, err)
+			}
+			version, err := chartVersion(source)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("application %s: %w", app.Name, err)
+			}
+			k.HelmGlobals = &HelmGlobals{ChartHome: home}
+			k.HelmCharts = []HelmChart{{
+				Name:         filepath.Base(source),
+				Version:      version,
+				ReleaseName:  app.Name,
+				Namespace:    namespace,
+				IncludeCRDs:  true,
+				ValuesInline: app.Values,
+			}}
+		case "kustomize", "directory":
+			resource, err := g.relative(dir, source)
+			if err != nil {
+				return nil, fmt.Errorf("application %s: %w", app.Name, err)
+			}
+			k.Resources = []string{resource}
+			k.Images, k.Replicas = workloadOverrides(app.Name, override)
+		default:
+			return nil, fmt.Errorf("application %s: unsupported source type: %s", app.Name, app.Source.Type)
+		}
+
+		create := true
+		namespaceConfig := mapValue(merged.NamespaceConfigs, namespace)
+		if value, ok := namespaceConfig["create"].(bool); ok {
+			create = value
+		}
+		if create {
+			m.addNamespace(namespace, namespaceConfig)
+		}
+		m.entries = append(m.entries, entry{name: app.Name, syncWave: app.Wave(), kustomization: k})
+	}
+	return m.files(g.Header)
+}
+
+// addNamespace records a namespace created by the module, with the labels
+// and annotations of its override patched in
+func (m *module) addNamespace(namespace string, override map[string]interface{}) {
+	if _, ok := m.metadata[namespace]; ok {
+		return
+	}
+	m.namespaces = append(m.namespaces, namespace)
+	metadata := map[string]interface{}{}
+	for _, key := range []string{"labels", "annotations"} {
+		if value := mapValue(override, key); len(value) > 0 {
+			metadata[key] = value
+		}
+	}
+	m.metadata[namespace] = metadata
+}
+
+// files encodes the root kustomization, the namespaces it creates and the
+// kustomization of every entry
+func (m *module) files(header string) ([]manifest.File, error) {
+	sort.Slice(m.entries, func(i, j int) bool {
+		if m.entries[i].syncWave != m.entries[j].syncWave {
+			return m.entries[i].syncWave < m.entries[j].syncWave
+		}
+		return m.entries[i].name < m.entries[j].name
+	})
+	sort.Strings(m.namespaces)
+
+	root := Kustomization{APIVersion: APIVersion, Kind: Kind}
+	var namespaces []interface{}
+	for _, namespace := range m.namespaces {
+		namespaces = append(namespaces, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": namespace},
+		})
+		if len(m.metadata[namespace]) == 0 {
+			continue
+		}
+		metadata := map[string]interface{}{"name": namespace}
+		for key, value := range m.metadata[namespace] {
+			metadata[key] = value
+		}
+		patch, err := manifest.Encode("", map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   metadata,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("encode %s namespace patch: %w", namespace, err)
+		}
+		root.Patches = append(root.Patches, Patch{
+			Target: PatchTarget{Kind: "Namespace", Name: namespace},
+			Patch:  string(patch),
+		})
+	}
+	if len(namespaces) > 0 {
+		root.Resources = append(root.Resources, "namespaces.yaml")
+	}
+	for _, e := range m.entries {
+		root.Resources = append(root.Resources, e.name)
+	}
+
+	var files []manifest.File
+	add := func(name string, documents ...interface{}) error {
+		content, err := manifest.Encode(header, documents...)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", name, err)
+		}
+		files = append(files, manifest.File{Path: path.Join(m.dir, name), Content: content})
+		return nil
+	}
+
+	if err := add("kustomization.yaml", root); err != nil {
+		return nil, err
+	}
+	if len(namespaces) > 0 {
+		if err := add("namespaces.yaml", namespaces...); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range m.entries {
+		if err := add(path.Join(e.name, "kustomization.yaml"), e.kustomization); err != nil {
+			return nil, err
+		}
+		for _, n := range e.nested {
+			if err := add(path.Join(e.name, n.name, "kustomization.yaml"), n.kustomization); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// relative returns target relative to the output directory dir, which is
+// slash-separated and relative to the environment output directory
+func (g *Generator) relative(dir, target string) (string, error) {
+	relative, err := filepath.Rel(filepath.Join(g.OutputDir, filepath.FromSlash(dir)), target)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", target, err)
+	}
+	return filepath.ToSlash(relative), nil
+}
+
+type chart struct {
+	name, version string
+}
+
+// stackCharts resolves the charts of a stack, given as <dir>/<chart>, to
+// the chart directories under platform/stacks/<dir>/charts, grouped by dir
+// in the order listed. Chart.yaml is optional; without it the chart has no
+// version.
+func (g *Generator) stackCharts(names []string) (map[string][]chart, error) {
+	charts := map[string][]chart{}
+	for _, name := range names {
+		parts := strings.Split(name, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("chart %q is not <dir>/<chart>", name)
+		}
+		dir := filepath.Join(g.RepoRoot, "platform", "stacks", parts[0], "charts", parts[1])
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("chart %s: %w", name, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("chart %s: %s is not a directory", name, dir)
+		}
+		version, err := chartVersion(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("chart %s: %w", name, err)
+		}
+		charts[parts[0]] = append(charts[parts[0]], chart{name: parts[1], version: version})
+	}
+	return charts, nil
+}
+
+// chartVersion reads the version from the Chart.yaml in dir
+func chartVersion(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return "", err
+	}
+	var metadata struct {
+		Version string `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(data, &metadata); err != nil {
+		return "", fmt.Errorf("parse %s: %w", filepath.Join(dir, "Chart.yaml"), err)
+	}
+	return metadata.Version, nil
+}
+
+// workloadOverrides returns the image and replica overrides of an app whose
+// manifests are not rendered from Helm values
+func workloadOverrides(name string, override config.AppOverride) ([]Image, []Replica) {
+	var images []Image
+	if image := override.Image; image != nil {
+		images = append(images, Image{Name: image.Repository, NewName: image.NewName(), NewTag: image.Tag})
+	}
+	var replicas []Replica
+	if override.Replicas != nil {
+		replicas = append(replicas, Replica{Name: name, Count: *override.Replicas})
+	}
+	return images, replicas
+}
+
+// mapValue returns m[key] if it is a map, and nil otherwise
+func mapValue(m map[string]interface{}, key string) map[string]interface{} {
+	value, _ := m[key].(map[string]interface{})
+	return value
+}
@@ -0,0 +1,233 @@
+package kustomize
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/manifest"
+)
+
+func wave(n int) *int { return &n }
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+// decodeFiles indexes generated files by path, checking each is valid YAML
+func decodeFiles(t *testing.T, files []manifest.File) map[string]string {
+	t.Helper()
+	byPath := map[string]string{}
+	for _, file := range files {
+		decoder := yaml.NewDecoder(strings.NewReader(string(file.Content)))
+		for {
+			var document interface{}
+			if err := decoder.Decode(&document); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				t.Fatalf("%s: invalid YAML: %v", file.Path, err)
+			}
+		}
+		byPath[file.Path] = string(file.Content)
+	}
+	return byPath
+}
+
+func decodeKustomization(t *testing.T, files map[string]string, path string) Kustomization {
+	t.Helper()
+	content, ok := files[path]
+	if !ok {
+		t.Fatalf("%s not generated", path)
+	}
+	var k Kustomization
+	if err := yaml.Unmarshal([]byte(content), &k); err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	if k.APIVersion != APIVersion || k.Kind != Kind {
+		t.Fatalf("%s: unexpected apiVersion/kind %s/%s", path, k.APIVersion, k.Kind)
+	}
+	return k
+}
+
+func TestPlatformInflatesStackChartsInWaveOrder(t *testing.T) {
+	repo := t.TempDir()
+	stacks := filepath.Join(repo, "platform", "stacks")
+	writeFile(t, filepath.Join(stacks, "monitoring", "charts", "gatus", "Chart.yaml"), "name: pn-gatus\nversion: 1.2.3\n")
+	writeFile(t, filepath.Join(stacks, "monitoring", "charts", "grafana", "templates", "deployment.yaml"), "kind: Deployment\n")
+	writeFile(t, filepath.Join(stacks, "monitoring", "charts", "oneuptime", "Chart.yaml"), "name: oneuptime\nversion: 7.0.0\n")
+	writeFile(t, filepath.Join(stacks, "infrastructure", "charts", "sealed-secrets", "Chart.yaml"), "name: sealed-secrets\nversion: 2.0.0\n")
+	writeFile(t, filepath.Join(stacks, "security", "charts", "external-secrets", "Chart.yaml"), "name: external-secrets\nversion: 0.9.0\n")
+
+	merged := &config.MergedConfig{
+		ConfigPackage: "core",
+		Environment:   "development",
+		Stacks: map[string]config.StackConfig{
+			"monitoring":         {Enabled: true, SyncWave: 0, Charts: []string{"monitoring/gatus", "monitoring/grafana"}},
+			"secrets_management": {Enabled: true, SyncWave: -4, Charts: []string{"security/external-secrets", "infrastructure/sealed-secrets"}},
+			"logging":            {Enabled: true, SyncWave: 1},
+			"backup":             {Enabled: false},
+		},
+		PlatformOverrides: map[string]interface{}{
+			"stacks":     map[string]interface{}{"logging": map[string]interface{}{"enabled": false}},
+			"namespaces": map[string]interface{}{"monitoring": map[string]interface{}{"labels": map[string]interface{}{"team": "sre"}}},
+		},
+	}
+	files, err := NewGenerator(repo, filepath.Join(repo, "api", "outputs", "development"), "").Platform(merged)
+	if err != nil {
+		t.Fatalf("Platform: %v", err)
+	}
+	byPath := decodeFiles(t, files)
+
+	root := decodeKustomization(t, byPath, "platform/kustomization.yaml")
+	if want := []string{"namespaces.yaml", "secrets_management", "monitoring"}; !reflect.DeepEqual(root.Resources, want) {
+		t.Fatalf("root resources = %v, want %v", root.Resources, want)
+	}
+	if len(root.Patches) != 1 || root.Patches[0].Target != (PatchTarget{Kind: "Namespace", Name: "monitoring"}) || !strings.Contains(root.Patches[0].Patch, "team: sre") {
+		t.Fatalf("expected a label patch for the monitoring namespace, got %+v", root.Patches)
+	}
+	if !strings.Contains(byPath["platform/namespaces.yaml"], "name: secrets-management") {
+		t.Fatalf("namespaces.yaml does not create secrets-management:\n%s", byPath["platform/namespaces.yaml"])
+	}
+
+	// Only the listed charts are inflated; Chart.yaml only supplies the version
+	monitoring := decodeKustomization(t, byPath, "platform/monitoring/kustomization.yaml")
+	if monitoring.Namespace != "monitoring" {
+		t.Fatalf("monitoring namespace = %q", monitoring.Namespace)
+	}
+	if monitoring.HelmGlobals == nil || monitoring.HelmGlobals.ChartHome != "../../../../../platform/stacks/monitoring/charts" {
+		t.Fatalf("unexpected helmGlobals %+v", monitoring.HelmGlobals)
+	}
+	want := []HelmChart{
+		{Name: "gatus", Version: "1.2.3", ReleaseName: "gatus", Namespace: "monitoring", IncludeCRDs: true},
+		{Name: "grafana", ReleaseName: "grafana", Namespace: "monitoring", IncludeCRDs: true},
+	}
+	if !reflect.DeepEqual(monitoring.HelmCharts, want) {
+		t.Fatalf("helmCharts = %+v, want %+v", monitoring.HelmCharts, want)
+	}
+
+	// Charts from two directories get a kustomization per chart home
+	secrets := decodeKustomization(t, byPath, "platform/secrets_management/kustomization.yaml")
+	if secrets.HelmGlobals != nil || !reflect.DeepEqual(secrets.Resources, []string{"infrastructure", "security"}) {
+		t.Fatalf("unexpected secrets_management kustomization %+v", secrets)
+	}
+	infrastructure := decodeKustomization(t, byPath, "platform/secrets_management/infrastructure/kustomization.yaml")
+	if infrastructure.Namespace != "secrets-management" || infrastructure.HelmGlobals == nil || infrastructure.HelmGlobals.ChartHome != "../../../../../../platform/stacks/infrastructure/charts" {
+		t.Fatalf("unexpected infrastructure kustomization %+v", infrastructure)
+	}
+	want = []HelmChart{{Name: "sealed-secrets", Version: "2.0.0", ReleaseName: "sealed-secrets", Namespace: "secrets-management", IncludeCRDs: true}}
+	if !reflect.DeepEqual(infrastructure.HelmCharts, want) {
+		t.Fatalf("helmCharts = %+v, want %+v", infrastructure.HelmCharts, want)
+	}
+	security := decodeKustomization(t, byPath, "platform/secrets_management/security/kustomization.yaml")
+	if len(security.HelmCharts) != 1 || security.HelmCharts[0].Name != "external-secrets" {
+		t.Fatalf("unexpected security helmCharts %+v", security.HelmCharts)
+	}
+	if _, ok := byPath["platform/logging/kustomization.yaml"]; ok {
+		t.Fatalf("logging is disabled by the environment override but was generated")
+	}
+}
+
+func TestPlatformRejectsStacksWithoutCharts(t *testing.T) {
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, "platform", "stacks", "infrastructure", "charts", "metallb", "Chart.yaml"), "name: metallb\nversion: 0.14.0\n")
+
+	tests := []struct {
+		name  string
+		stack config.StackConfig
+		want  string
+	}{
+		{name: "no charts", stack: config.StackConfig{Enabled: true}, want: "stack ingress is enabled but lists no charts"},
+		{name: "missing chart", stack: config.StackConfig{Enabled: true, Charts: []string{"infrastructure/traefik"}}, want: "stack ingress: chart infrastructure/traefik"},
+		{name: "malformed chart", stack: config.StackConfig{Enabled: true, Charts: []string{"metallb"}}, want: `stack ingress: chart "metallb" is not <dir>/<chart>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := &config.MergedConfig{Stacks: map[string]config.StackConfig{"ingress": test.stack}}
+			_, err := NewGenerator(repo, filepath.Join(repo, "api", "outputs", "development"), "").Platform(merged)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("expected an error containing %q, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestBusinessAppliesAppOverrides(t *testing.T) {
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, "business", "apps", "docs", "chart", "Chart.yaml"), "name: docs\nversion: 0.1.0\n")
+
+	merged := &config.MergedConfig{
+		ConfigPackage: "core",
+		Environment:   "staging",
+		Applications: []config.Application{
+			{Name: "docs", Enabled: true, Namespace: "docs", SyncWave: wave(1), Source: config.ApplicationSource{Type: "helm", Path: "business/apps/docs/chart"},
+				Values: map[string]interface{}{"replicas": 1, "image": map[string]interface{}{"repository": "nginx", "tag": "alpine"}}},
+			{Name: "api", Enabled: true, Namespace: "apps", Source: config.ApplicationSource{Type: "kustomize", Path: "business/apps/api/overlays"}},
+			{Name: "legacy", Enabled: true, Namespace: "apps", Source: config.ApplicationSource{Type: "directory", Path: "business/apps/legacy"}},
+		},
+		AppOverrides: map[string]interface{}{
+			"docs":   map[string]interface{}{"namespace": "docs-staging", "replicas": 3, "image": map[string]interface{}{"tag": "1.25"}},
+			"api":    map[string]interface{}{"replicas": 2, "image": map[string]interface{}{"registry": "registry.local", "repository": "api", "tag": "v2"}},
+			"legacy": map[string]interface{}{"enabled": false},
+		},
+		NamespaceConfigs: map[string]interface{}{
+			"apps": map[string]interface{}{"annotations": map[string]interface{}{"owner": "apps-team"}},
+		},
+	}
+	files, err := NewGenerator(repo, filepath.Join(repo, "api", "outputs", "staging"), "").Business(merged)
+	if err != nil {
+		t.Fatalf("Business: %v", err)
+	}
+	byPath := decodeFiles(t, files)
+
+	root := decodeKustomization(t, byPath, "business/kustomization.yaml")
+	if want := []string{"namespaces.yaml", "api", "docs"}; !reflect.DeepEqual(root.Resources, want) {
+		t.Fatalf("root resources = %v, want %v", root.Resources, want)
+	}
+	if len(root.Patches) != 1 || root.Patches[0].Target.Name != "apps" || !strings.Contains(root.Patches[0].Patch, "owner: apps-team") {
+		t.Fatalf("expected an annotation patch for the apps namespace, got %+v", root.Patches)
+	}
+
+	docs := decodeKustomization(t, byPath, "business/docs/kustomization.yaml")
+	if docs.Namespace != "docs-staging" || docs.HelmGlobals.ChartHome != "../../../../../business/apps/docs" {
+		t.Fatalf("unexpected docs kustomization %+v", docs)
+	}
+	wantValues := map[string]interface{}{"replicas": 3, "image": map[string]interface{}{"repository": "nginx", "tag": "1.25"}}
+	if len(docs.HelmCharts) != 1 || docs.HelmCharts[0].Name != "chart" || docs.HelmCharts[0].Version != "0.1.0" || !reflect.DeepEqual(docs.HelmCharts[0].ValuesInline, wantValues) {
+		t.Fatalf("unexpected docs helmCharts %+v", docs.HelmCharts)
+	}
+
+	api := decodeKustomization(t, byPath, "business/api/kustomization.yaml")
+	if !reflect.DeepEqual(api.Resources, []string{"../../../../../business/apps/api/overlays"}) {
+		t.Fatalf("api resources = %v", api.Resources)
+	}
+	if !reflect.DeepEqual(api.Images, []Image{{Name: "api", NewName: "registry.local/api", NewTag: "v2"}}) || !reflect.DeepEqual(api.Replicas, []Replica{{Name: "api", Count: 2}}) {
+		t.Fatalf("unexpected api overrides: images %+v, replicas %+v", api.Images, api.Replicas)
+	}
+	if _, ok := byPath["business/legacy/kustomization.yaml"]; ok {
+		t.Fatalf("legacy is disabled by the environment override but was generated")
+	}
+}
+
+func TestBusinessRejectsUnsupportedSourceType(t *testing.T) {
+	merged := &config.MergedConfig{Applications: []config.Application{
+		{Name: "docs", Enabled: true, Namespace: "docs", Source: config.ApplicationSource{Type: "jsonnet", Path: "docs"}},
+	}}
+	_, err := NewGenerator(t.TempDir(), t.TempDir(), "").Business(merged)
+	if err == nil || !strings.Contains(err.Error(), "unsupported source type: jsonnet") {
+		t.Fatalf("expected an unsupported source type error, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+// Package manifest holds the YAML files that the kustomize and argocd
+// generators build in Go rather than from templates
+package manifest
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a generated file. Path is slash-separated and relative to the
+// environment output directory.
+type File struct {
+	Path    string
+	Content []byte
+}
+
+// Encode encodes documents as a YAML stream indented by two spaces, after
+// header. The header comes from template.Renderer.Header so that generated
+// files carry the same provenance comment as rendered templates.
+func Encode(header string, documents ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,73 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Change kinds reported when a recorded file no longer matches its checksum
+const (
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+)
+
+// Change is a recorded file whose content on disk differs from metadata
+type Change struct {
+	Name string // key in files, empty for inputs
+	Path string
+	Kind string
+}
+
+// Modified returns the outputs whose content on disk no longer matches the
+// checksum recorded at generation, i.e. files edited or deleted by hand.
+// Files recorded without a checksum (schema version 0) cannot be checked and
+// are skipped.
+func (m *Metadata) Modified(repoRoot string) ([]Change, error) {
+	var changes []Change
+	for name, file := range m.Files {
+		change, err := compareFile(repoRoot, file)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			change.Name = name
+			changes = append(changes, *change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// ChangedInputs returns the inputs whose content differs from the checksum
+// recorded at generation
+func (m *Metadata) ChangedInputs(repoRoot string) ([]Change, error) {
+	var changes []Change
+	for _, file := range m.Inputs {
+		change, err := compareFile(repoRoot, file)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+	return changes, nil
+}
+
+func compareFile(repoRoot string, file File) (*Change, error) {
+	if file.SHA256 == "" {
+		return nil, nil
+	}
+	sum, err := HashFile(filepath.Join(repoRoot, filepath.FromSlash(file.Path)))
+	if os.IsNotExist(err) {
+		return &Change{Path: file.Path, Kind: ChangeDeleted}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sum != file.SHA256 {
+		return &Change{Path: file.Path, Kind: ChangeModified}, nil
+	}
+	return nil, nil
+}
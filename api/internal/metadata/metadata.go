@@ -0,0 +1,170 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"pn-infra/api/internal/plan"
+)
+
+// SchemaVersion is the metadata.json schema written by this CLI. Files
+// without a schemaVersion are read as version 0 (absolute paths, no hashes).
+const SchemaVersion = 1
+
+// FileName is the metadata file at the root of an environment's outputs
+const FileName = "metadata.json"
+
+// Metadata describes one generation of an environment's outputs
+type Metadata struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	Environment   string              `json:"environment"`
+	ConfigPackage Package             `json:"configPackage"`
+	CLIVersion    string              `json:"cliVersion"`
+	GeneratedAt   string              `json:"generatedAt"`
+	MasterConfig  Choices             `json:"masterConfig"`
+	Files         map[string]File     `json:"files"`
+	Templates     map[string]Template `json:"templates,omitempty"`
+	Inputs        []File              `json:"inputs"`
+	Hosts         []plan.HostSnapshot `json:"hosts"`
+}
+
+// Package identifies the config package an environment was generated from
+type Package struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+}
+
+// Choices are the master config selections the outputs were generated for
+type Choices struct {
+	Platform             string `json:"platform"`
+	Provider             string `json:"provider"`
+	Format               string `json:"format,omitempty"`
+	Orchestrator         string `json:"orchestrator"`
+	OrchestratorProvider string `json:"orchestratorProvider,omitempty"`
+	PlatformDeployment   string `json:"platformDeployment,omitempty"`
+	BusinessDeployment   string `json:"businessDeployment,omitempty"`
+}
+
+// File is a generated output or consumed input. Path is relative to the
+// repository root and uses forward slashes.
+type File struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Template records where an output's template was found on the template
+// search path, relative to the repository root
+type Template struct {
+	Path      string   `json:"path"`
+	Origin    string   `json:"origin"`              // environment, package or builtin
+	Overrides []string `json:"overrides,omitempty"` // define-only files layered on top
+}
+
+// Hash returns the hex-encoded SHA-256 of content
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashFile returns the hex-encoded SHA-256 of a file's content
+func HashFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return Hash(content), nil
+}
+
+// RepoPath converts an absolute path into a slash-separated path relative to
+// repoRoot, as recorded in metadata
+func RepoPath(repoRoot, path string) (string, error) {
+	relative, err := filepath.Rel(repoRoot, path)
+	if err != nil {
+		return "", err
+	}
+	if relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the repository %s", path, repoRoot)
+	}
+	return filepath.ToSlash(relative), nil
+}
+
+// Inputs hashes the given input files, recording them sorted by path.
+// Duplicate paths are recorded once.
+func Inputs(repoRoot string, paths []string) ([]File, error) {
+	seen := make(map[string]bool, len(paths))
+	files := make([]File, 0, len(paths))
+	for _, path := range paths {
+		relative, err := RepoPath(repoRoot, path)
+		if err != nil {
+			return nil, err
+		}
+		if seen[relative] {
+			continue
+		}
+		seen[relative] = true
+		sum, err := HashFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("hash input %s: %w", relative, err)
+		}
+		files = append(files, File{Path: relative, SHA256: sum})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// Read loads a metadata.json file. Version 0 files, with absolute output paths
+// and no hashes, are converted to the current types with empty hashes.
+func Read(path string) (*Metadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read metadata %s: %w", path, err)
+	}
+
+	var header struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("parse metadata %s: %w", path, err)
+	}
+
+	switch header.SchemaVersion {
+	case 0:
+		var legacy struct {
+			Environment   string              `json:"environment"`
+			ConfigPackage Package             `json:"configPackage"`
+			GeneratedAt   string              `json:"generatedAt"`
+			MasterConfig  Choices             `json:"masterConfig"`
+			Files         map[string]string   `json:"files"`
+			Hosts         []plan.HostSnapshot `json:"hosts"`
+		}
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return nil, fmt.Errorf("parse metadata %s: %w", path, err)
+		}
+		m := &Metadata{
+			Environment:   legacy.Environment,
+			ConfigPackage: legacy.ConfigPackage,
+			GeneratedAt:   legacy.GeneratedAt,
+			MasterConfig:  legacy.MasterConfig,
+			Files:         make(map[string]File, len(legacy.Files)),
+			Hosts:         legacy.Hosts,
+		}
+		for name, file := range legacy.Files {
+			m.Files[name] = File{Path: file}
+		}
+		return m, nil
+	case SchemaVersion:
+		var m Metadata
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("parse metadata %s: %w", path, err)
+		}
+		return &m, nil
+	default:
+		return nil, fmt.Errorf("metadata %s has schema version %d; this CLI supports up to %d", path, header.SchemaVersion, SchemaVersion)
+	}
+}
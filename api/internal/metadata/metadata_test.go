@@ -0,0 +1,101 @@
+package metadata
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCurrentSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	written := Metadata{
+		SchemaVersion: SchemaVersion,
+		Environment:   "development",
+		ConfigPackage: Package{ID: "core", Version: "v0.2.0"},
+		Files:         map[string]File{"platform": {Path: "api/outputs/development/platform.yaml", SHA256: Hash([]byte("a: 1\n"))}},
+	}
+	data, err := json.Marshal(written)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	read, err := Read(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if read.ConfigPackage.Version != "v0.2.0" || read.Files["platform"] != written.Files["platform"] {
+		t.Fatalf("unexpected metadata: %+v", read)
+	}
+}
+
+func TestReadLegacyAndFutureSchemas(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "legacy.json")
+	os.WriteFile(legacy, []byte(`{"environment":"development","files":{"platform":"/home/user/pn-infra/api/outputs/development/platform.yaml"}}`), 0o644)
+	read, err := Read(legacy)
+	if err != nil {
+		t.Fatalf("read legacy: %v", err)
+	}
+	if read.SchemaVersion != 0 || read.Files["platform"].Path != "/home/user/pn-infra/api/outputs/development/platform.yaml" {
+		t.Fatalf("unexpected legacy metadata: %+v", read)
+	}
+
+	future := filepath.Join(dir, "future.json")
+	os.WriteFile(future, []byte(`{"schemaVersion": 99}`), 0o644)
+	if _, err := Read(future); err == nil {
+		t.Fatalf("expected unsupported schema error")
+	}
+}
+
+func TestInputsAreRepoRelativeAndSorted(t *testing.T) {
+	repo := t.TempDir()
+	for _, name := range []string{"b.yaml", "a.yaml"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	inputs, err := Inputs(repo, []string{filepath.Join(repo, "b.yaml"), filepath.Join(repo, "a.yaml"), filepath.Join(repo, "b.yaml")})
+	if err != nil {
+		t.Fatalf("inputs: %v", err)
+	}
+	if len(inputs) != 2 || inputs[0].Path != "a.yaml" || inputs[0].SHA256 != Hash([]byte("a.yaml")) {
+		t.Fatalf("unexpected inputs: %+v", inputs)
+	}
+	if _, err := RepoPath(repo, filepath.Join(filepath.Dir(repo), "elsewhere")); err == nil {
+		t.Fatalf("expected path outside the repository to be rejected")
+	}
+}
+
+func TestModifiedReportsEditedAndDeletedOutputs(t *testing.T) {
+	repo := t.TempDir()
+	write := func(name, content string) File {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return File{Path: name, SHA256: Hash([]byte(content))}
+	}
+	m := Metadata{Files: map[string]File{
+		"platform": write("platform.yaml", "a: 1\n"),
+		"business": write("business.yaml", "b: 1\n"),
+		"kind":     write("kind.yaml", "c: 1\n"),
+		"legacy":   {Path: "legacy.yaml"},
+	}}
+	write("platform.yaml", "a: 2\n")
+	os.Remove(filepath.Join(repo, "business.yaml"))
+
+	changes, err := m.Modified(repo)
+	if err != nil {
+		t.Fatalf("modified: %v", err)
+	}
+	want := []Change{
+		{Name: "business", Path: "business.yaml", Kind: ChangeDeleted},
+		{Name: "platform", Path: "platform.yaml", Kind: ChangeModified},
+	}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Fatalf("changes = %+v, want %+v", changes, want)
+	}
+}
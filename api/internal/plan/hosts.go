@@ -0,0 +1,113 @@
+package plan
+
+import (
+	"sort"
+
+	"pn-infra/api/internal/config"
+)
+
+// ChangeKind classifies how a host differs between two generations
+type ChangeKind string
+
+const (
+	HostAdded       ChangeKind = "added"
+	HostRemoved     ChangeKind = "removed"
+	HostResized     ChangeKind = "resized"
+	HostRoleChanged ChangeKind = "role-changed"
+)
+
+// HostSnapshot is the subset of a host definition recorded in metadata.json
+// so the next generation can detect scale-out and scale-in
+type HostSnapshot struct {
+	Name   string   `json:"name"`
+	Role   string   `json:"role"`
+	IP     string   `json:"ip"`
+	CPU    int      `json:"cpu"`
+	Memory int      `json:"memory"`
+	Disk   int      `json:"disk"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// HostChange describes a single host that differs between generations
+type HostChange struct {
+	Host     string        `json:"host"`
+	Kind     ChangeKind    `json:"kind"`
+	Previous *HostSnapshot `json:"previous,omitempty"`
+	Current  *HostSnapshot `json:"current,omitempty"`
+}
+
+// Snapshot converts host definitions into their recorded form
+func Snapshot(hosts []config.Host) []HostSnapshot {
+	snapshots := make([]HostSnapshot, 0, len(hosts))
+	for _, h := range hosts {
+		groups := append([]string(nil), h.Groups...)
+		sort.Strings(groups)
+		snapshots = append(snapshots, HostSnapshot{
+			Name:   h.Name,
+			Role:   h.Role,
+			IP:     h.IP,
+			CPU:    h.CPU,
+			Memory: h.Memory,
+			Disk:   h.Disk,
+			Groups: groups,
+		})
+	}
+	return snapshots
+}
+
+// DiffHosts compares the previous and current host sets by name.
+// A host whose role or groups changed is reported as role-changed even if it
+// was also resized, since re-joining the node supersedes the resize.
+func DiffHosts(previous, current []HostSnapshot) []HostChange {
+	prevByName := make(map[string]HostSnapshot, len(previous))
+	for _, h := range previous {
+		prevByName[h.Name] = h
+	}
+	currByName := make(map[string]HostSnapshot, len(current))
+	for _, h := range current {
+		currByName[h.Name] = h
+	}
+
+	var changes []HostChange
+	for _, curr := range current {
+		curr := curr
+		prev, ok := prevByName[curr.Name]
+		if !ok {
+			changes = append(changes, HostChange{Host: curr.Name, Kind: HostAdded, Current: &curr})
+			continue
+		}
+		switch {
+		case prev.Role != curr.Role || !sameGroups(prev.Groups, curr.Groups):
+			changes = append(changes, HostChange{Host: curr.Name, Kind: HostRoleChanged, Previous: &prev, Current: &curr})
+		case prev.CPU != curr.CPU || prev.Memory != curr.Memory || prev.Disk != curr.Disk:
+			changes = append(changes, HostChange{Host: curr.Name, Kind: HostResized, Previous: &prev, Current: &curr})
+		}
+	}
+	for _, prev := range previous {
+		prev := prev
+		if _, ok := currByName[prev.Name]; !ok {
+			changes = append(changes, HostChange{Host: prev.Name, Kind: HostRemoved, Previous: &prev})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Host < changes[j].Host
+	})
+	return changes
+}
+
+func sameGroups(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package plan
+
+import (
+	"sort"
+	"strings"
+)
+
+// Operation is a single Kubespray playbook run required to converge the
+// cluster with the regenerated inventory
+type Operation struct {
+	Order     int               `json:"order"`
+	Playbook  string            `json:"playbook"`
+	Limit     []string          `json:"limit,omitempty"`
+	ExtraVars map[string]string `json:"extraVars,omitempty"`
+	Inventory string            `json:"inventory"` // relative to the output directory
+	Reason    string            `json:"reason"`
+	Hosts     []string          `json:"hosts"`
+}
+
+// OperationsPlan is written to operations.json alongside the inventory
+type OperationsPlan struct {
+	Environment string       `json:"environment"`
+	Changes     []HostChange `json:"changes"`
+	Operations  []Operation  `json:"operations"`
+
+	// AppliedHosts are the hosts the cluster runs until the plan is applied.
+	// Generations plan against them rather than the last generated hosts
+	// while the plan is pending.
+	AppliedHosts []HostSnapshot `json:"appliedHosts,omitempty"`
+}
+
+// Inventories an operation runs against, relative to the output directory.
+// The previous inventory lists AppliedHosts and is written with every
+// pending plan, so removed nodes stay addressable.
+const (
+	PreviousInventory = "kubespray/inventory.previous.ini"
+	CurrentInventory  = "kubespray/inventory.ini"
+)
+
+// BuildOperations turns host changes into an ordered list of Kubespray runs.
+//
+// Scale-out happens before scale-in so workloads always have somewhere to go:
+// control plane and etcd additions first (cluster.yml, scale.yml cannot add
+// them), then worker additions (scale.yml), then resized hosts (facts.yml
+// after the infrastructure change), and node removals (remove-node.yml) last.
+// A role change is modelled as a removal followed by a re-add.
+func BuildOperations(environment string, changes []HostChange) *OperationsPlan {
+	plan := &OperationsPlan{
+		Environment: environment,
+		Changes:     changes,
+		Operations:  []Operation{},
+	}
+	if plan.Changes == nil {
+		plan.Changes = []HostChange{}
+	}
+
+	var controlPlaneAdds, workerAdds, resized, removals, rejoins []string
+	for _, change := range changes {
+		switch change.Kind {
+		case HostAdded:
+			if isControlPlane(change.Current) {
+				controlPlaneAdds = append(controlPlaneAdds, change.Host)
+			} else {
+				workerAdds = append(workerAdds, change.Host)
+			}
+		case HostResized:
+			resized = append(resized, change.Host)
+		case HostRemoved:
+			removals = append(removals, change.Host)
+		case HostRoleChanged:
+			rejoins = append(rejoins, change.Host)
+			if isControlPlane(change.Current) {
+				controlPlaneAdds = append(controlPlaneAdds, change.Host)
+			} else {
+				workerAdds = append(workerAdds, change.Host)
+			}
+		}
+	}
+
+	// Role changes must leave the cluster before they can re-join in their
+	// new role, so their removal precedes every scale-out step.
+	if len(rejoins) > 0 {
+		plan.add(Operation{
+			Playbook:  "remove-node.yml",
+			ExtraVars: map[string]string{"node": strings.Join(sorted(rejoins), ",")},
+			Inventory: PreviousInventory,
+			Reason:    "role changed; node must leave the cluster before re-joining",
+			Hosts:     sorted(rejoins),
+		})
+	}
+	if len(controlPlaneAdds) > 0 {
+		plan.add(Operation{
+			Playbook:  "cluster.yml",
+			Limit:     []string{"etcd", "kube_control_plane"},
+			ExtraVars: map[string]string{"ignore_assert_errors": "yes"},
+			Inventory: CurrentInventory,
+			Reason:    "control plane or etcd host added",
+			Hosts:     sorted(controlPlaneAdds),
+		})
+	}
+	if len(workerAdds) > 0 {
+		plan.add(Operation{
+			Playbook:  "scale.yml",
+			Limit:     sorted(workerAdds),
+			Inventory: CurrentInventory,
+			Reason:    "worker host added",
+			Hosts:     sorted(workerAdds),
+		})
+	}
+	if len(resized) > 0 {
+		plan.add(Operation{
+			Playbook:  "facts.yml",
+			Limit:     sorted(resized),
+			Inventory: CurrentInventory,
+			Reason:    "host resized; drain before the infrastructure change and refresh facts after",
+			Hosts:     sorted(resized),
+		})
+	}
+	if len(removals) > 0 {
+		plan.add(Operation{
+			Playbook:  "remove-node.yml",
+			ExtraVars: map[string]string{"node": strings.Join(sorted(removals), ",")},
+			Inventory: PreviousInventory,
+			Reason:    "host removed; run against the previous inventory so the node is still addressable",
+			Hosts:     sorted(removals),
+		})
+	}
+
+	return plan
+}
+
+// Empty reports whether the plan requires no playbook runs
+func (p *OperationsPlan) Empty() bool {
+	return len(p.Operations) == 0
+}
+
+// Pending reports whether the plan still has to be run: it requires
+// playbook runs and records the hosts it was planned against
+func (p *OperationsPlan) Pending() bool {
+	return !p.Empty() && p.AppliedHosts != nil
+}
+
+func (p *OperationsPlan) add(op Operation) {
+	op.Order = len(p.Operations) + 1
+	p.Operations = append(p.Operations, op)
+}
+
+func isControlPlane(h *HostSnapshot) bool {
+	if h == nil {
+		return false
+	}
+	return contains(h.Groups, "kube_control_plane") || contains(h.Groups, "etcd")
+}
+
+func contains(items []string, needle string) bool {
+	for _, item := range items {
+		if item == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func sorted(items []string) []string {
+	out := append([]string(nil), items...)
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,79 @@
+package plan
+
+import (
+	"testing"
+
+	"pn-infra/api/internal/config"
+)
+
+func TestDiffHostsClassifiesChanges(t *testing.T) {
+	previous := Snapshot([]config.Host{
+		{Name: "master-01", Role: "k8s-master", CPU: 4, Memory: 8192, Disk: 100, Groups: []string{"kube_control_plane", "etcd"}},
+		{Name: "worker-01", Role: "k8s-worker", CPU: 4, Memory: 16384, Disk: 200, Groups: []string{"kube_node"}},
+		{Name: "worker-02", Role: "k8s-worker", CPU: 4, Memory: 16384, Disk: 200, Groups: []string{"kube_node"}},
+		{Name: "worker-03", Role: "k8s-worker", CPU: 4, Memory: 16384, Disk: 200, Groups: []string{"kube_node"}},
+	})
+	current := Snapshot([]config.Host{
+		{Name: "master-01", Role: "k8s-master", CPU: 4, Memory: 8192, Disk: 100, Groups: []string{"etcd", "kube_control_plane"}},
+		{Name: "worker-01", Role: "k8s-worker", CPU: 8, Memory: 16384, Disk: 200, Groups: []string{"kube_node"}},
+		{Name: "worker-02", Role: "k8s-master", CPU: 4, Memory: 16384, Disk: 200, Groups: []string{"kube_control_plane"}},
+		{Name: "worker-04", Role: "k8s-worker", CPU: 4, Memory: 16384, Disk: 200, Groups: []string{"kube_node"}},
+	})
+
+	changes := DiffHosts(previous, current)
+	want := map[string]ChangeKind{
+		"worker-01": HostResized,
+		"worker-02": HostRoleChanged,
+		"worker-03": HostRemoved,
+		"worker-04": HostAdded,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %d: %+v", len(want), len(changes), changes)
+	}
+	for _, change := range changes {
+		if want[change.Host] != change.Kind {
+			t.Fatalf("host %s: expected %s, got %s", change.Host, want[change.Host], change.Kind)
+		}
+	}
+}
+
+func TestBuildOperationsOrdersScaleOutBeforeScaleIn(t *testing.T) {
+	changes := []HostChange{
+		{Host: "worker-03", Kind: HostRemoved, Previous: &HostSnapshot{Name: "worker-03", Groups: []string{"kube_node"}}},
+		{Host: "worker-04", Kind: HostAdded, Current: &HostSnapshot{Name: "worker-04", Groups: []string{"kube_node"}}},
+		{Host: "master-02", Kind: HostAdded, Current: &HostSnapshot{Name: "master-02", Groups: []string{"kube_control_plane", "etcd"}}},
+	}
+
+	plan := BuildOperations("development", changes)
+	var playbooks []string
+	for _, op := range plan.Operations {
+		playbooks = append(playbooks, op.Playbook)
+	}
+	expected := []string{"cluster.yml", "scale.yml", "remove-node.yml"}
+	if len(playbooks) != len(expected) {
+		t.Fatalf("expected playbooks %v, got %v", expected, playbooks)
+	}
+	for i := range expected {
+		if playbooks[i] != expected[i] {
+			t.Fatalf("expected playbooks %v, got %v", expected, playbooks)
+		}
+	}
+
+	if limit := plan.Operations[1].Limit; len(limit) != 1 || limit[0] != "worker-04" {
+		t.Fatalf("expected scale.yml limited to worker-04, got %v", limit)
+	}
+	if node := plan.Operations[2].ExtraVars["node"]; node != "worker-03" {
+		t.Fatalf("expected remove-node.yml for worker-03, got %q", node)
+	}
+	if plan.Operations[2].Inventory != PreviousInventory {
+		t.Fatalf("expected removal to run against previous inventory")
+	}
+}
+
+func TestBuildOperationsEmptyWhenNothingChanged(t *testing.T) {
+	hosts := Snapshot([]config.Host{{Name: "worker-01", Groups: []string{"kube_node"}}})
+	plan := BuildOperations("development", DiffHosts(hosts, hosts))
+	if !plan.Empty() {
+		t.Fatalf("expected empty plan, got %+v", plan.Operations)
+	}
+}
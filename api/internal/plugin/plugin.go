@@ -0,0 +1,201 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Protocol identifiers exchanged with plugin binaries
+const (
+	APIVersion   = "pn-infra.io/v1alpha1"
+	RequestKind  = "GeneratorRequest"
+	ResponseKind = "GeneratorResponse"
+)
+
+// DefaultTimeout bounds a plugin run when its spec sets no timeout
+const DefaultTimeout = 60 * time.Second
+
+// Spec declares a plugin in the config package's plugins.yaml
+type Spec struct {
+	Name    string            `yaml:"name"`
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+	Timeout string            `yaml:"timeout,omitempty"` // Go duration, e.g. 30s
+}
+
+// Config is the plugins.yaml file of a config package
+type Config struct {
+	Plugins []Spec `yaml:"plugins"`
+}
+
+// LoadConfig loads plugins.yaml from a config package directory. A package
+// without plugins.yaml declares no plugins.
+func LoadConfig(packageDir string) (*Config, error) {
+	path := filepath.Join(packageDir, "plugins.yaml")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read file %s: %w", path, err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unmarshal yaml %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// Request is written to the plugin's stdin as JSON
+type Request struct {
+	APIVersion    string      `json:"apiVersion"`
+	Kind          string      `json:"kind"`
+	Environment   string      `json:"environment"`
+	ConfigPackage string      `json:"configPackage"`
+	Config        interface{} `json:"config"`
+}
+
+// File is a single output produced by a plugin. Path is relative to the
+// environment output directory.
+type File struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// Diagnostic is a message reported by a plugin
+type Diagnostic struct {
+	Severity string `json:"severity"` // error, warning, info
+	Message  string `json:"message"`
+	Path     string `json:"path,omitempty"`
+}
+
+// Response is read from the plugin's stdout as JSON
+type Response struct {
+	APIVersion  string       `json:"apiVersion"`
+	Kind        string       `json:"kind"`
+	Files       []File       `json:"files,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// HasErrors reports whether any diagnostic has error severity
+func (r *Response) HasErrors() bool {
+	for _, d := range r.Diagnostics {
+		if d.Severity == "error" {
+			return true
+		}
+	}
+	return false
+}
+
+// Runner executes plugins declared in a config package
+type Runner struct {
+	PackageDir string
+}
+
+// NewRunner creates a runner resolving relative plugin commands against packageDir
+func NewRunner(packageDir string) *Runner {
+	return &Runner{PackageDir: packageDir}
+}
+
+// Run executes a plugin with the request on stdin and decodes its response
+func (r *Runner) Run(ctx context.Context, spec Spec, request Request) (*Response, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("plugin with command %q has no name", spec.Command)
+	}
+	command, err := r.resolveCommand(spec.Command)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", spec.Name, err)
+	}
+
+	timeout := DefaultTimeout
+	if spec.Timeout != "" {
+		timeout, err = time.ParseDuration(spec.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: invalid timeout %q: %w", spec.Name, spec.Timeout, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request.APIVersion = APIVersion
+	request.Kind = RequestKind
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: encode request: %w", spec.Name, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, spec.Args...)
+	cmd.Dir = r.PackageDir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	for key, value := range spec.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("plugin %s: timed out after %s", spec.Name, timeout)
+		}
+		return nil, fmt.Errorf("plugin %s: %w: %s", spec.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var response Response
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, fmt.Errorf("plugin %s: decode response: %w", spec.Name, err)
+	}
+	if response.Kind != ResponseKind {
+		return nil, fmt.Errorf("plugin %s: unexpected response kind %q", spec.Name, response.Kind)
+	}
+	return &response, nil
+}
+
+// resolveCommand resolves commands containing a path separator relative to
+// the package directory, and bare names through PATH
+func (r *Runner) resolveCommand(command string) (string, error) {
+	if command == "" {
+		return "", fmt.Errorf("no command")
+	}
+	if !strings.ContainsRune(command, filepath.Separator) {
+		return exec.LookPath(command)
+	}
+	if !filepath.IsAbs(command) {
+		command = filepath.Join(r.PackageDir, command)
+	}
+	if _, err := os.Stat(command); err != nil {
+		return "", err
+	}
+	return command, nil
+}
+
+// SandboxPath resolves a plugin file path inside outputDir, rejecting absolute
+// paths, paths escaping the directory and files reserved for the generator
+func SandboxPath(outputDir, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("path %s must be relative to the output directory", path)
+	}
+	cleaned := filepath.Clean(path)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s escapes the output directory", path)
+	}
+	if cleaned == "metadata.json" {
+		return "", fmt.Errorf("path %s is reserved", path)
+	}
+	return filepath.Join(outputDir, cleaned), nil
+}
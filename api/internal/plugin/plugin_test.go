@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePlugin(t *testing.T, dir, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, "plugins", "test-plugin")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir plugins: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("write plugin: %v", err)
+	}
+	return "./plugins/test-plugin"
+}
+
+func TestRunDecodesResponse(t *testing.T) {
+	dir := t.TempDir()
+	command := writePlugin(t, dir, `grep -q '"kind":"GeneratorRequest"' || exit 3
+echo '{"apiVersion":"pn-infra.io/v1alpha1","kind":"GeneratorResponse","files":[{"path":"cmdb/hosts.json","content":"[]"}]}'
+`)
+
+	runner := NewRunner(dir)
+	response, err := runner.Run(context.Background(), Spec{Name: "cmdb", Command: command}, Request{Environment: "development"})
+	if err != nil {
+		t.Fatalf("run plugin: %v", err)
+	}
+	if len(response.Files) != 1 || response.Files[0].Path != "cmdb/hosts.json" {
+		t.Fatalf("unexpected files: %+v", response.Files)
+	}
+}
+
+func TestRunReportsFailure(t *testing.T) {
+	dir := t.TempDir()
+	command := writePlugin(t, dir, "echo boom >&2\nexit 1\n")
+
+	runner := NewRunner(dir)
+	if _, err := runner.Run(context.Background(), Spec{Name: "broken", Command: command}, Request{}); err == nil {
+		t.Fatalf("expected error from failing plugin")
+	}
+}
+
+func TestSandboxPathRejectsEscapes(t *testing.T) {
+	outputDir := t.TempDir()
+	for _, path := range []string{"", "/etc/passwd", "../other-env/platform.yaml", "a/../../x", "metadata.json"} {
+		if _, err := SandboxPath(outputDir, path); err == nil {
+			t.Fatalf("expected %q to be rejected", path)
+		}
+	}
+
+	got, err := SandboxPath(outputDir, "crossplane/./claims.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(outputDir, "crossplane", "claims.yaml"); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
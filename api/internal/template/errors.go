@@ -0,0 +1,146 @@
+package template
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// snippetContext is the number of lines shown around the failing line
+const snippetContext = 2
+
+// RenderError is a template that failed to parse or execute, located in the
+// file that caused it
+type RenderError struct {
+	Template string `json:"template,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"` // 1-based byte column
+
+	// DataPath is the field chain or expression being evaluated, e.g.
+	// .Infrastructure.Proxmox.Node
+	DataPath string `json:"dataPath,omitempty"`
+	Message  string `json:"message"`
+
+	// Snippet is the lines around Line with a caret under Column
+	Snippet string `json:"snippet,omitempty"`
+
+	Err error `json:"-"`
+}
+
+func (e *RenderError) Error() string {
+	if e.DataPath != "" {
+		return fmt.Sprintf("%s: %s (evaluating %s)", e.location(), e.Message, e.DataPath)
+	}
+	return fmt.Sprintf("%s: %s", e.location(), e.Message)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// Pretty formats the error over several lines with its snippet, for terminals
+func (e *RenderError) Pretty() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", e.location())
+	if e.Snippet != "" {
+		b.WriteString(e.Snippet)
+	}
+	fmt.Fprintf(&b, "%s\n", e.Message)
+	if e.DataPath != "" {
+		fmt.Fprintf(&b, "while evaluating %s\n", e.DataPath)
+	}
+	return b.String()
+}
+
+// location returns path:line:column, leaving out what is unknown
+func (e *RenderError) location() string {
+	location := e.Template
+	if e.Line > 0 {
+		location += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			location += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	return location
+}
+
+// execLocation matches the location text/template gives an execution error.
+// Errors of nested include calls carry several; the last is the innermost.
+var execLocation = regexp.MustCompile(`template: (.+?):(\d+):(\d+): executing "[^"]*" at <(.*?)>: `)
+
+// parseLocation matches the location of a parse error
+var parseLocation = regexp.MustCompile(`^template: (.+?):(\d+):(?:(\d+):)? `)
+
+// renderError locates a text/template error in the source files. contents
+// holds the files' content keyed by template name, as returned by parse.
+func renderError(src Source, contents map[string][]byte, err error) *RenderError {
+	message := err.Error()
+	renderErr := &RenderError{Template: src.Path, Message: message, Err: err}
+
+	var name, line, column string
+	if matches := execLocation.FindAllStringSubmatchIndex(message, -1); len(matches) > 0 {
+		last := matches[len(matches)-1]
+		name, line, column = message[last[2]:last[3]], message[last[4]:last[5]], message[last[6]:last[7]]
+		renderErr.DataPath = message[last[8]:last[9]]
+		renderErr.Message = message[last[1]:]
+	} else if match := parseLocation.FindStringSubmatchIndex(message); match != nil {
+		name, line = message[match[2]:match[3]], message[match[4]:match[5]]
+		if match[6] >= 0 {
+			column = message[match[6]:match[7]]
+		}
+		renderErr.Message = message[match[1]:]
+	} else {
+		return renderErr
+	}
+
+	// The body is parsed under its base name, other files under their path
+	renderErr.Template = name
+	if name == filepath.Base(src.Path) {
+		renderErr.Template = src.Path
+	}
+	renderErr.Line, _ = strconv.Atoi(line)
+	if column != "" {
+		// text/template reports a 0-based byte offset
+		offset, _ := strconv.Atoi(column)
+		renderErr.Column = offset + 1
+	}
+	if content, ok := contents[name]; ok {
+		renderErr.Snippet = snippet(string(content), renderErr.Line, renderErr.Column)
+	}
+	return renderErr
+}
+
+// snippet returns the lines around line, numbered, with the line marked and a
+// caret under column when it is known
+func snippet(content string, line, column int) string {
+	lines := strings.Split(content, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	first, last := max(1, line-snippetContext), min(len(lines), line+snippetContext)
+	width := len(strconv.Itoa(last))
+
+	var b strings.Builder
+	for n := first; n <= last; n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %*d | %s\n", marker, width, n, lines[n-1])
+		if n == line && column > 0 && column <= len(lines[n-1])+1 {
+			// Keep tabs so the caret lines up with the text above it
+			var pad strings.Builder
+			for _, r := range lines[n-1][:column-1] {
+				if r == '\t' {
+					pad.WriteRune('\t')
+				} else {
+					pad.WriteRune(' ')
+				}
+			}
+			fmt.Fprintf(&b, "  %*s | %s^\n", width, "", pad.String())
+		}
+	}
+	return b.String()
+}
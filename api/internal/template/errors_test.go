@@ -0,0 +1,63 @@
+package template
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderErrorLocatesMissingKeyWithSnippet(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "platform.yaml.tmpl")
+	writeTemplate(t, path, "# header\nplatform:\n  name: {{ .Platform.Name }}\n  node: {{ .Platform.Node }}\nend: true\n")
+
+	data := map[string]interface{}{"Platform": map[string]interface{}{"Name": "proxmox"}}
+	_, err := NewRenderer(dir).Render(path, data)
+	var renderErr *RenderError
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("expected a *RenderError, got %T: %v", err, err)
+	}
+	if renderErr.Template != path || renderErr.Line != 4 || renderErr.Column != 21 {
+		t.Fatalf("location = %s:%d:%d, want %s:4:21", renderErr.Template, renderErr.Line, renderErr.Column, path)
+	}
+	if renderErr.DataPath != ".Platform.Node" || !strings.Contains(renderErr.Message, `no entry for key "Node"`) {
+		t.Fatalf("unexpected data path %q or message %q", renderErr.DataPath, renderErr.Message)
+	}
+	want := "  2 | platform:\n" +
+		"  3 |   name: {{ .Platform.Name }}\n" +
+		"> 4 |   node: {{ .Platform.Node }}\n" +
+		"    |                     ^\n" +
+		"  5 | end: true\n" +
+		"  6 | \n"
+	if renderErr.Snippet != want {
+		t.Fatalf("snippet =\n%s\nwant\n%s", renderErr.Snippet, want)
+	}
+	if !strings.HasPrefix(renderErr.Pretty(), path+":4:21\n") {
+		t.Fatalf("pretty output must start with the location, got\n%s", renderErr.Pretty())
+	}
+}
+
+func TestRenderErrorPointsIntoPartials(t *testing.T) {
+	dir := t.TempDir()
+	helpers := filepath.Join(dir, HelpersDir, "common.tmpl")
+	writeTemplate(t, helpers, "{{ define \"pn.node\" }}\n{{ required \"node is required\" .Node }}\n{{ end }}")
+	path := filepath.Join(dir, "inventory.ini.tmpl")
+	writeTemplate(t, path, "[all]\n{{ include \"pn.node\" (dict \"Node\" \"\") }}\n")
+
+	_, err := NewRenderer(dir).RenderSource(Source{Path: path, Helpers: []string{helpers}}, nil)
+	var renderErr *RenderError
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("expected a *RenderError, got %T: %v", err, err)
+	}
+	if renderErr.Template != helpers || renderErr.Line != 2 || !strings.HasSuffix(renderErr.Message, "node is required") {
+		t.Fatalf("expected the error in %s:2, got %v", helpers, renderErr)
+	}
+
+	// Parse errors are located too
+	writeTemplate(t, path, "[all]\n{{ .Hosts | nosuchfunc }}\n")
+	_, err = NewRenderer(dir).Render(path, nil)
+	if !errors.As(err, &renderErr) || renderErr.Template != path || renderErr.Line != 2 || !strings.Contains(renderErr.Message, "nosuchfunc") {
+		t.Fatalf("expected a parse error at %s:2, got %v", path, err)
+	}
+}
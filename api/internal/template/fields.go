@@ -0,0 +1,351 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// FieldRead is a data field a template reads, written as field names and
+// map keys separated by dots, with [] standing for any list element or map
+// value, e.g. Hosts[].IP, Stacks[].Enabled or Kind.nodes
+type FieldRead struct {
+	Path string
+
+	// Deep is set when the whole value is used, e.g. printed or passed to
+	// toJson, rather than only tested or ranged over
+	Deep bool
+}
+
+// FieldReads traces, without executing the template, which fields of data
+// of type root it reads. It follows with, range, variables, index, dict and
+// the templates it calls or includes; values returned by other functions are
+// not followed.
+func FieldReads(src Source, root reflect.Type) ([]FieldRead, error) {
+	trees, err := parseTrees(src)
+	if err != nil {
+		return nil, err
+	}
+	t := &fieldTracer{trees: trees, reads: map[string]bool{}, visited: map[string]bool{}}
+	data := tracedValue{typ: root, known: true}
+	t.template(src.Path, data)
+
+	reads := make([]FieldRead, 0, len(t.reads))
+	for path, deep := range t.reads {
+		reads = append(reads, FieldRead{Path: path, Deep: deep})
+	}
+	sort.Slice(reads, func(i, j int) bool { return reads[i].Path < reads[j].Path })
+	return reads, nil
+}
+
+// parseTrees parses the files of a template without its functions. The body
+// is named by its path; later files replace the definitions of earlier ones,
+// unless their definition is empty, as when executing.
+func parseTrees(src Source) (map[string]*parse.Tree, error) {
+	trees := map[string]*parse.Tree{}
+	for i, path := range src.Files() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read template %s: %w", path, err)
+		}
+		parsed := map[string]*parse.Tree{}
+		tree := parse.New(path)
+		tree.Mode = parse.SkipFuncCheck
+		if _, err := tree.Parse(string(content), "", "", parsed); err != nil {
+			return nil, fmt.Errorf("parse template %s: %w", path, err)
+		}
+		for name, tree := range parsed {
+			if name == path && i > 0 {
+				continue // partial and override files hold only definitions
+			}
+			if _, defined := trees[name]; defined && parse.IsEmptyTree(tree.Root) {
+				continue
+			}
+			trees[name] = tree
+		}
+	}
+	return trees, nil
+}
+
+// tracedValue is what the tracer knows about a value: the type and path of
+// the data field it comes from, the entries of a dict, or a string literal
+type tracedValue struct {
+	typ   reflect.Type
+	path  string
+	known bool
+	dict  map[string]tracedValue
+	text  *string
+}
+
+func (v tracedValue) key() string {
+	if v.dict == nil {
+		return fmt.Sprintf("%t|%s|%v", v.known, v.path, v.typ)
+	}
+	names := make([]string, 0, len(v.dict))
+	for name := range v.dict {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + v.dict[name].key()
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// field steps into a struct field or map key
+func (v tracedValue) field(name string) tracedValue {
+	if v.dict != nil {
+		return v.dict[name]
+	}
+	if !v.known || v.typ == nil {
+		return tracedValue{}
+	}
+	t := v.typ
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		f, ok := t.FieldByName(name)
+		if !ok || !f.IsExported() {
+			return tracedValue{}
+		}
+		return tracedValue{typ: f.Type, path: joinPath(v.path, name), known: true}
+	case reflect.Map:
+		// Keys of generic maps are part of the config's shape; keys of typed
+		// maps, such as stack names, are data
+		if t.Elem().Kind() == reflect.Interface {
+			return tracedValue{typ: t.Elem(), path: joinPath(v.path, name), known: true}
+		}
+		return tracedValue{typ: t.Elem(), path: v.path + "[]", known: true}
+	case reflect.Interface:
+		return tracedValue{typ: t, path: joinPath(v.path, name), known: true}
+	}
+	return tracedValue{}
+}
+
+// element steps into the elements of a list or the values of a map
+func (v tracedValue) element() tracedValue {
+	if !v.known || v.typ == nil {
+		return tracedValue{}
+	}
+	t := v.typ
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return tracedValue{typ: t.Elem(), path: v.path + "[]", known: true}
+	case reflect.Interface:
+		return tracedValue{typ: t, path: v.path + "[]", known: true}
+	}
+	return tracedValue{}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// shallowFuncs only look at whether a value is set or how long it is
+var shallowFuncs = map[string]bool{"len": true, "empty": true}
+
+type fieldTracer struct {
+	trees   map[string]*parse.Tree
+	reads   map[string]bool // path to deep
+	visited map[string]bool // template name and argument
+}
+
+func (t *fieldTracer) mark(v tracedValue, deep bool) {
+	for _, entry := range v.dict {
+		t.mark(entry, deep)
+	}
+	if v.known && (v.path != "" || deep) {
+		t.reads[v.path] = t.reads[v.path] || deep
+	}
+}
+
+// template traces a named template executed with data, once per argument
+func (t *fieldTracer) template(name string, data tracedValue) {
+	key := name + "\x00" + data.key()
+	tree := t.trees[name]
+	if tree == nil || t.visited[key] {
+		return
+	}
+	t.visited[key] = true
+	t.list(tree.Root, data, map[string]tracedValue{"$": data})
+}
+
+func (t *fieldTracer) list(list *parse.ListNode, dot tracedValue, vars map[string]tracedValue) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		t.node(node, dot, vars)
+	}
+}
+
+// scope copies the variables for a nested list, whose declarations end with it
+func scope(vars map[string]tracedValue) map[string]tracedValue {
+	copied := make(map[string]tracedValue, len(vars))
+	for name, v := range vars {
+		copied[name] = v
+	}
+	return copied
+}
+
+func (t *fieldTracer) node(node parse.Node, dot tracedValue, vars map[string]tracedValue) {
+	switch n := node.(type) {
+	case *parse.ActionNode:
+		v := t.pipe(n.Pipe, dot, vars)
+		if len(n.Pipe.Decl) == 0 {
+			t.mark(v, true)
+			return
+		}
+		vars[n.Pipe.Decl[0].Ident[0]] = v
+	case *parse.IfNode:
+		t.mark(t.pipe(n.Pipe, dot, vars), false)
+		t.list(n.List, dot, scope(vars))
+		t.list(n.ElseList, dot, scope(vars))
+	case *parse.WithNode:
+		v := t.pipe(n.Pipe, dot, vars)
+		t.mark(v, false)
+		inner := scope(vars)
+		if len(n.Pipe.Decl) > 0 {
+			inner[n.Pipe.Decl[0].Ident[0]] = v
+		}
+		t.list(n.List, v, inner)
+		t.list(n.ElseList, dot, scope(vars))
+	case *parse.RangeNode:
+		v := t.pipe(n.Pipe, dot, vars)
+		t.mark(v, false)
+		element := v.element()
+		inner := scope(vars)
+		switch len(n.Pipe.Decl) {
+		case 1:
+			inner[n.Pipe.Decl[0].Ident[0]] = element
+		case 2:
+			inner[n.Pipe.Decl[0].Ident[0]] = tracedValue{}
+			inner[n.Pipe.Decl[1].Ident[0]] = element
+		}
+		t.list(n.List, element, inner)
+		t.list(n.ElseList, dot, scope(vars))
+	case *parse.TemplateNode:
+		data := tracedValue{}
+		if n.Pipe != nil {
+			data = t.pipe(n.Pipe, dot, vars)
+		}
+		t.template(n.Name, data)
+	case *parse.ListNode:
+		t.list(n, dot, scope(vars))
+	}
+}
+
+// pipe traces a pipeline, passing each command's value to the next
+func (t *fieldTracer) pipe(pipe *parse.PipeNode, dot tracedValue, vars map[string]tracedValue) tracedValue {
+	if pipe == nil {
+		return tracedValue{}
+	}
+	var piped *tracedValue
+	for _, cmd := range pipe.Cmds {
+		v := t.command(cmd, dot, vars, piped)
+		piped = &v
+	}
+	if piped == nil {
+		return tracedValue{}
+	}
+	return *piped
+}
+
+func (t *fieldTracer) command(cmd *parse.CommandNode, dot tracedValue, vars map[string]tracedValue, piped *tracedValue) tracedValue {
+	if len(cmd.Args) == 0 {
+		return tracedValue{}
+	}
+	function, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return t.arg(cmd.Args[0], dot, vars)
+	}
+	args := make([]tracedValue, 0, len(cmd.Args))
+	for _, arg := range cmd.Args[1:] {
+		args = append(args, t.arg(arg, dot, vars))
+	}
+	if piped != nil {
+		args = append(args, *piped)
+	}
+
+	switch function.Ident {
+	case "index":
+		if len(args) == 0 {
+			return tracedValue{}
+		}
+		v := args[0]
+		for _, key := range args[1:] {
+			if key.text != nil {
+				v = v.field(*key.text)
+			} else {
+				t.mark(key, true)
+				v = v.element()
+			}
+		}
+		return v
+	case "dict":
+		entries := map[string]tracedValue{}
+		for i := 0; i+1 < len(args); i += 2 {
+			if args[i].text != nil {
+				entries[*args[i].text] = args[i+1]
+			} else {
+				t.mark(args[i+1], true)
+			}
+		}
+		return tracedValue{dict: entries}
+	case "include":
+		if len(args) == 2 && args[0].text != nil {
+			t.template(*args[0].text, args[1])
+			return tracedValue{}
+		}
+	case "default", "required":
+		// The last argument is passed through when set
+		if len(args) > 0 {
+			for _, arg := range args[:len(args)-1] {
+				t.mark(arg, true)
+			}
+			return args[len(args)-1]
+		}
+	}
+	for _, arg := range args {
+		t.mark(arg, !shallowFuncs[function.Ident])
+	}
+	return tracedValue{}
+}
+
+func (t *fieldTracer) arg(node parse.Node, dot tracedValue, vars map[string]tracedValue) tracedValue {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return fields(dot, n.Ident)
+	case *parse.VariableNode:
+		return fields(vars[n.Ident[0]], n.Ident[1:])
+	case *parse.ChainNode:
+		return fields(t.arg(n.Node, dot, vars), n.Field)
+	case *parse.PipeNode:
+		return t.pipe(n, dot, vars)
+	case *parse.StringNode:
+		text := n.Text
+		return tracedValue{text: &text}
+	}
+	return tracedValue{}
+}
+
+func fields(v tracedValue, names []string) tracedValue {
+	for _, name := range names {
+		v = v.field(name)
+	}
+	return v
+}
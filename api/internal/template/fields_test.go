@@ -0,0 +1,56 @@
+package template
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"pn-infra/api/internal/config"
+)
+
+func TestFieldReadsFollowsScopesPartialsAndOverrides(t *testing.T) {
+	repo := t.TempDir()
+	relative := filepath.Join("container-orchestration", "kubespray", "inventory.ini.tmpl")
+	writeTemplate(t, filepath.Join(repo, "api", "templates", relative), `# {{ .Environment }}
+{{- $cluster := .Kubespray }}
+{{ range $i, $host := .Hosts }}{{ $host.Name }} {{ if $host.Labels }}labels{{ end }}
+{{ end }}
+{{- with index .Stacks "monitoring" }}{{ .Retention | toJson }}{{ end }}
+{{ include "pn.roles" (dict "Hosts" .Hosts "Name" $cluster.ClusterName) }}
+{{ block "extra" . }}{{ .SSH.User }}{{ end }}
+{{ if .Kind }}{{ .Kind.networking.pod_subnet }}{{ end }}
+{{ len .Applications }} {{ .Proxmox.Missing }}`)
+	writeTemplate(t, filepath.Join(repo, "api", "templates", HelpersDir, "roles.tmpl"),
+		`{{ define "pn.roles" }}{{ .Name }}{{ range .Hosts }}{{ .Role }}{{ end }}{{ end }}`)
+	writeTemplate(t, filepath.Join(repo, "config", "packages", "core", "templates", relative),
+		`{{ define "extra" }}{{ .SSH.Port }}{{ end }}`)
+
+	resolver := NewPathResolver(repo)
+	resolver.SearchPath = SearchPath(repo, "core", "development")
+	source, err := resolver.Find(relative)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	reads, err := FieldReads(source, reflect.TypeOf(&config.MergedConfig{}))
+	if err != nil {
+		t.Fatalf("field reads: %v", err)
+	}
+
+	want := []FieldRead{
+		{Path: "Applications", Deep: false},
+		{Path: "Environment", Deep: true},
+		{Path: "Hosts", Deep: false},
+		{Path: "Hosts[].Labels", Deep: false},
+		{Path: "Hosts[].Name", Deep: true},
+		{Path: "Hosts[].Role", Deep: true},
+		{Path: "Kind", Deep: false},
+		{Path: "Kind.networking.pod_subnet", Deep: true},
+		{Path: "Kubespray.ClusterName", Deep: true},
+		{Path: "SSH.Port", Deep: true},
+		{Path: "Stacks[]", Deep: false},
+		{Path: "Stacks[].Retention", Deep: true},
+	}
+	if !reflect.DeepEqual(reads, want) {
+		t.Fatalf("field reads =\n%+v\nwant\n%+v", reads, want)
+	}
+}
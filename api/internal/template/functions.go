@@ -0,0 +1,639 @@
+package template
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults and failures
+
+// empty reports whether v is nil, false, zero, or an empty string or
+// collection. Structs are never empty.
+func empty(v interface{}) bool {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		return value.IsNil()
+	case reflect.Struct:
+		return false
+	default:
+		return value.IsZero()
+	}
+}
+
+// defaultValue returns given unless it is empty, e.g. {{ .Port | default 8080 }}
+func defaultValue(def, given interface{}) interface{} {
+	if empty(given) {
+		return def
+	}
+	return given
+}
+
+// required fails the render with message when v is missing: nil or an empty
+// string. Zero and false are values.
+func required(message string, v interface{}) (interface{}, error) {
+	if isNil(v) {
+		return nil, errors.New(message)
+	}
+	if s, ok := v.(string); ok && s == "" {
+		return nil, errors.New(message)
+	}
+	return v, nil
+}
+
+// fail stops the render with message
+func fail(message string) (string, error) {
+	return "", errors.New(message)
+}
+
+// coalesce returns the first value that is not empty, or nil
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// ternary returns whenTrue if condition holds and whenFalse otherwise, e.g.
+// {{ .HA | ternary 3 1 }}
+func ternary(whenTrue, whenFalse interface{}, condition bool) interface{} {
+	if condition {
+		return whenTrue
+	}
+	return whenFalse
+}
+
+// Encoding and hashing
+
+func b64enc(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func b64dec(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("b64dec: %w", err)
+	}
+	return string(data), nil
+}
+
+// sha256sum returns the hex SHA-256 of s, e.g. for config checksum annotations
+func sha256sum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Decoding
+
+// fromJSON decodes a JSON document. Invalid input fails the render.
+func fromJSON(s string) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("fromJson: %w", err)
+	}
+	return v, nil
+}
+
+// fromYAML decodes a YAML document. Invalid input fails the render.
+func fromYAML(s string) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("fromYaml: %w", err)
+	}
+	return stringKeys(v), nil
+}
+
+// TOML encoding
+
+// bareKey matches the keys TOML allows without quotes
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// toTOML encodes a map or struct as a TOML document. Keys are sorted; nil
+// values are left out, as TOML has no null. Structs are encoded by their
+// JSON field names.
+func toTOML(v interface{}) (string, error) {
+	normalized, err := plainValue(v)
+	if err != nil {
+		return "", fmt.Errorf("toToml: %w", err)
+	}
+	table, ok := normalized.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("toToml: top level must be a map, got %T", v)
+	}
+	var b strings.Builder
+	if err := writeTOMLTable(&b, nil, table); err != nil {
+		return "", fmt.Errorf("toToml: %w", err)
+	}
+	return b.String(), nil
+}
+
+// plainValue converts v to maps, slices and scalars through JSON, which also
+// applies struct field tags. Numbers are kept as json.Number.
+func plainValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(stringKeys(v))
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var plain interface{}
+	if err := decoder.Decode(&plain); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+// writeTOMLTable writes the key/value pairs of a table, then its sub-tables
+// and arrays of tables under their own headers
+func writeTOMLTable(b *strings.Builder, path []string, table map[string]interface{}) error {
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var nested []string
+	for _, name := range names {
+		switch value := table[name].(type) {
+		case nil:
+		case map[string]interface{}:
+			nested = append(nested, name)
+		case []interface{}:
+			if tableArray(value) {
+				nested = append(nested, name)
+				continue
+			}
+			encoded, err := tomlValue(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", strings.Join(append(path, name), "."), err)
+			}
+			fmt.Fprintf(b, "%s = %s\n", tomlKey(name), encoded)
+		default:
+			encoded, err := tomlValue(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", strings.Join(append(path, name), "."), err)
+			}
+			fmt.Fprintf(b, "%s = %s\n", tomlKey(name), encoded)
+		}
+	}
+
+	for _, name := range nested {
+		childPath := append(append([]string{}, path...), name)
+		header := make([]string, len(childPath))
+		for i, key := range childPath {
+			header[i] = tomlKey(key)
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		switch value := table[name].(type) {
+		case map[string]interface{}:
+			fmt.Fprintf(b, "[%s]\n", strings.Join(header, "."))
+			if err := writeTOMLTable(b, childPath, value); err != nil {
+				return err
+			}
+		case []interface{}:
+			for i, item := range value {
+				if i > 0 {
+					b.WriteString("\n")
+				}
+				fmt.Fprintf(b, "[[%s]]\n", strings.Join(header, "."))
+				if err := writeTOMLTable(b, childPath, item.(map[string]interface{})); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// tableArray reports whether a list is written as an array of tables: it is
+// not empty and holds only maps
+func tableArray(items []interface{}) bool {
+	for _, item := range items {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return len(items) > 0
+}
+
+func tomlKey(key string) string {
+	if bareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+// tomlString quotes s as a TOML basic string. JSON string escapes are valid
+// in TOML; HTML escaping is turned off to keep <, > and & readable.
+func tomlString(s string) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// tomlValue encodes a value inline; maps become inline tables
+func tomlValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case string:
+		return tomlString(value), nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			if item == nil {
+				return "", errors.New("arrays cannot hold null")
+			}
+			encoded, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, encoded)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]interface{}:
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, len(names))
+		for _, name := range names {
+			if value[name] == nil {
+				continue
+			}
+			encoded, err := tomlValue(value[name])
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, tomlKey(name)+" = "+encoded)
+		}
+		if len(pairs) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(pairs, ", ") + " }", nil
+	default:
+		return "", fmt.Errorf("cannot encode %T", v)
+	}
+}
+
+// Lists and maps
+
+func list(items ...interface{}) []interface{} {
+	return items
+}
+
+// sortAlpha returns the string forms of a list's items, sorted
+func sortAlpha(items interface{}) ([]string, error) {
+	value := reflect.ValueOf(items)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, fmt.Errorf("sortAlpha: %T is not a list", items)
+	}
+	sorted := make([]string, value.Len())
+	for i := range sorted {
+		sorted[i] = fmt.Sprint(value.Index(i).Interface())
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// keys returns the string forms of a map's keys, sorted so output does not
+// depend on map iteration order
+func keys(m interface{}) ([]string, error) {
+	value := reflect.ValueOf(m)
+	if value.Kind() != reflect.Map {
+		return nil, fmt.Errorf("keys: %T is not a map", m)
+	}
+	names := make([]string, 0, value.Len())
+	for _, key := range value.MapKeys() {
+		names = append(names, fmt.Sprint(key.Interface()))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// merge deep-merges maps into a new map. As in Helm, earlier maps take
+// precedence: a key is taken from the first map that has it, and nested maps
+// are merged the same way. The arguments are not modified.
+func merge(maps ...interface{}) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+	for i, m := range maps {
+		source, ok := stringKeys(m).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("merge: argument %d is %T, not a map", i+1, m)
+		}
+		mergeInto(merged, source)
+	}
+	return merged, nil
+}
+
+// mergeInto copies the keys of source missing from target, recursing into
+// maps present in both
+func mergeInto(target, source map[string]interface{}) {
+	for key, value := range source {
+		existing, ok := target[key]
+		if !ok {
+			if nested, isMap := value.(map[string]interface{}); isMap {
+				copied := map[string]interface{}{}
+				mergeInto(copied, nested)
+				value = copied
+			}
+			target[key] = value
+			continue
+		}
+		targetMap, targetIsMap := existing.(map[string]interface{})
+		sourceMap, sourceIsMap := value.(map[string]interface{})
+		if targetIsMap && sourceIsMap {
+			mergeInto(targetMap, sourceMap)
+		}
+	}
+}
+
+// Arithmetic
+
+func div(a, b int) (int, error) {
+	if b == 0 {
+		return 0, fmt.Errorf("div: %d divided by zero", a)
+	}
+	return a / b, nil
+}
+
+// Comparisons
+
+// eq reports whether a equals any of the others. Numbers compare by value
+// whatever their Go type, so an int from a struct equals a float64 decoded
+// from JSON. Comparing values of incompatible kinds, such as a string with a
+// number, is an error rather than a silent false.
+func eq(a interface{}, others ...interface{}) (bool, error) {
+	if len(others) == 0 {
+		return false, errors.New("eq: missing argument for comparison")
+	}
+	for _, b := range others {
+		equal, err := equal(a, b)
+		if err != nil {
+			return false, fmt.Errorf("eq: %w", err)
+		}
+		if equal {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func ne(a, b interface{}) (bool, error) {
+	equal, err := equal(a, b)
+	if err != nil {
+		return false, fmt.Errorf("ne: %w", err)
+	}
+	return !equal, nil
+}
+
+func lt(a, b interface{}) (bool, error) {
+	order, err := compare(a, b)
+	if err != nil {
+		return false, fmt.Errorf("lt: %w", err)
+	}
+	return order < 0, nil
+}
+
+func le(a, b interface{}) (bool, error) {
+	order, err := compare(a, b)
+	if err != nil {
+		return false, fmt.Errorf("le: %w", err)
+	}
+	return order <= 0, nil
+}
+
+func gt(a, b interface{}) (bool, error) {
+	order, err := compare(a, b)
+	if err != nil {
+		return false, fmt.Errorf("gt: %w", err)
+	}
+	return order > 0, nil
+}
+
+func ge(a, b interface{}) (bool, error) {
+	order, err := compare(a, b)
+	if err != nil {
+		return false, fmt.Errorf("ge: %w", err)
+	}
+	return order >= 0, nil
+}
+
+// equal compares two values: nil only equals nil, numbers by value, strings
+// and bools by content, and other values when they have the same comparable
+// type
+func equal(a, b interface{}) (bool, error) {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b), nil
+	}
+	if x, y, ok := numbers(a, b); ok {
+		if x == nil || y == nil {
+			return false, nil // NaN equals nothing
+		}
+		return x.Cmp(y) == 0, nil
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case va.Kind() == reflect.String && vb.Kind() == reflect.String:
+		return va.String() == vb.String(), nil
+	case va.Kind() == reflect.Bool && vb.Kind() == reflect.Bool:
+		return va.Bool() == vb.Bool(), nil
+	case va.Type() == vb.Type() && va.Type().Comparable():
+		return a == b, nil
+	}
+	return false, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+// compare orders two numbers or two strings
+func compare(a, b interface{}) (int, error) {
+	if x, y, ok := numbers(a, b); ok {
+		if x == nil || y == nil {
+			return 0, errors.New("cannot order NaN")
+		}
+		return x.Cmp(y), nil
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.String && vb.Kind() == reflect.String {
+		return strings.Compare(va.String(), vb.String()), nil
+	}
+	return 0, fmt.Errorf("cannot order %T and %T", a, b)
+}
+
+// numbers returns a and b as exact big floats when both are numbers. A NaN
+// is returned as nil.
+func numbers(a, b interface{}) (x, y *big.Float, ok bool) {
+	x, okA := number(a)
+	y, okB := number(b)
+	return x, y, okA && okB
+}
+
+func number(v interface{}) (*big.Float, bool) {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Float).SetInt64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Float).SetUint64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(value.Float()) {
+			return nil, true
+		}
+		return new(big.Float).SetFloat64(value.Float()), true
+	}
+	return nil, false
+}
+
+func isNil(v interface{}) bool {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return value.IsNil()
+	}
+	return false
+}
+
+// Versions
+
+// constraintOperator matches an operator followed by spaces, which are
+// dropped so ">= 1.2" reads as one term
+var constraintOperator = regexp.MustCompile(`(>=|<=|!=|==|=|>|<|~|\^)\s+`)
+
+// semverCompare reports whether version satisfies constraint. A constraint is
+// one or more alternatives separated by ||, each a list of terms separated by
+// commas or spaces that must all hold. A term is a version with an optional
+// operator: = (the default), !=, >, >=, <, <=, ~ (same minor version, or same
+// major when only the major is given) or ^ (same major version, or same minor
+// below 1.0). Versions may omit the leading v and trailing components.
+func semverCompare(constraint, version string) (bool, error) {
+	v, err := canonicalVersion(version)
+	if err != nil {
+		return false, fmt.Errorf("semverCompare: %w", err)
+	}
+	for _, alternative := range strings.Split(constraint, "||") {
+		terms := strings.FieldsFunc(constraintOperator.ReplaceAllString(alternative, "$1"), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(terms) == 0 {
+			return false, fmt.Errorf("semverCompare: empty constraint in %q", constraint)
+		}
+		satisfied := true
+		for _, term := range terms {
+			ok, err := matchVersionTerm(term, v)
+			if err != nil {
+				return false, fmt.Errorf("semverCompare %q: %w", constraint, err)
+			}
+			satisfied = satisfied && ok
+		}
+		if satisfied {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchVersionTerm reports whether the canonical version v satisfies one term
+func matchVersionTerm(term, v string) (bool, error) {
+	operator := ""
+	for _, candidate := range []string{">=", "<=", "!=", "==", "=", ">", "<", "~", "^"} {
+		if strings.HasPrefix(term, candidate) {
+			operator = candidate
+			break
+		}
+	}
+	raw := strings.TrimPrefix(term, operator)
+	bound, err := canonicalVersion(raw)
+	if err != nil {
+		return false, err
+	}
+	order := semver.Compare(v, bound)
+
+	switch operator {
+	case "", "=", "==":
+		return order == 0, nil
+	case "!=":
+		return order != 0, nil
+	case ">":
+		return order > 0, nil
+	case ">=":
+		return order >= 0, nil
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	}
+
+	// ~ and ^ allow versions from the bound up to the next release of the
+	// component they pin
+	major, minor, patch := versionParts(bound)
+	components := strings.Count(versionCore(raw), ".") + 1
+	var upper string
+	switch {
+	case operator == "~" && components == 1:
+		upper = fmt.Sprintf("v%d.0.0", major+1)
+	case operator == "~":
+		upper = fmt.Sprintf("v%d.%d.0", major, minor+1)
+	case major > 0 || components == 1:
+		upper = fmt.Sprintf("v%d.0.0", major+1)
+	case minor > 0 || components == 2:
+		upper = fmt.Sprintf("v0.%d.0", minor+1)
+	default:
+		upper = fmt.Sprintf("v0.0.%d", patch+1)
+	}
+	return order >= 0 && semver.Compare(v, upper) < 0, nil
+}
+
+// canonicalVersion returns a version in the vMAJOR.MINOR.PATCH form that
+// golang.org/x/mod/semver compares
+func canonicalVersion(version string) (string, error) {
+	v := "v" + strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if !semver.IsValid(v) {
+		return "", fmt.Errorf("invalid version %q", version)
+	}
+	return semver.Canonical(v), nil
+}
+
+// versionCore strips the leading v, prerelease and build metadata
+func versionCore(version string) string {
+	core, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(version), "v"), "+")
+	core, _, _ = strings.Cut(core, "-")
+	return core
+}
+
+// versionParts returns the numeric components of a canonical version
+func versionParts(v string) (major, minor, patch int) {
+	parts := strings.Split(versionCore(v), ".")
+	major, _ = strconv.Atoi(parts[0])
+	minor, _ = strconv.Atoi(parts[1])
+	patch, _ = strconv.Atoi(parts[2])
+	return major, minor, patch
+}
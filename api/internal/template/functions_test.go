@@ -0,0 +1,197 @@
+package template
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// renderText renders a template source through the renderer's functions
+func renderText(t *testing.T, text string, data interface{}) (string, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.tmpl")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	return NewRenderer(filepath.Dir(path)).Render(path, data)
+}
+
+func TestFunctions(t *testing.T) {
+	data := map[string]interface{}{
+		"Empty":  "",
+		"Zero":   0,
+		"Name":   "web",
+		"Port":   int64(8080),
+		"Ratio":  0.5,
+		"Labels": map[string]string{"tier": "web", "app": "api"},
+		"Nil":    nil,
+	}
+	tests := []struct {
+		name, text, want string
+	}{
+		{"default empty", `{{ .Empty | default "x" }}`, "x"},
+		{"default zero", `{{ .Zero | default 5 }}`, "5"},
+		{"default missing", `{{ index . "Missing" | default "x" }}`, "x"},
+		{"default set", `{{ .Name | default "x" }}`, "web"},
+		{"required set", `{{ required "name is required" .Name }}`, "web"},
+		{"required zero", `{{ required "zero is a value" .Zero }}`, "0"},
+		{"coalesce", `{{ coalesce .Empty .Nil .Name "x" }}`, "web"},
+		{"ternary", `{{ ternary "yes" "no" true }} {{ eq .Name "db" | ternary "yes" "no" }}`, "yes no"},
+		{"b64enc", `{{ b64enc "hello" }}`, "aGVsbG8="},
+		{"b64dec", `{{ b64dec "aGVsbG8=" }}`, "hello"},
+		{"sha256sum", `{{ sha256sum "abc" }}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"fromYaml", `{{ $v := fromYaml "b: 1\na: [x, y]" }}{{ index $v.a 1 }} {{ toJson $v }}`, `y {"a":["x","y"],"b":1}`},
+		{"fromJson", `{{ $v := fromJson "{\"port\": 22}" }}{{ $v.port }}`, "22"},
+		{"list", `{{ list 1 "a" true | toJson }}`, `[1,"a",true]`},
+		{"sortAlpha", `{{ join (sortAlpha (list "b" "c" "a")) "," }}`, "a,b,c"},
+		{"keys", `{{ join (keys .Labels) "," }}`, "app,tier"},
+		{"merge", `{{ merge (dict "a" 1 "n" (dict "x" 1)) (dict "a" 2 "b" 2 "n" (dict "x" 2 "y" 2)) | toJson }}`, `{"a":1,"b":2,"n":{"x":1,"y":2}}`},
+		{"eq mixed numbers", `{{ eq .Port 8080 }} {{ eq .Ratio 0.5 }} {{ eq .Zero 0.0 }}`, "true true true"},
+		{"eq any", `{{ eq .Name "db" "web" }}`, "true"},
+		{"eq nil", `{{ eq .Nil nil }} {{ eq .Name nil }}`, "true false"},
+		{"ne", `{{ ne .Name "db" }}`, "true"},
+		{"order numbers", `{{ lt .Port 9000.5 }} {{ le 1 1 }} {{ gt .Ratio 0 }} {{ ge 1 2 }}`, "true true true false"},
+		{"order strings", `{{ lt "a" "b" }}`, "true"},
+		{"div", `{{ div 7 2 }}`, "3"},
+		{"semver caret", `{{ semverCompare "^1.28" "1.30.2" }} {{ semverCompare "^1.28" "2.0.0" }} {{ semverCompare "^0.4.1" "0.5.0" }}`, "true false false"},
+		{"semver tilde", `{{ semverCompare "~1.28.3" "v1.28.9" }} {{ semverCompare "~1.28" "1.29.0" }}`, "true false"},
+		{"semver ranges", `{{ semverCompare ">= 1.27, <1.30" "1.29.1" }} {{ semverCompare "<1.0 || >=2" "1.5" }} {{ semverCompare "!=1.2.3" "1.2.3" }}`, "true false false"},
+		{"until", `{{ until 3 | toJson }} {{ until 0 | toJson }}`, "[0,1,2] []"},
+		{"seq", `{{ seq -1 1 | toJson }} {{ seq 2 1 | toJson }}`, "[-1,0,1] []"},
+		{"semver prerelease", `{{ semverCompare ">=1.30.0" "1.30.0-rc.1" }}`, "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := renderText(t, test.text, data)
+			if err != nil {
+				t.Fatalf("render %s: %v", test.text, err)
+			}
+			if got != test.want {
+				t.Fatalf("%s = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFunctionsFailInsteadOfGuessing(t *testing.T) {
+	data := map[string]interface{}{"Name": "web", "Port": 8080, "Empty": ""}
+	tests := []struct {
+		name, text, want string
+	}{
+		{"required missing", `{{ required "cluster name is required" .Empty }}`, "cluster name is required"},
+		{"required absent", `{{ required "cluster name is required" (index . "Missing") }}`, "cluster name is required"},
+		{"fail", `{{ fail "unsupported platform" }}`, "unsupported platform"},
+		{"b64dec invalid", `{{ b64dec "%%%" }}`, "b64dec"},
+		{"fromYaml invalid", `{{ fromYaml "a: [" }}`, "fromYaml"},
+		{"fromJson invalid", `{{ fromJson "{" }}`, "fromJson"},
+		{"eq string and number", `{{ eq .Port "8080" }}`, "cannot compare int with string"},
+		{"lt bools", `{{ lt true false }}`, "cannot order bool and bool"},
+		{"div by zero", `{{ div 1 0 }}`, "divided by zero"},
+		{"keys of list", `{{ keys (list 1) }}`, "not a map"},
+		{"merge list", `{{ merge (dict) (list 1) }}`, "argument 2"},
+		{"semver invalid version", `{{ semverCompare ">=1.2" "latest" }}`, `invalid version "latest"`},
+		{"semver invalid constraint", `{{ semverCompare ">=x" "1.2.3" }}`, `invalid version "x"`},
+		{"until negative", `{{ until -1 }}`, "outside 0..10000"},
+		{"until huge", `{{ until 8589934592 }}`, "outside 0..10000"},
+		{"seq huge", `{{ seq 0 8589934592 }}`, "more than 10000 numbers"},
+		{"seq overflowing", `{{ seq -9223372036854775807 9223372036854775807 }}`, "more than 10000 numbers"},
+		{"toToml scalar", `{{ toToml 1 }}`, "top level must be a map"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := renderText(t, test.text, data)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("%s: expected an error containing %q, got %v", test.text, test.want, err)
+			}
+		})
+	}
+}
+
+func TestToTomlWritesTablesSorted(t *testing.T) {
+	data := map[string]interface{}{
+		"Config": map[string]interface{}{
+			"title":   "pn \"infra\"",
+			"port":    8080,
+			"enabled": true,
+			"skipped": nil,
+			"tags":    []string{"a", "b"},
+			"server":  map[string]interface{}{"host": "10.0.0.1", "dns.name": "api", "limits": map[string]interface{}{"cpu": 2}},
+			"hosts":   []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b", "port": 22}},
+			"inline":  []interface{}{map[string]interface{}{"k": "v"}, "x"},
+		},
+	}
+	got, err := renderText(t, `{{ toToml .Config }}`, data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := `enabled = true
+inline = [{ k = "v" }, "x"]
+port = 8080
+tags = ["a", "b"]
+title = "pn \"infra\""
+
+[[hosts]]
+name = "a"
+
+[[hosts]]
+name = "b"
+port = 22
+
+[server]
+"dns.name" = "api"
+host = "10.0.0.1"
+
+[server.limits]
+cpu = 2
+`
+	if got != want {
+		t.Fatalf("toToml =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestToHclRoundTrips(t *testing.T) {
+	values := []interface{}{
+		`ssh-ed25519 AAAA "quoted" ops@example.com`,
+		`C:\keys\id_ed25519`,
+		"${var.secret} and %{ if true }x%{ endif }",
+		"$${kept} %%{kept} $ % {}",
+		"line one\nline two\ttab <html> & \u2028",
+		[]interface{}{"${a}", "b"},
+		map[string]interface{}{"${key}": "%{value}", "plain": "x"},
+	}
+	for _, value := range values {
+		rendered, err := renderText(t, `x = {{ toHcl .Value }}`, map[string]interface{}{"Value": value})
+		if err != nil {
+			t.Fatalf("render %#v: %v", value, err)
+		}
+		file, diags := hclparse.NewParser().ParseHCL([]byte(rendered), "test.tfvars")
+		if diags.HasErrors() {
+			t.Fatalf("parse %s: %v", rendered, diags)
+		}
+		attributes, diags := file.Body.JustAttributes()
+		if diags.HasErrors() {
+			t.Fatalf("attributes of %s: %v", rendered, diags)
+		}
+		evaluated, diags := attributes["x"].Expr.Value(nil)
+		if diags.HasErrors() {
+			t.Fatalf("evaluate %s: %v", rendered, diags)
+		}
+		data, err := ctyjson.Marshal(evaluated, evaluated.Type())
+		if err != nil {
+			t.Fatalf("encode %s: %v", rendered, err)
+		}
+		var got interface{}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("decode %s: %v", rendered, err)
+		}
+		if !reflect.DeepEqual(got, value) {
+			t.Fatalf("%s evaluates to %#v, want %#v", rendered, got, value)
+		}
+	}
+}
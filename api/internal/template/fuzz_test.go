@@ -0,0 +1,161 @@
+package template
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"pn-infra/api/internal/config"
+)
+
+// builtinSources resolves every built-in template with the shared partials
+func builtinSources(t testing.TB) []Source {
+	t.Helper()
+	repoRoot, err := filepath.Abs(filepath.Join("..", "..", ".."))
+	if err != nil {
+		t.Fatalf("repository root: %v", err)
+	}
+	resolver := NewPathResolver(repoRoot)
+	templates := resolver.SearchPath[0].Dir
+
+	var relatives []string
+	err = filepath.WalkDir(templates, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == HelpersDir {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && strings.HasSuffix(path, ".tmpl") {
+			relative, err := filepath.Rel(templates, path)
+			if err != nil {
+				return err
+			}
+			relatives = append(relatives, relative)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("list built-in templates: %v", err)
+	}
+	if len(relatives) == 0 {
+		t.Fatalf("no built-in templates in %s", templates)
+	}
+	sort.Strings(relatives)
+
+	sources := make([]Source, 0, len(relatives))
+	for _, relative := range relatives {
+		src, err := resolver.Find(relative)
+		if err != nil {
+			t.Fatalf("resolve %s: %v", relative, err)
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// fuzzConfig is a merged config in the YAML form the fuzz targets decode:
+// MergedConfig fields in lower case, the settings they hold by their tags
+const fuzzConfig = `configpackage: core
+environment: development
+hosts:
+  - {name: node1, role: master, ip: 10.0.0.10, cpu: 2, memory: 4096, disk: 50, groups: [kube_control_plane, etcd, kube_node], labels: [ssd]}
+  - {name: node2, role: worker, ip: 10.0.0.11, cpu: 2, memory: 4096, disk: 50, groups: [kube_node]}
+networks:
+  networks:
+    - {name: management, vlan_id: 106, cidr: 10.0.0.0/24, gateway: 10.0.0.1, dns_servers: [10.0.0.2]}
+dns: {domain: example.local}
+ntp: {servers: [pool.ntp.org]}
+ssh: {user: ops, port: 22, key_path: ~/.ssh/id_ed25519, public_key: ssh-ed25519 AAAA ops}
+infrastructure: {platform: proxmox, provider: terraform}
+containerorchestration: {orchestrator: kubespray}
+proxmox: {node_name: pve, template: {id: 9000, sockets: 1}}
+aws: {region: eu-west-1, tags: {team: ops}}
+gcp: {project_id: demo, labels: {team: ops}}
+azure: {location: westeurope, network_security_group: {security_rules: [{name: ssh}]}}
+kubespray: {kube_version: v1.28.3, cluster_name: dev}
+kind: {name: dev, nodes: [{role: control-plane}]}
+kubekey:
+  kubernetes_version: v1.28.3
+  cluster: {name: dev, control_plane_endpoint: {port: 6443}}
+  network: {plugin: calico, pod_cidr: 10.233.64.0/18, service_cidr: 10.233.0.0/18}
+  container_runtime: containerd
+  registry: {type: none}
+  addons: [{name: metrics-server, enabled: true}]
+stacks:
+  monitoring: {enabled: true, retention: {prometheus: 15d}, storage: {prometheus: 50Gi, grafana: 10Gi}}
+  logging: {enabled: true, backend: loki, retention: {loki: 7d}, storage: {loki: 100Gi}}
+applications:
+  - {name: docs, enabled: true, namespace: docs, source: {type: helm, path: docs, target_revision: HEAD}, values: {replicas: 2}}
+infrastructureoverrides: {endpoint: "https://pve:8006", access_key: "a\"b"}
+clusteroverrides: {kube_proxy_mode: ipvs, nested: {list: [1, "two"]}}
+`
+
+// FuzzRender renders a built-in template with decoded config. Rendering
+// must not panic, and must give the same output or error every time.
+func FuzzRender(f *testing.F) {
+	sources := builtinSources(f)
+	for i := range sources {
+		f.Add(uint8(i), fuzzConfig)
+	}
+	f.Add(uint8(0), "hosts: [{}]\nnetworks: {networks: [{name: management}]}\n")
+	f.Add(uint8(0), "kubekey: {cluster: []}\nkind: 1\nstacks: {monitoring: {}}\n")
+	f.Add(uint8(0), "applications: [{enabled: true, values: {a: [{b: ~}]}}]\nclusteroverrides: {\"a: b\": \"\\n\"}\n")
+
+	f.Fuzz(func(t *testing.T, index uint8, data string) {
+		var merged config.MergedConfig
+		if err := yaml.Unmarshal([]byte(data), &merged); err != nil {
+			return
+		}
+		src := sources[int(index)%len(sources)]
+		first, firstErr := NewRenderer("").RenderSource(src, &merged)
+		second, secondErr := NewRenderer("").RenderSource(src, &merged)
+		if (firstErr == nil) != (secondErr == nil) || (firstErr != nil && firstErr.Error() != secondErr.Error()) {
+			t.Fatalf("%s: rendering twice gave different errors: %v, %v", src.Path, firstErr, secondErr)
+		}
+		if first != second {
+			t.Fatalf("%s: rendering twice gave different output:\n%s\n---\n%s", src.Path, first, second)
+		}
+	})
+}
+
+// TestRenderFuzzRegressions renders the inputs FuzzRender crashed on
+func TestRenderFuzzRegressions(t *testing.T) {
+	tests := []struct {
+		name, template, data, want string
+	}{
+		{
+			// until allocated the count from config, so a huge one ran out of memory
+			name:     "kind node count",
+			template: "container-orchestration/kind/config.yaml.tmpl",
+			data:     "kind: {Name: dev, Networking: {ApiServerAddress: 127.0.0.1, ApiServerPort: 6443, PodSubnet: a, ServiceSubnet: b, DnsDomain: '', DisableDefaultCni: false, KubeProxyMode: iptables}, nodes: {control_plane: {count: 8589934592}}}",
+			want:     "until: count 8589934592 is outside 0..10000",
+		},
+	}
+	sources := builtinSources(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var src Source
+			for _, candidate := range sources {
+				if strings.HasSuffix(filepath.ToSlash(candidate.Path), "/"+test.template) {
+					src = candidate
+				}
+			}
+			if src.Path == "" {
+				t.Fatalf("no built-in template %s", test.template)
+			}
+			var merged config.MergedConfig
+			if err := yaml.Unmarshal([]byte(test.data), &merged); err != nil {
+				t.Fatalf("decode config: %v", err)
+			}
+			_, err := NewRenderer("").RenderSource(src, &merged)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("expected an error containing %q, got %v", test.want, err)
+			}
+		})
+	}
+}
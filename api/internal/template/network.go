@@ -0,0 +1,177 @@
+package template
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+)
+
+// Network functions follow Terraform's cidrhost, cidrsubnet, cidrsubnets and
+// cidrnetmask, so addresses computed in templates match those computed in
+// Terraform modules. Prefixes are IPv4 or IPv6; host bits set in a prefix
+// are ignored.
+
+// addressSpace is a prefix with its first address as an integer, so IPv4 and
+// IPv6 share the arithmetic
+type addressSpace struct {
+	first  *big.Int
+	bits   int // prefix length
+	total  int // address length: 32 or 128
+	ipv4   bool
+	prefix string
+}
+
+func parseAddressSpace(prefix string) (addressSpace, error) {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return addressSpace{}, fmt.Errorf("invalid CIDR prefix %q", prefix)
+	}
+	p = p.Masked()
+	addr := p.Addr()
+	return addressSpace{
+		first:  new(big.Int).SetBytes(addr.AsSlice()),
+		bits:   p.Bits(),
+		total:  addr.BitLen(),
+		ipv4:   addr.Is4(),
+		prefix: prefix,
+	}, nil
+}
+
+// size returns the number of addresses in a prefix of length bits
+func (s addressSpace) size(bits int) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(s.total-bits))
+}
+
+// address converts an integer back to an address of the space's family
+func (s addressSpace) address(n *big.Int) netip.Addr {
+	if s.ipv4 {
+		return netip.AddrFrom4([4]byte(n.FillBytes(make([]byte, 4))))
+	}
+	return netip.AddrFrom16([16]byte(n.FillBytes(make([]byte, 16))))
+}
+
+// host returns the address numbered hostnum; negative numbers count back
+// from the last address
+func (s addressSpace) host(hostnum int) (netip.Addr, error) {
+	size := s.size(s.bits)
+	n := big.NewInt(int64(hostnum))
+	if hostnum < 0 {
+		n.Add(n, size)
+	}
+	if n.Sign() < 0 || n.Cmp(size) >= 0 {
+		return netip.Addr{}, fmt.Errorf("prefix %s of %d bits cannot accommodate a host numbered %d", s.prefix, s.bits, hostnum)
+	}
+	return s.address(n.Add(n, s.first)), nil
+}
+
+// cidrhost returns the address numbered hostnum within prefix, e.g.
+// {{ cidrhost "10.0.0.0/24" 1 }} is 10.0.0.1 and -2 the last usable IPv4
+// address
+func cidrhost(prefix string, hostnum int) (string, error) {
+	space, err := parseAddressSpace(prefix)
+	if err != nil {
+		return "", fmt.Errorf("cidrhost: %w", err)
+	}
+	addr, err := space.host(hostnum)
+	if err != nil {
+		return "", fmt.Errorf("cidrhost: %w", err)
+	}
+	return addr.String(), nil
+}
+
+// cidrsubnet returns subnet netnum of the subnets that extend prefix by
+// newbits, e.g. {{ cidrsubnet "10.0.0.0/16" 8 2 }} is 10.0.2.0/24
+func cidrsubnet(prefix string, newbits, netnum int) (string, error) {
+	space, err := parseAddressSpace(prefix)
+	if err != nil {
+		return "", fmt.Errorf("cidrsubnet: %w", err)
+	}
+	bits := space.bits + newbits
+	if newbits < 0 || bits > space.total {
+		return "", fmt.Errorf("cidrsubnet: extending %s by %d bits gives a prefix of %d bits, which is invalid for an address of %d bits", prefix, newbits, bits, space.total)
+	}
+	count := new(big.Int).Lsh(big.NewInt(1), uint(newbits))
+	if netnum < 0 || big.NewInt(int64(netnum)).Cmp(count) >= 0 {
+		return "", fmt.Errorf("cidrsubnet: prefix extension of %d bits cannot accommodate a subnet numbered %d", newbits, netnum)
+	}
+	first := new(big.Int).Mul(big.NewInt(int64(netnum)), space.size(bits))
+	first.Add(first, space.first)
+	return netip.PrefixFrom(space.address(first), bits).String(), nil
+}
+
+// cidrsubnets allocates consecutive subnets of prefix, one per newbits
+// argument, each aligned to its own size, e.g. one subnet per availability
+// zone: {{ cidrsubnets "10.0.0.0/16" 4 4 4 }}
+func cidrsubnets(prefix string, newbits ...int) ([]string, error) {
+	space, err := parseAddressSpace(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("cidrsubnets: %w", err)
+	}
+	end := new(big.Int).Add(space.first, space.size(space.bits))
+	next := new(big.Int).Set(space.first)
+	subnets := make([]string, 0, len(newbits))
+	for i, extension := range newbits {
+		bits := space.bits + extension
+		if extension < 1 || bits > space.total {
+			return nil, fmt.Errorf("cidrsubnets: argument %d: extending %s by %d bits is invalid for an address of %d bits", i+2, prefix, extension, space.total)
+		}
+		// Round up to the subnet's own alignment
+		size := space.size(bits)
+		start := new(big.Int).Add(next, new(big.Int).Sub(size, big.NewInt(1)))
+		start.Div(start, size).Mul(start, size)
+		next = new(big.Int).Add(start, size)
+		if next.Cmp(end) > 0 {
+			return nil, fmt.Errorf("cidrsubnets: not enough remaining address space in %s for a subnet of %d bits", prefix, bits)
+		}
+		subnets = append(subnets, netip.PrefixFrom(space.address(start), bits).String())
+	}
+	return subnets, nil
+}
+
+// cidrnetmask returns the dotted netmask of an IPv4 prefix, e.g.
+// {{ cidrnetmask "192.168.106.0/24" }} is 255.255.255.0
+func cidrnetmask(prefix string) (string, error) {
+	space, err := parseAddressSpace(prefix)
+	if err != nil {
+		return "", fmt.Errorf("cidrnetmask: %w", err)
+	}
+	if !space.ipv4 {
+		return "", fmt.Errorf("cidrnetmask: %s is not IPv4; only IPv4 prefixes have a netmask", prefix)
+	}
+	mask := new(big.Int).Sub(space.size(0), space.size(space.bits))
+	return space.address(mask).String(), nil
+}
+
+// cidrprefixlen returns the prefix length of a CIDR prefix, e.g. for the
+// address/prefix form cloud-init expects:
+// {{ .IP }}/{{ cidrprefixlen .Network.CIDR }}
+func cidrprefixlen(prefix string) (int, error) {
+	space, err := parseAddressSpace(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("cidrprefixlen: %w", err)
+	}
+	return space.bits, nil
+}
+
+// ipRange returns the addresses numbered first to last within prefix as the
+// first-last range MetalLB and DHCP pools take; negative numbers count back
+// from the last address, e.g. {{ ipRange "192.168.106.0/24" 240 -2 }} is
+// 192.168.106.240-192.168.106.254
+func ipRange(prefix string, first, last int) (string, error) {
+	space, err := parseAddressSpace(prefix)
+	if err != nil {
+		return "", fmt.Errorf("ipRange: %w", err)
+	}
+	from, err := space.host(first)
+	if err != nil {
+		return "", fmt.Errorf("ipRange: %w", err)
+	}
+	to, err := space.host(last)
+	if err != nil {
+		return "", fmt.Errorf("ipRange: %w", err)
+	}
+	if to.Less(from) {
+		return "", fmt.Errorf("ipRange: %s comes before %s", to, from)
+	}
+	return from.String() + "-" + to.String(), nil
+}
@@ -0,0 +1,58 @@
+package template
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNetworkFunctions(t *testing.T) {
+	// Expected values are those of Terraform's functions of the same name
+	tests := []struct {
+		text, want string
+	}{
+		{`{{ cidrhost "10.12.112.0/20" 16 }}`, "10.12.112.16"},
+		{`{{ cidrhost "10.12.112.0/20" 268 }}`, "10.12.113.12"},
+		{`{{ cidrhost "10.0.0.0/24" -2 }}`, "10.0.0.254"},
+		{`{{ cidrhost "192.168.106.17/24" 1 }}`, "192.168.106.1"},
+		{`{{ cidrhost "fd00:fd12:3456:7890:00a2::/72" 34 }}`, "fd00:fd12:3456:7890::22"},
+		{`{{ cidrsubnet "172.16.0.0/12" 4 2 }}`, "172.18.0.0/16"},
+		{`{{ cidrsubnet "10.1.2.0/24" 4 15 }}`, "10.1.2.240/28"},
+		{`{{ cidrsubnet "fd00:fd12:3456:7890::/56" 16 162 }}`, "fd00:fd12:3456:7800:a200::/72"},
+		{`{{ join (cidrsubnets "10.1.0.0/16" 4 4 8 4) " " }}`, "10.1.0.0/20 10.1.16.0/20 10.1.32.0/24 10.1.48.0/20"},
+		{`{{ join (cidrsubnets "fd00:fd12:3456:7890::/56" 16 16 16 32) " " }}`, "fd00:fd12:3456:7800::/72 fd00:fd12:3456:7800:100::/72 fd00:fd12:3456:7800:200::/72 fd00:fd12:3456:7800:300::/88"},
+		{`{{ cidrnetmask "172.16.0.0/12" }} {{ cidrnetmask "10.0.0.0/32" }} {{ cidrnetmask "0.0.0.0/0" }}`, "255.240.0.0 255.255.255.255 0.0.0.0"},
+		{`{{ cidrprefixlen "192.168.106.0/24" }} {{ cidrprefixlen "fd00::/56" }}`, "24 56"},
+		{`{{ ipRange "192.168.106.0/24" 240 -2 }}`, "192.168.106.240-192.168.106.254"},
+		{`{{ ipRange "fd00::/120" 16 31 }}`, "fd00::10-fd00::1f"},
+	}
+	for _, test := range tests {
+		got, err := renderText(t, test.text, nil)
+		if err != nil {
+			t.Fatalf("render %s: %v", test.text, err)
+		}
+		if got != test.want {
+			t.Fatalf("%s = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestNetworkFunctionsRejectOutOfRange(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{`{{ cidrhost "10.0.0.0/24" 256 }}`, "cannot accommodate a host numbered 256"},
+		{`{{ cidrhost "10.0.0.0/24" -257 }}`, "cannot accommodate a host numbered -257"},
+		{`{{ cidrhost "10.0.0.0" 1 }}`, `invalid CIDR prefix "10.0.0.0"`},
+		{`{{ cidrsubnet "10.0.0.0/24" 9 0 }}`, "prefix of 33 bits"},
+		{`{{ cidrsubnet "10.0.0.0/16" 2 4 }}`, "cannot accommodate a subnet numbered 4"},
+		{`{{ cidrsubnets "10.0.0.0/24" 1 1 1 }}`, "not enough remaining address space"},
+		{`{{ cidrnetmask "fd00::/64" }}`, "only IPv4"},
+		{`{{ ipRange "10.0.0.0/24" 20 10 }}`, "10.0.0.10 comes before 10.0.0.20"},
+	}
+	for _, test := range tests {
+		_, err := renderText(t, test.text, nil)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Fatalf("%s: expected an error containing %q, got %v", test.text, test.want, err)
+		}
+	}
+}
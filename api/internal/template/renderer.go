@@ -3,18 +3,34 @@ package template
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"text/template"
 
 	"gopkg.in/yaml.v3"
+
+	"pn-infra/api/internal/cache"
 )
 
+// FuncMapVersion identifies the behaviour of the template functions and
+// parse options, such as missingkey=error. Bump it whenever either changes
+// what a template renders so cached renders are invalidated.
+const FuncMapVersion = "4"
+
 // Renderer handles Go template rendering with custom functions
 type Renderer struct {
 	RepoRoot string
+
+	// Cache, when set, holds checked renders keyed by template content,
+	// FuncMapVersion, output type and data, so RenderChecked can skip both
+	// rendering and checks for unchanged artifacts
+	Cache *cache.Cache
+
+	hits, misses atomic.Int64
 }
 
 // NewRenderer creates a new template renderer
@@ -24,32 +40,175 @@ func NewRenderer(repoRoot string) *Renderer {
 
 // Render renders a template file with the given data
 func (r *Renderer) Render(templatePath string, data interface{}) (string, error) {
-	// Read template file
-	content, err := os.ReadFile(templatePath)
-	if err != nil {
-		return "", fmt.Errorf("read template %s: %w", templatePath, err)
-	}
+	return r.RenderSource(Source{Path: templatePath}, data)
+}
 
-	// Create template with custom functions
-	tmpl, err := template.New(filepath.Base(templatePath)).
-		Funcs(r.funcMap()).
-		Parse(string(content))
+// RenderSource renders a template resolved along the search path, with its
+// override files layered on top, with the given data
+func (r *Renderer) RenderSource(src Source, data interface{}) (string, error) {
+	tmpl, contents, err := r.parse(src)
 	if err != nil {
-		return "", fmt.Errorf("parse template %s: %w", templatePath, err)
+		return "", err
 	}
 
 	// Execute template
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, data); err != nil {
-		return "", fmt.Errorf("execute template %s: %w", templatePath, err)
+		return "", renderError(src, contents, err)
 	}
 
 	return buf.String(), nil
 }
 
-// RenderToFile renders a template and writes the output to a file
-func (r *Renderer) RenderToFile(templatePath, outputPath string, data interface{}) error {
-	content, err := r.Render(templatePath, data)
+// maxIncludeDepth bounds nested include calls so a partial that includes
+// itself fails instead of exhausting the stack
+const maxIncludeDepth = 64
+
+// parse parses the template body, then the shared partials, then each
+// override file so that its define blocks replace the same-named sections.
+// It also returns the content of each file, keyed by the template name its
+// trees are parsed under. Looking up a missing map key is an error rather
+// than rendering "<no value>"; parse errors are *RenderError.
+func (r *Renderer) parse(src Source) (*template.Template, map[string][]byte, error) {
+	contents := make(map[string][]byte, len(src.Files()))
+	var tmpl *template.Template
+
+	// include executes a named template and returns its output, so that a
+	// partial can be piped through indent, toJson and the like
+	funcs := r.funcMap()
+	depth := 0
+	funcs["include"] = func(name string, data interface{}) (string, error) {
+		if depth >= maxIncludeDepth {
+			return "", fmt.Errorf("include %q: nested more than %d deep", name, maxIncludeDepth)
+		}
+		depth++
+		defer func() { depth-- }()
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	for _, path := range src.Files() {
+		// Read template file
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read template %s: %w", path, err)
+		}
+
+		// Create template with custom functions; override files are named by
+		// path so errors in them point at the right file
+		var next *template.Template
+		if tmpl == nil {
+			tmpl = template.New(filepath.Base(path)).Funcs(funcs).Option("missingkey=error")
+			next = tmpl
+		} else {
+			next = tmpl.New(path)
+		}
+		contents[next.Name()] = content
+		if _, err := next.Parse(string(content)); err != nil {
+			return nil, nil, renderError(src, contents, err)
+		}
+	}
+	return tmpl, contents, nil
+}
+
+// HeaderPartial is the shared partial with the provenance comment of
+// generated YAML
+const HeaderPartial = "pn.header"
+
+// Header renders the HeaderPartial from the shared partials on the search
+// path of resolver, ending in a newline, so that outputs built in Go carry
+// the same header as rendered templates
+func (r *Renderer) Header(resolver *PathResolver, data interface{}) (string, error) {
+	helpers, err := resolver.Helpers()
+	if err != nil {
+		return "", err
+	}
+	if len(helpers) == 0 {
+		return "", fmt.Errorf("render %s: no %s directory on the search path", HeaderPartial, HelpersDir)
+	}
+	src := Source{Path: helpers[0], Helpers: helpers[1:]}
+	tmpl, contents, err := r.parse(src)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, HeaderPartial, data); err != nil {
+		return "", renderError(src, contents, err)
+	}
+	return buf.String() + "\n", nil
+}
+
+// Check inspects rendered content before it is written to outputPath. Errors
+// implementing OutputLine() int are mapped back to the template line.
+type Check func(outputPath string, content []byte) error
+
+// RenderChecked renders a template and runs the checks against the content
+// destined for outputPath, without writing it. With a Cache, content that
+// passed the checks is stored and later renders of the same template and data
+// for the same output type return it directly; callers sharing a cache must
+// use the same checks.
+func (r *Renderer) RenderChecked(src Source, outputPath string, data interface{}, checks ...Check) (string, error) {
+	key := r.cacheKey(src, outputPath, data)
+	if key != "" {
+		if content, ok := r.Cache.Get(key); ok {
+			r.hits.Add(1)
+			return string(content), nil
+		}
+		r.misses.Add(1)
+	}
+
+	content, err := r.RenderSource(src, data)
+	if err != nil {
+		return "", err
+	}
+
+	for _, check := range checks {
+		if err := check(outputPath, []byte(content)); err != nil {
+			return "", r.checkError(src, data, err)
+		}
+	}
+
+	if key != "" {
+		// A failed write only costs a re-render next time
+		r.Cache.Put(key, []byte(content))
+	}
+	return content, nil
+}
+
+// CacheCounts returns the render cache hits and misses of this renderer
+func (r *Renderer) CacheCounts() (hits, misses int64) {
+	return r.hits.Load(), r.misses.Load()
+}
+
+// cacheKey returns the render cache key for a template, output type and data,
+// or "" when there is no cache or the data cannot be hashed canonically.
+// Data is hashed as JSON, which emits map keys sorted.
+func (r *Renderer) cacheKey(src Source, outputPath string, data interface{}) string {
+	if r.Cache == nil {
+		return ""
+	}
+	canonical, err := json.Marshal(stringKeys(data))
+	if err != nil {
+		return ""
+	}
+	parts := [][]byte{[]byte("render"), []byte(FuncMapVersion), []byte(filepath.Ext(outputPath)), canonical}
+	for _, path := range src.Files() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+		parts = append(parts, content)
+	}
+	return cache.Key(parts...)
+}
+
+// RenderToFile renders a template and writes the output to a file. Nothing is
+// written if any of the checks rejects the rendered content.
+func (r *Renderer) RenderToFile(templatePath, outputPath string, data interface{}, checks ...Check) error {
+	content, err := r.RenderChecked(Source{Path: templatePath}, outputPath, data, checks...)
 	if err != nil {
 		return err
 	}
@@ -67,12 +226,28 @@ func (r *Renderer) RenderToFile(templatePath, outputPath string, data interface{
 	return nil
 }
 
+// checkError annotates a failed check with the template file and line that
+// produced the offending output line, when it can be determined
+func (r *Renderer) checkError(src Source, data interface{}, err error) error {
+	var located interface{ OutputLine() int }
+	if errors.As(err, &located) && located.OutputLine() > 0 {
+		if path, line, mapErr := r.SourceLine(src, data, located.OutputLine()); mapErr == nil {
+			return fmt.Errorf("invalid output: %w (template %s:%d)", err, path, line)
+		}
+	}
+	return fmt.Errorf("invalid output: %w (template %s)", err, src.Path)
+}
+
 // funcMap returns custom template functions
 func (r *Renderer) funcMap() template.FuncMap {
 	return template.FuncMap{
-		// JSON/YAML conversion
-		"toJson": toJSON,
-		"toYaml": toYAML,
+		// JSON/YAML/TOML conversion
+		"toJson":   toJSON,
+		"toHcl":    toHCL,
+		"toYaml":   toYAML,
+		"toToml":   toTOML,
+		"fromJson": fromJSON,
+		"fromYaml": fromYAML,
 
 		// String manipulation
 		"indent":  indent,
@@ -82,10 +257,30 @@ func (r *Renderer) funcMap() template.FuncMap {
 		"replace": strings.ReplaceAll,
 		"trim":    strings.TrimSpace,
 
+		// Encoding and hashing
+		"b64enc":    b64enc,
+		"b64dec":    b64dec,
+		"sha256sum": sha256sum,
+
 		// List operations
-		"has":   has,
-		"join":  strings.Join,
-		"split": strings.Split,
+		"has":       has,
+		"join":      strings.Join,
+		"split":     strings.Split,
+		"list":      list,
+		"sortAlpha": sortAlpha,
+
+		// Maps; dict also builds partial arguments, e.g.
+		// include "pn.hosts" (dict "Hosts" .Hosts "Group" "etcd")
+		"dict":  dict,
+		"merge": merge,
+		"keys":  keys,
+
+		// Defaults and failures
+		"default":  defaultValue,
+		"required": required,
+		"fail":     fail,
+		"coalesce": coalesce,
+		"ternary":  ternary,
 
 		// Arithmetic
 		"add": add,
@@ -93,15 +288,30 @@ func (r *Renderer) funcMap() template.FuncMap {
 		"mul": mul,
 		"div": div,
 
+		// Comparisons, which error on values of incompatible types
+		"eq": eq,
+		"ne": ne,
+		"lt": lt,
+		"le": le,
+		"gt": gt,
+		"ge": ge,
+
 		// Conditionals
-		"eq":  eq,
-		"ne":  ne,
-		"lt":  lt,
-		"gt":  gt,
 		"and": and,
 		"or":  or,
 		"not": not,
 
+		// Network addressing, as in Terraform
+		"cidrhost":      cidrhost,
+		"cidrsubnet":    cidrsubnet,
+		"cidrsubnets":   cidrsubnets,
+		"cidrnetmask":   cidrnetmask,
+		"cidrprefixlen": cidrprefixlen,
+		"ipRange":       ipRange,
+
+		// Versions
+		"semverCompare": semverCompare,
+
 		// Range utilities
 		"until": until,
 		"seq":   seq,
@@ -110,14 +320,61 @@ func (r *Renderer) funcMap() template.FuncMap {
 
 // Template function implementations
 
+// toJSON encodes v as compact JSON. Map keys are emitted sorted, including
+// those of maps with non-string keys decoded from YAML, so output does not
+// depend on map iteration order.
 func toJSON(v interface{}) (string, error) {
-	data, err := json.Marshal(v)
+	data, err := json.Marshal(stringKeys(v))
 	if err != nil {
 		return "", err
 	}
 	return string(data), nil
 }
 
+// toHCL encodes v as an HCL expression for .tfvars files: a quoted string,
+// a list or an object. JSON is valid HCL expression syntax except that HCL
+// reads ${ and %{ inside strings as interpolation, so those are escaped as
+// $${ and %%{. Neither sequence can occur in JSON outside a string.
+func toHCL(v interface{}) (string, error) {
+	data, err := toJSON(v)
+	if err != nil {
+		return "", err
+	}
+	return hclEscaper.Replace(data), nil
+}
+
+var hclEscaper = strings.NewReplacer("${", "$${", "%{", "%%{")
+
+// stringKeys converts the map[interface{}]interface{} values that YAML
+// decoding produces for non-string keys, which encoding/json rejects, into
+// maps keyed by the keys' string form
+func stringKeys(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			converted[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return converted
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			converted[key] = stringKeys(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, item := range value {
+			converted[i] = stringKeys(item)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+// toYAML encodes v as YAML. yaml.v3 emits map keys sorted (numbers within
+// keys compare numerically), so output does not depend on map iteration order.
 func toYAML(v interface{}) (string, error) {
 	data, err := yaml.Marshal(v)
 	if err != nil {
@@ -150,6 +407,23 @@ func has(needle string, haystack []string) bool {
 	return false
 }
 
+// dict builds a map from alternating keys and values, so a partial can take
+// several arguments
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments (%d)", len(pairs))
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is %T, not a string", pairs[i], pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
 func add(a, b int) int {
 	return a + b
 }
@@ -162,29 +436,6 @@ func mul(a, b int) int {
 	return a * b
 }
 
-func div(a, b int) int {
-	if b == 0 {
-		return 0
-	}
-	return a / b
-}
-
-func eq(a, b interface{}) bool {
-	return a == b
-}
-
-func ne(a, b interface{}) bool {
-	return a != b
-}
-
-func lt(a, b int) bool {
-	return a < b
-}
-
-func gt(a, b int) bool {
-	return a > b
-}
-
 func and(a, b bool) bool {
 	return a && b
 }
@@ -197,21 +448,33 @@ func not(a bool) bool {
 	return !a
 }
 
-func until(count int) []int {
+// maxRangeLength bounds the lists until and seq return. Their lengths may
+// come from config, where a mistyped count must fail the render rather than
+// exhaust memory.
+const maxRangeLength = 10000
+
+func until(count int) ([]int, error) {
+	if count < 0 || count > maxRangeLength {
+		return nil, fmt.Errorf("until: count %d is outside 0..%d", count, maxRangeLength)
+	}
 	result := make([]int, count)
 	for i := 0; i < count; i++ {
 		result[i] = i
 	}
-	return result
+	return result, nil
 }
 
-func seq(start, end int) []int {
+func seq(start, end int) ([]int, error) {
 	if start > end {
-		return []int{}
+		return []int{}, nil
+	}
+	// end-start overflows to a negative length for far apart bounds
+	if length := end - start + 1; length <= 0 || length > maxRangeLength {
+		return nil, fmt.Errorf("seq: %d..%d has more than %d numbers", start, end, maxRangeLength)
 	}
 	result := make([]int, end-start+1)
 	for i := range result {
 		result[i] = start + i
 	}
-	return result
+	return result, nil
 }
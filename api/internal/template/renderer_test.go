@@ -0,0 +1,120 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pn-infra/api/internal/cache"
+)
+
+func TestRenderToFileMapsCheckErrorToTemplateLine(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "business.yaml.tmpl")
+	source := "# header\napplications:\n{{- range .Apps }}\n  {{ . }}: true\n{{- end }}\n  web: false\n"
+	if err := os.WriteFile(templatePath, []byte(source), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	data := map[string][]string{"Apps": {"api", "web"}}
+	renderer := NewRenderer(dir)
+	_, line, err := renderer.SourceLine(Source{Path: templatePath}, data, 4)
+	if err != nil {
+		t.Fatalf("source line: %v", err)
+	}
+	if line != 4 {
+		t.Fatalf("expected output line 4 to map to template line 4, got %d", line)
+	}
+	if _, line, err = renderer.SourceLine(Source{Path: templatePath}, data, 5); err != nil || line != 6 {
+		t.Fatalf("expected output line 5 to map to template line 6, got %d (%v)", line, err)
+	}
+
+	outputPath := filepath.Join(dir, "out", "business.yaml")
+	check := func(path string, content []byte) error { return lineError(5) }
+	err = renderer.RenderToFile(templatePath, outputPath, data, check)
+	if err == nil || !strings.Contains(err.Error(), "business.yaml.tmpl:6") {
+		t.Fatalf("expected error mapped to template line 6, got %v", err)
+	}
+	if _, statErr := os.Stat(outputPath); !os.IsNotExist(statErr) {
+		t.Fatalf("output must not be written when a check fails")
+	}
+}
+
+type lineError int
+
+func (e lineError) Error() string   { return "bad line" }
+func (e lineError) OutputLine() int { return int(e) }
+
+func TestRenderIsByteIdenticalAcrossRuns(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "values.yaml.tmpl")
+	source := "json: {{ toJson .Values }}\nyaml:\n{{ toYaml .Values | indent 2 }}\n{{- range $k, $v := .Labels }}\n{{ $k }}: {{ $v }}\n{{- end }}\n"
+	if err := os.WriteFile(templatePath, []byte(source), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	labels := map[string]string{}
+	values := map[string]interface{}{}
+	for i := 0; i < 50; i++ {
+		key := string(rune('a'+i%26)) + strings.Repeat("x", i/26)
+		labels[key] = key
+		values[key] = map[interface{}]interface{}{i: key, "nested": []interface{}{map[string]interface{}{"z": 1, "a": 2}}}
+	}
+	data := map[string]interface{}{"Values": values, "Labels": labels}
+
+	renderer := NewRenderer(dir)
+	first, err := renderer.Render(templatePath, data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for run := 0; run < 20; run++ {
+		again, err := renderer.Render(templatePath, data)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if again != first {
+			t.Fatalf("run %d differs from the first run", run)
+		}
+	}
+	if !strings.Contains(first, `"nested":[{"a":2,"z":1}]`) {
+		t.Fatalf("expected sorted JSON keys, got:\n%s", first)
+	}
+	if strings.Index(first, "\na: a\n") > strings.Index(first, "\nb: b\n") {
+		t.Fatalf("expected ranged map keys in sorted order, got:\n%s", first)
+	}
+}
+
+func TestRenderCheckedUsesCacheForUnchangedInputs(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "platform.yaml.tmpl")
+	if err := os.WriteFile(templatePath, []byte("env: {{ .Env }}\n"), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	renderer := NewRenderer(dir)
+	renderer.Cache = cache.New(filepath.Join(dir, ".cache"))
+	checked := 0
+	check := func(path string, content []byte) error { checked++; return nil }
+
+	for _, env := range []string{"dev", "dev", "prod"} {
+		content, err := renderer.RenderChecked(Source{Path: templatePath}, "out/platform.yaml", map[string]string{"Env": env}, check)
+		if err != nil || content != "env: "+env+"\n" {
+			t.Fatalf("render %s = %q (%v)", env, content, err)
+		}
+	}
+	if checked != 2 {
+		t.Fatalf("expected the repeated render to skip checks, ran them %d times", checked)
+	}
+	if hits, misses := renderer.CacheCounts(); hits != 1 || misses != 2 {
+		t.Fatalf("cache counts = %d hits, %d misses, want 1 and 2", hits, misses)
+	}
+
+	if err := os.WriteFile(templatePath, []byte("environment: {{ .Env }}\n"), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	content, err := renderer.RenderChecked(Source{Path: templatePath}, "out/platform.yaml", map[string]string{"Env": "dev"}, check)
+	if err != nil || content != "environment: dev\n" {
+		t.Fatalf("expected a changed template to miss the cache, got %q (%v)", content, err)
+	}
+}
@@ -1,171 +1,281 @@
 package template
 
 import (
+	"bytes"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
+	"text/template/parse"
 
 	"pn-infra/api/internal/config"
 )
 
+// Template origins, from highest to lowest precedence on the search path
+const (
+	OriginEnvironment = "environment"
+	OriginPackage     = "package"
+	OriginBuiltin     = "builtin"
+)
+
+// SearchDir is a directory on the template search path. Templates are
+// looked up by their path relative to the directory.
+type SearchDir struct {
+	Dir    string
+	Origin string
+}
+
+// SearchPath returns the template search path of an environment: its
+// overrides in the config package, the config package's templates, then the
+// built-in templates
+func SearchPath(repoRoot, configPackage, environment string) []SearchDir {
+	packageDir := filepath.Join(repoRoot, "config", "packages", configPackage)
+	return []SearchDir{
+		{Dir: filepath.Join(packageDir, "environments", environment, "templates"), Origin: OriginEnvironment},
+		{Dir: filepath.Join(packageDir, "templates"), Origin: OriginPackage},
+		{Dir: filepath.Join(repoRoot, "api", "templates"), Origin: OriginBuiltin},
+	}
+}
+
 // PathResolver resolves template paths based on master config selections
 type PathResolver struct {
 	RepoRoot string
+
+	// SearchPath lists the template directories, highest precedence first.
+	// NewPathResolver sets it to the built-in templates only.
+	SearchPath []SearchDir
 }
 
 // NewPathResolver creates a new template path resolver
 func NewPathResolver(repoRoot string) *PathResolver {
-	return &PathResolver{RepoRoot: repoRoot}
+	return &PathResolver{
+		RepoRoot:   repoRoot,
+		SearchPath: []SearchDir{{Dir: filepath.Join(repoRoot, "api", "templates"), Origin: OriginBuiltin}},
+	}
 }
 
 // TemplatePaths holds all resolved template paths for an environment
 type TemplatePaths struct {
-	Infrastructure           string
-	ContainerOrchestration   ContainerOrchestrationPaths
-	Provisioner              string
-	Platform                 string
-	Business                 string
+	Infrastructure         []Target
+	ContainerOrchestration []Target
+	Provisioner            Source
+	Platform               Source
+	Business               Source
+}
+
+// Target is a registered template resolved along the search path, together
+// with its output path relative to the environment output directory
+type Target struct {
+	Name     string
+	Template Source
+	Output   string
 }
 
-// ContainerOrchestrationPaths holds orchestrator-specific template paths
-type ContainerOrchestrationPaths struct {
-	Inventory     string
-	Config        string
-	GroupVarsAll  string
-	GroupVarsK8s  string
+// Source is a template resolved along the search path: the file providing
+// the template body and the override files layered on top of it. An override
+// file holds only {{ define }} blocks, which replace the same-named
+// {{ block }} or {{ define }} sections of the files below it.
+type Source struct {
+	Path      string   // absolute path of the template body
+	Origin    string   // search directory origin of Path
+	Helpers   []string // absolute paths of the shared partials, in parse order
+	Overrides []string // absolute paths of override files, lowest precedence first
 }
 
+// Files returns the body, the partials and the override files, in parse order
+func (s Source) Files() []string {
+	files := make([]string, 0, 1+len(s.Helpers)+len(s.Overrides))
+	files = append(files, s.Path)
+	files = append(files, s.Helpers...)
+	return append(files, s.Overrides...)
+}
+
+// HelpersDir is the directory of shared partials in each template directory.
+// Its *.tmpl files hold only {{ define }} blocks, which every template can
+// use with {{ template }} or include.
+const HelpersDir = "_helpers"
+
 // Resolve resolves all template paths based on master config
 func (r *PathResolver) Resolve(masterConfig *config.MasterConfig) (*TemplatePaths, error) {
 	paths := &TemplatePaths{}
 
-	// Infrastructure template path (skip if platform is "none")
-	platform := masterConfig.Infrastructure.Platform
-	provider := masterConfig.Infrastructure.Provider
-	if platform != "none" {
-		paths.Infrastructure = filepath.Join(
-			r.RepoRoot,
-			"api", "templates", "infrastructure",
-			platform, provider, "terraform.tfvars.tmpl",
-		)
-	}
-
-	// Container orchestration template paths
-	orchestrator := masterConfig.ContainerOrchestration.Orchestrator
-	switch orchestrator {
-	case "kubespray":
-		paths.ContainerOrchestration = ContainerOrchestrationPaths{
-			Inventory: filepath.Join(
-				r.RepoRoot,
-				"api", "templates", "container-orchestration",
-				"kubespray", "inventory.ini.tmpl",
-			),
-			GroupVarsAll: filepath.Join(
-				r.RepoRoot,
-				"api", "templates", "container-orchestration",
-				"kubespray", "group_vars", "all.yaml.tmpl",
-			),
-			GroupVarsK8s: filepath.Join(
-				r.RepoRoot,
-				"api", "templates", "container-orchestration",
-				"kubespray", "group_vars", "k8s_cluster.yaml.tmpl",
-			),
+	// Infrastructure template paths (skip if platform is "none")
+	if masterConfig.Infrastructure.Platform != "none" {
+		platform, err := config.LookupPlatform(masterConfig.Infrastructure.Platform)
+		if err != nil {
+			return nil, err
 		}
-	case "kubekey":
-		paths.ContainerOrchestration = ContainerOrchestrationPaths{
-			Config: filepath.Join(
-				r.RepoRoot,
-				"api", "templates", "container-orchestration",
-				orchestrator, "config.yaml.tmpl",
-			),
+		specs, err := platform.Templates(masterConfig.Infrastructure)
+		if err != nil {
+			return nil, err
 		}
-	case "kind":
-		paths.ContainerOrchestration = ContainerOrchestrationPaths{
-			Config: filepath.Join(
-				r.RepoRoot,
-				"api", "templates", "container-orchestration",
-				"kind", "config-simple.yaml.tmpl",
-			),
+		if paths.Infrastructure, err = r.resolveTargets(specs); err != nil {
+			return nil, err
 		}
-	default:
-		return nil, fmt.Errorf("unsupported orchestrator: %s", orchestrator)
+	}
+
+	// Container orchestration template paths
+	orchestrator, err := config.LookupOrchestrator(masterConfig.ContainerOrchestration.Orchestrator)
+	if err != nil {
+		return nil, err
+	}
+	if paths.ContainerOrchestration, err = r.resolveTargets(orchestrator.Templates()); err != nil {
+		return nil, err
 	}
 
 	// Provisioner template path
-	paths.Provisioner = filepath.Join(
-		r.RepoRoot,
-		"api", "templates", "provisioner", "provisioner.json.tmpl",
-	)
+	if paths.Provisioner, err = r.Find(filepath.Join("provisioner", "provisioner.json.tmpl")); err != nil {
+		return nil, err
+	}
 
 	// Platform template path
-	paths.Platform = filepath.Join(
-		r.RepoRoot,
-		"api", "templates", "platform", "platform.yaml.tmpl",
-	)
+	if paths.Platform, err = r.Find(filepath.Join("platform", "platform.yaml.tmpl")); err != nil {
+		return nil, err
+	}
 
 	// Business template path
-	paths.Business = filepath.Join(
-		r.RepoRoot,
-		"api", "templates", "business", "business.yaml.tmpl",
-	)
+	if paths.Business, err = r.Find(filepath.Join("business", "business.yaml.tmpl")); err != nil {
+		return nil, err
+	}
 
 	return paths, nil
 }
 
-// OutputPaths holds all output file paths for an environment
-type OutputPaths struct {
-	OutputDir                string
-	Metadata                 string
-	Infrastructure           string
-	ContainerOrchestration   ContainerOrchestrationOutputs
-	Provisioner              string
-	Platform                 string
-	Business                 string
-}
-
-// ContainerOrchestrationOutputs holds orchestrator-specific output paths
-type ContainerOrchestrationOutputs struct {
-	Directory    string
-	Inventory    string
-	Config       string
-	GroupVarsDir string
-	GroupVarsAll string
-	GroupVarsK8s string
-}
-
-// ResolveOutputPaths resolves all output file paths for an environment
-func (r *PathResolver) ResolveOutputPaths(environment string, orchestrator string) *OutputPaths {
-	outputDir := filepath.Join(r.RepoRoot, "api", "outputs", environment)
+func (r *PathResolver) resolveTargets(specs []config.TemplateSpec) ([]Target, error) {
+	targets := make([]Target, 0, len(specs))
+	for _, spec := range specs {
+		source, err := r.Find(spec.Template)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, Target{
+			Name:     spec.Name,
+			Template: source,
+			Output:   spec.Output,
+		})
+	}
+	return targets, nil
+}
 
-	paths := &OutputPaths{
-		OutputDir:      outputDir,
-		Metadata:       filepath.Join(outputDir, "metadata.json"),
-		Infrastructure: filepath.Join(outputDir, "terraform.tfvars"),
-		Provisioner:    filepath.Join(outputDir, "provisioner.json"),
-		Platform:       filepath.Join(outputDir, "platform.yaml"),
-		Business:       filepath.Join(outputDir, "business.yaml"),
-	}
-
-	// Container orchestration outputs
-	switch orchestrator {
-	case "kubespray":
-		kubesprayDir := filepath.Join(outputDir, "kubespray")
-		groupVarsDir := filepath.Join(kubesprayDir, "group_vars")
-		paths.ContainerOrchestration = ContainerOrchestrationOutputs{
-			Directory:    kubesprayDir,
-			Inventory:    filepath.Join(kubesprayDir, "inventory.ini"),
-			GroupVarsDir: groupVarsDir,
-			GroupVarsAll: filepath.Join(groupVarsDir, "all.yaml"),
-			GroupVarsK8s: filepath.Join(groupVarsDir, "k8s_cluster.yaml"),
+// Find resolves a template path, relative to the template directories, along
+// the search path. The first file found that is not an override file
+// provides the body; override files found before it are layered on top.
+func (r *PathResolver) Find(relative string) (Source, error) {
+	var overrides []string
+	for _, dir := range r.SearchPath {
+		path := filepath.Join(dir.Dir, relative)
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Source{}, fmt.Errorf("read template %s: %w", path, err)
+		}
+		override, err := definesOnly(path, content)
+		if err != nil {
+			return Source{}, err
+		}
+		if override {
+			overrides = append([]string{path}, overrides...)
+			continue
+		}
+		helpers, err := r.Helpers()
+		if err != nil {
+			return Source{}, err
 		}
-	case "kubekey":
-		paths.ContainerOrchestration = ContainerOrchestrationOutputs{
-			Config: filepath.Join(outputDir, "kubekey", "config.yaml"),
+		return Source{Path: path, Origin: dir.Origin, Helpers: helpers, Overrides: overrides}, nil
+	}
+	if len(overrides) > 0 {
+		return Source{}, fmt.Errorf("template %s: %s only overrides sections, but no search directory provides the template", relative, overrides[len(overrides)-1])
+	}
+	return Source{}, fmt.Errorf("template %s not found on the search path", relative)
+}
+
+// Helpers lists the partial files of every directory on the search path,
+// built-in first, so that a package or environment partial replaces a
+// same-named definition from the directories below it
+func (r *PathResolver) Helpers() ([]string, error) {
+	var helpers []string
+	for i := len(r.SearchPath) - 1; i >= 0; i-- {
+		paths, err := filepath.Glob(filepath.Join(r.SearchPath[i].Dir, HelpersDir, "*.tmpl"))
+		if err != nil {
+			return nil, err
 		}
-	case "kind":
-		paths.ContainerOrchestration = ContainerOrchestrationOutputs{
-			Config: filepath.Join(outputDir, "kind", "config.yaml"),
+		for _, path := range paths {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("read template helpers %s: %w", path, err)
+			}
+			ok, err := definesOnly(path, content)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("template helpers %s must contain only {{ define }} blocks", path)
+			}
 		}
+		helpers = append(helpers, paths...)
+	}
+	return helpers, nil
+}
+
+// definesOnly reports whether a template consists only of {{ define }}
+// blocks (and whitespace or comments), making it an override file
+func definesOnly(path string, content []byte) (bool, error) {
+	tree := parse.New(path)
+	tree.Mode = parse.SkipFuncCheck | parse.ParseComments
+	defined := map[string]*parse.Tree{}
+	if _, err := tree.Parse(string(content), "", "", defined); err != nil {
+		return false, fmt.Errorf("parse template %s: %w", path, err)
 	}
+	delete(defined, path) // the file's own top-level template
+	if len(defined) == 0 {
+		return false, nil
+	}
+	for _, node := range tree.Root.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			if len(bytes.TrimSpace(n.Text)) > 0 {
+				return false, nil
+			}
+		case *parse.CommentNode:
+		default:
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// OutputPaths holds all output file paths for an environment
+type OutputPaths struct {
+	Environment string
+	OutputDir   string
+	Metadata    string
+	Provisioner string
+	Platform    string
+	Business    string
+	Operations  string
+}
+
+// ResolveOutputPaths resolves the fixed output file paths for an environment.
+// Provider outputs are resolved with Path from their Target or Artifact.
+func (r *PathResolver) ResolveOutputPaths(environment string) *OutputPaths {
+	outputDir := filepath.Join(r.RepoRoot, "api", "outputs", environment)
+
+	return &OutputPaths{
+		Environment: environment,
+		OutputDir:   outputDir,
+		Metadata:    filepath.Join(outputDir, "metadata.json"),
+		Provisioner: filepath.Join(outputDir, "provisioner.json"),
+		Platform:    filepath.Join(outputDir, "platform.yaml"),
+		Business:    filepath.Join(outputDir, "business.yaml"),
+		Operations:  filepath.Join(outputDir, "operations.json"),
+	}
+}
 
-	return paths
+// Path returns the absolute path of an output relative to the output
+// directory, expanding the environment placeholder
+func (o *OutputPaths) Path(relative string) string {
+	relative = strings.ReplaceAll(relative, config.EnvironmentPlaceholder, o.Environment)
+	return filepath.Join(o.OutputDir, relative)
 }
@@ -0,0 +1,160 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pn-infra/api/internal/config"
+)
+
+func writeTemplate(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+}
+
+func TestFindLayersOverridesAlongSearchPath(t *testing.T) {
+	repo := t.TempDir()
+	relative := filepath.Join("container-orchestration", "kubespray", "inventory.ini.tmpl")
+	builtin := filepath.Join(repo, "api", "templates", relative)
+	writeTemplate(t, builtin, "[all]\n{{ block \"hosts\" . }}{{ range .Hosts }}{{ . }}\n{{ end }}{{ end }}\n[etcd]\n{{ block \"etcd\" . }}{{ index .Hosts 0 }}\n{{ end }}")
+
+	resolver := NewPathResolver(repo)
+	resolver.SearchPath = SearchPath(repo, "core", "development")
+	source, err := resolver.Find(relative)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if source.Path != builtin || source.Origin != OriginBuiltin || len(source.Overrides) != 0 {
+		t.Fatalf("expected the built-in template, got %+v", source)
+	}
+
+	packageOverride := filepath.Join(repo, "config", "packages", "core", "templates", relative)
+	envOverride := filepath.Join(repo, "config", "packages", "core", "environments", "development", "templates", relative)
+	writeTemplate(t, packageOverride, "{{ define \"hosts\" }}{{ range .Hosts }}{{ . }} ansible_user=ops\n{{ end }}{{ end }}\n{{ define \"etcd\" }}pkg\n{{ end }}")
+	writeTemplate(t, envOverride, "{{/* development only */}}\n{{ define \"etcd\" }}{{ index .Hosts 1 }}\n{{ end }}\n")
+
+	source, err = resolver.Find(relative)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if source.Path != builtin || len(source.Overrides) != 2 || source.Overrides[0] != packageOverride || source.Overrides[1] != envOverride {
+		t.Fatalf("expected package then environment overrides over the built-in body, got %+v", source)
+	}
+
+	renderer := NewRenderer(repo)
+	data := map[string][]string{"Hosts": {"node1", "node2"}}
+	out, err := renderer.RenderSource(source, data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := "[all]\nnode1 ansible_user=ops\nnode2 ansible_user=ops\n\n[etcd]\nnode2\n"
+	if out != want {
+		t.Fatalf("render = %q, want %q", out, want)
+	}
+
+	// Output lines map to the file that produced them
+	path, line, err := renderer.SourceLine(source, data, 3)
+	if err != nil || path != packageOverride || line != 2 {
+		t.Fatalf("line 3 mapped to %s:%d (%v), want %s:2", path, line, err, packageOverride)
+	}
+
+	// A full template replaces the body and the layers below it
+	writeTemplate(t, packageOverride, "[all]\nreplaced\n")
+	source, err = resolver.Find(relative)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if source.Path != packageOverride || source.Origin != OriginPackage || len(source.Overrides) != 1 {
+		t.Fatalf("expected the package template with the environment override, got %+v", source)
+	}
+
+	if _, err := resolver.Find("missing.yaml.tmpl"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestHelpersAreSharedAndRedefinable(t *testing.T) {
+	repo := t.TempDir()
+	builtinHelpers := filepath.Join(repo, "api", "templates", HelpersDir, "common.tmpl")
+	writeTemplate(t, builtinHelpers, "{{/* shared */}}\n{{ define \"pn.name\" }}{{ .Name }}{{ end }}\n{{ define \"pn.list\" }}{{ range .Items }}- {{ . }}\n{{ end }}{{ end }}\n")
+	writeTemplate(t, filepath.Join(repo, "api", "templates", "platform", "platform.yaml.tmpl"),
+		"name: {{ template \"pn.name\" . }}\nitems:\n{{ include \"pn.list\" (dict \"Items\" .Items) | indent 2 }}")
+
+	resolver := NewPathResolver(repo)
+	resolver.SearchPath = SearchPath(repo, "core", "development")
+	source, err := resolver.Find(filepath.Join("platform", "platform.yaml.tmpl"))
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(source.Helpers) != 1 || source.Helpers[0] != builtinHelpers {
+		t.Fatalf("expected the built-in helpers, got %+v", source.Helpers)
+	}
+
+	renderer := NewRenderer(repo)
+	data := map[string]interface{}{"Name": "dev", "Items": []string{"a", "b"}}
+	out, err := renderer.RenderSource(source, data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if want := "name: dev\nitems:\n  - a\n  - b\n"; out != want {
+		t.Fatalf("render = %q, want %q", out, want)
+	}
+
+	// A package helper redefines a built-in partial for every template
+	packageHelpers := filepath.Join(repo, "config", "packages", "core", "templates", HelpersDir, "naming.tmpl")
+	writeTemplate(t, packageHelpers, "{{ define \"pn.name\" }}core-{{ .Name }}{{ end }}")
+	source, err = resolver.Find(filepath.Join("platform", "platform.yaml.tmpl"))
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if out, err = renderer.RenderSource(source, data); err != nil || !strings.HasPrefix(out, "name: core-dev\n") {
+		t.Fatalf("expected the package helper to win, got %q (%v)", out, err)
+	}
+
+	// Helpers may only define partials
+	writeTemplate(t, packageHelpers, "stray: output\n{{ define \"pn.name\" }}x{{ end }}")
+	if _, err := resolver.Find(filepath.Join("platform", "platform.yaml.tmpl")); err == nil || !strings.Contains(err.Error(), packageHelpers) {
+		t.Fatalf("expected an error naming %s, got %v", packageHelpers, err)
+	}
+}
+
+func TestIncludeRejectsRunawayRecursion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "loop.tmpl")
+	writeTemplate(t, path, "{{ define \"loop\" }}{{ include \"loop\" . }}{{ end }}{{ include \"loop\" . }}")
+	if _, err := NewRenderer(dir).Render(path, nil); err == nil || !strings.Contains(err.Error(), "nested more than") {
+		t.Fatalf("expected a depth error, got %v", err)
+	}
+}
+
+func TestHeaderRendersTheSharedPartial(t *testing.T) {
+	repoRoot, err := filepath.Abs(filepath.Join("..", "..", ".."))
+	if err != nil {
+		t.Fatalf("repo root: %v", err)
+	}
+	data := &config.MergedConfig{ConfigPackage: "core", Environment: "development"}
+	header, err := NewRenderer(repoRoot).Header(NewPathResolver(repoRoot), data)
+	if err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	if want := "# Generated from config package: core\n# Environment: development\n"; header != want {
+		t.Fatalf("header = %q, want %q", header, want)
+	}
+
+	// A package redefining the partial changes the header of generated files too
+	repo := t.TempDir()
+	writeTemplate(t, filepath.Join(repo, "api", "templates", HelpersDir, "common.tmpl"), "{{ define \"pn.header\" }}# {{ .Environment }}{{ end }}")
+	writeTemplate(t, filepath.Join(repo, "config", "packages", "core", "templates", HelpersDir, "header.tmpl"), "{{ define \"pn.header\" }}# core {{ .Environment }}{{ end }}")
+	resolver := NewPathResolver(repo)
+	resolver.SearchPath = SearchPath(repo, "core", "development")
+	if header, err := NewRenderer(repo).Header(resolver, data); err != nil || header != "# core development\n" {
+		t.Fatalf("expected the package header, got %q (%v)", header, err)
+	}
+}
@@ -0,0 +1,116 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"text/template/parse"
+)
+
+// Line markers are injected after every newline of the templates' literal
+// text so each output line can be traced to the file and line it starts on.
+// A marker is markerStart, the file index in Source.Files, ':', the line and
+// markerEnd.
+const (
+	markerStart = '\x00'
+	markerEnd   = '\x01'
+)
+
+// SourceLine maps a 1-based line of the rendered output back to the template
+// file and line that produced it. Output lines that do not start with literal
+// template text (e.g. the continuation of a multi-line toYaml) map to the
+// nearest preceding marked line, which is where the action sits.
+func (r *Renderer) SourceLine(src Source, data interface{}, outputLine int) (string, int, error) {
+	tmpl, contents, err := r.parse(src)
+	if err != nil {
+		return "", 0, err
+	}
+	files := src.Files()
+	index := make(map[string]int, len(files))
+	for i, path := range files {
+		index[path] = i
+	}
+	index[filepath.Base(src.Path)] = 0
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			markNode(t.Tree.Root, contents[t.Tree.ParseName], index[t.Tree.ParseName])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", 0, fmt.Errorf("execute template %s: %w", src.Path, err)
+	}
+
+	lines := bytes.Split(buf.Bytes(), []byte("\n"))
+	if outputLine < 1 || outputLine > len(lines) {
+		return "", 0, fmt.Errorf("output line %d not found in %s", outputLine, src.Path)
+	}
+	for i := outputLine - 1; i >= 0; i-- {
+		if file, line, ok := leadingMarker(lines[i]); ok && file < len(files) {
+			return files[file], line, nil
+		}
+	}
+	// The first output line carries no marker; it starts the template
+	return src.Path, 1, nil
+}
+
+func markNode(node parse.Node, source []byte, file int) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			markNode(child, source, file)
+		}
+	case *parse.TextNode:
+		line := bytes.Count(source[:n.Pos], []byte("\n")) + 1
+		var marked []byte
+		for _, b := range n.Text {
+			marked = append(marked, b)
+			if b == '\n' {
+				line++
+				marked = append(marked, markerStart)
+				marked = strconv.AppendInt(marked, int64(file), 10)
+				marked = append(marked, ':')
+				marked = strconv.AppendInt(marked, int64(line), 10)
+				marked = append(marked, markerEnd)
+			}
+		}
+		n.Text = marked
+	case *parse.IfNode:
+		markNode(n.List, source, file)
+		markNode(n.ElseList, source, file)
+	case *parse.RangeNode:
+		markNode(n.List, source, file)
+		markNode(n.ElseList, source, file)
+	case *parse.WithNode:
+		markNode(n.List, source, file)
+		markNode(n.ElseList, source, file)
+	}
+}
+
+func leadingMarker(line []byte) (file, lineNumber int, ok bool) {
+	if len(line) == 0 || line[0] != markerStart {
+		return 0, 0, false
+	}
+	end := bytes.IndexByte(line, markerEnd)
+	if end < 0 {
+		return 0, 0, false
+	}
+	fileText, lineText, found := bytes.Cut(line[1:end], []byte(":"))
+	if !found {
+		return 0, 0, false
+	}
+	file, err := strconv.Atoi(string(fileText))
+	if err != nil {
+		return 0, 0, false
+	}
+	lineNumber, err = strconv.Atoi(string(lineText))
+	if err != nil {
+		return 0, 0, false
+	}
+	return file, lineNumber, true
+}
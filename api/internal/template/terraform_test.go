@@ -0,0 +1,165 @@
+package template
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"pn-infra/api/internal/config"
+)
+
+// TestTerraformFormatsAgree renders the terraform.tfvars template of every
+// registered platform and the terraform.tfvars.json artifact of the same
+// config, loaded from the golden matrix fixture, and compares the variables
+// they set. The empty case drops the platform settings so that unset lists
+// and strings are compared too.
+func TestTerraformFormatsAgree(t *testing.T) {
+	repoRoot, err := filepath.Abs(filepath.Join("..", "..", ".."))
+	if err != nil {
+		t.Fatalf("repo root: %v", err)
+	}
+	fixture := filepath.Join(repoRoot, "api", "internal", "commands", "testdata", "matrix")
+
+	for _, platform := range config.Platforms() {
+		for _, empty := range []bool{false, true} {
+			name := platform
+			if empty {
+				name += "/empty"
+			}
+			t.Run(name, func(t *testing.T) {
+				loader := config.NewLoader(fixture, "matrix", "development")
+				master, err := loader.LoadMasterConfig()
+				if err != nil {
+					t.Fatalf("load master config: %v", err)
+				}
+				master.Infrastructure.Platform = platform
+				master.Infrastructure.Provider = "terraform"
+				merged, err := loader.LoadAndMergeFor(master)
+				if err != nil {
+					t.Fatalf("load and merge: %v", err)
+				}
+				if empty {
+					merged.Proxmox = &config.ProxmoxSettings{}
+					merged.AWS = &config.AWSSettings{}
+					merged.GCP = &config.GCPSettings{}
+					merged.Azure = &config.AzureSettings{}
+					merged.Networks = config.NetworksConfig{}
+					merged.InfrastructureOverrides = nil
+				}
+				compareTerraformFormats(t, repoRoot, merged)
+			})
+		}
+	}
+}
+
+// TestTerraformFormatsAgreeOnManagementNetwork checks that both Proxmox
+// formats pick the same network for the VM gateway, VLAN and DNS, and keep
+// quotes, backslashes and interpolation sequences in strings literally
+func TestTerraformFormatsAgreeOnManagementNetwork(t *testing.T) {
+	repoRoot, err := filepath.Abs(filepath.Join("..", "..", ".."))
+	if err != nil {
+		t.Fatalf("repo root: %v", err)
+	}
+	networks := map[string][]config.Network{
+		"management": {
+			{Name: "pods", CIDR: "10.244.0.0/16"},
+			{Name: "management", CIDR: "10.0.0.0/24", Gateway: "10.0.0.1", VlanID: 10, DNSServers: []string{"10.0.0.2"}},
+		},
+		"first network": {
+			{Name: "lan", CIDR: "192.168.1.0/24", Gateway: "192.168.1.1", VlanID: 20},
+			{Name: "pods", CIDR: "10.244.0.0/16"},
+		},
+		"no network": nil,
+	}
+	for name, networks := range networks {
+		t.Run(name, func(t *testing.T) {
+			compareTerraformFormats(t, repoRoot, &config.MergedConfig{
+				Environment:             "development",
+				ConfigPackage:           "core",
+				Infrastructure:          config.InfrastructureChoice{Platform: "proxmox", Provider: "terraform"},
+				Proxmox:                 &config.ProxmoxSettings{NodeName: "pve-01"},
+				InfrastructureOverrides: map[string]interface{}{"endpoint": "https://pve:8006/api2/json", "api_token_secret": `s"e\c${r}%{e}t`},
+				Networks:                config.NetworksConfig{Networks: networks},
+				SSH:                     config.SSHConfig{User: "ansible", PublicKey: `ssh-ed25519 AAAA "ops" ${USER}`},
+				Hosts: []config.Host{
+					{Name: "master-01", Role: "master", IP: "10.0.0.11", CPU: 4, Memory: 8192, Disk: 100, Labels: []string{"ssd"}},
+					{Name: "worker-01", Role: "worker", IP: "10.0.0.21", CPU: 8, Memory: 16384, Disk: 200},
+				},
+			})
+		})
+	}
+}
+
+// compareTerraformFormats renders merged in hcl and json format and fails
+// on every variable the two set differently
+func compareTerraformFormats(t *testing.T, repoRoot string, merged *config.MergedConfig) {
+	t.Helper()
+	platformName := merged.Infrastructure.Platform
+
+	merged.Infrastructure.Format = config.TerraformFormatHCL
+	src, err := NewPathResolver(repoRoot).Find(filepath.Join("infrastructure", platformName, "terraform", "terraform.tfvars.tmpl"))
+	if err != nil {
+		t.Fatalf("find template: %v", err)
+	}
+	rendered, err := NewRenderer(repoRoot).RenderSource(src, merged)
+	if err != nil {
+		t.Fatalf("render hcl: %v", err)
+	}
+	file, diags := hclparse.NewParser().ParseHCL([]byte(rendered), "terraform.tfvars")
+	if diags.HasErrors() {
+		t.Fatalf("parse hcl: %v\n%s", diags, rendered)
+	}
+	attributes, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("hcl attributes: %v", diags)
+	}
+	hcl := make(map[string]interface{}, len(attributes))
+	for name, attribute := range attributes {
+		value, diags := attribute.Expr.Value(nil)
+		if diags.HasErrors() {
+			t.Fatalf("evaluate %s: %v", name, diags)
+		}
+		data, err := ctyjson.Marshal(value, value.Type())
+		if err != nil {
+			t.Fatalf("encode %s: %v", name, err)
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("decode %s: %v", name, err)
+		}
+		hcl[name] = decoded
+	}
+
+	merged.Infrastructure.Format = config.TerraformFormatJSON
+	platform, err := config.LookupPlatform(platformName)
+	if err != nil {
+		t.Fatalf("lookup %s: %v", platformName, err)
+	}
+	artifacts, err := platform.Artifacts(merged)
+	if err != nil || len(artifacts) != 1 {
+		t.Fatalf("expected one artifact, got %+v (%v)", artifacts, err)
+	}
+	data, err := json.Marshal(artifacts[0].Data)
+	if err != nil {
+		t.Fatalf("marshal variables: %v", err)
+	}
+	var variables map[string]interface{}
+	if err := json.Unmarshal(data, &variables); err != nil {
+		t.Fatalf("unmarshal variables: %v", err)
+	}
+
+	for name, value := range variables {
+		if !reflect.DeepEqual(hcl[name], value) {
+			t.Errorf("%s: hcl %#v, json %#v", name, hcl[name], value)
+		}
+	}
+	for name := range hcl {
+		if _, ok := variables[name]; !ok {
+			t.Errorf("%s: set in hcl only", name)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package templatetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Assertion kinds
+const (
+	AssertEqual          = "equal"
+	AssertNotEqual       = "notEqual"
+	AssertContains       = "contains"
+	AssertNotContains    = "notContains"
+	AssertExists         = "exists"
+	AssertNotExists      = "notExists"
+	AssertMatchRegex     = "matchRegex"
+	AssertNotMatchRegex  = "notMatchRegex"
+	AssertLengthEqual    = "lengthEqual"
+	AssertMatchSnapshot  = "matchSnapshot"
+	AssertFailedTemplate = "failedTemplate"
+)
+
+// assertionParams lists, per kind, the parameters that are required and
+// those that may be given
+var assertionParams = map[string]struct{ required, optional []string }{
+	AssertEqual:          {[]string{"path", "value"}, nil},
+	AssertNotEqual:       {[]string{"path", "value"}, nil},
+	AssertContains:       {[]string{"content"}, []string{"path"}},
+	AssertNotContains:    {[]string{"content"}, []string{"path"}},
+	AssertExists:         {[]string{"path"}, nil},
+	AssertNotExists:      {[]string{"path"}, nil},
+	AssertMatchRegex:     {[]string{"pattern"}, []string{"path"}},
+	AssertNotMatchRegex:  {[]string{"pattern"}, []string{"path"}},
+	AssertLengthEqual:    {[]string{"path", "count"}, nil},
+	AssertMatchSnapshot:  {nil, []string{"path"}},
+	AssertFailedTemplate: {nil, []string{"errorMessage", "errorPattern"}},
+}
+
+// Assertion is one check of a test, written as a single-key map from its
+// kind to its parameters:
+//
+//   - equal: {path: nodes[0].role, value: control-plane}
+//
+// Paths address the parsed output: keys separated by dots, list indexes and
+// keys containing dots in brackets, e.g. metadata.labels["app.kubernetes.io/name"].
+// Every assertion but failedTemplate also takes documentIndex to pick a
+// document of a multi-document YAML output.
+type Assertion struct {
+	Kind          string
+	Path          string
+	Value         interface{}
+	Content       interface{}
+	Pattern       string
+	Count         int
+	ErrorMessage  string
+	ErrorPattern  string
+	DocumentIndex int
+
+	Line int // in the suite file
+}
+
+func (a *Assertion) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode || len(node.Content) != 2 {
+		return fmt.Errorf("line %d: an assertion is a map with one key, its kind", node.Line)
+	}
+	a.Kind, a.Line = node.Content[0].Value, node.Line
+	params, ok := assertionParams[a.Kind]
+	if !ok {
+		return fmt.Errorf("line %d: unknown assertion %q", node.Line, a.Kind)
+	}
+
+	body := node.Content[1]
+	given := map[string]*yaml.Node{}
+	if body.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(body.Content); i += 2 {
+			given[body.Content[i].Value] = body.Content[i+1]
+		}
+	} else if !(body.Kind == yaml.ScalarNode && body.Tag == "!!null") {
+		return fmt.Errorf("line %d: %s takes a map of parameters", node.Line, a.Kind)
+	}
+	allowed := map[string]bool{}
+	for _, name := range append(params.required, params.optional...) {
+		allowed[name] = true
+	}
+	if a.Kind != AssertFailedTemplate {
+		allowed["documentIndex"] = true
+	}
+	for name := range given {
+		if !allowed[name] {
+			return fmt.Errorf("line %d: %s does not take %s", node.Line, a.Kind, name)
+		}
+	}
+	for _, name := range params.required {
+		if given[name] == nil {
+			return fmt.Errorf("line %d: %s requires %s", node.Line, a.Kind, name)
+		}
+	}
+
+	targets := map[string]interface{}{
+		"path": &a.Path, "value": &a.Value, "content": &a.Content, "pattern": &a.Pattern, "count": &a.Count,
+		"errorMessage": &a.ErrorMessage, "errorPattern": &a.ErrorPattern, "documentIndex": &a.DocumentIndex,
+	}
+	for name, value := range given {
+		if err := value.Decode(targets[name]); err != nil {
+			return fmt.Errorf("line %d: %s %s: %w", value.Line, a.Kind, name, err)
+		}
+	}
+	for _, pattern := range []string{a.Pattern, a.ErrorPattern} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("line %d: %s: %w", node.Line, a.Kind, err)
+		}
+	}
+	return nil
+}
+
+// Check runs an assertion other than matchSnapshot against a rendered
+// output or the error rendering it returned
+func (a *Assertion) Check(templatePath, output string, renderErr error) error {
+	if a.Kind == AssertFailedTemplate {
+		if renderErr == nil {
+			return errors.New("expected the template to fail, but it rendered")
+		}
+		if a.ErrorMessage != "" && !strings.Contains(renderErr.Error(), a.ErrorMessage) {
+			return fmt.Errorf("expected an error containing %q, got: %v", a.ErrorMessage, renderErr)
+		}
+		if a.ErrorPattern != "" && !regexp.MustCompile(a.ErrorPattern).MatchString(renderErr.Error()) {
+			return fmt.Errorf("expected an error matching %q, got: %v", a.ErrorPattern, renderErr)
+		}
+		return nil
+	}
+	if renderErr != nil {
+		return renderErr
+	}
+
+	switch a.Kind {
+	case AssertContains, AssertNotContains, AssertMatchRegex, AssertNotMatchRegex:
+		if a.Path == "" {
+			return a.checkText(output)
+		}
+	}
+
+	value, found, err := a.Select(templatePath, output)
+	if err != nil {
+		return err
+	}
+	switch a.Kind {
+	case AssertExists:
+		if !found {
+			return fmt.Errorf("expected %s to exist", a.Path)
+		}
+		return nil
+	case AssertNotExists:
+		if found {
+			return fmt.Errorf("expected %s not to exist, found %s", a.Path, describe(value))
+		}
+		return nil
+	}
+	if !found {
+		return fmt.Errorf("%s does not exist", a.Path)
+	}
+
+	switch a.Kind {
+	case AssertEqual, AssertNotEqual:
+		if equal(value, a.Value) != (a.Kind == AssertEqual) {
+			if a.Kind == AssertEqual {
+				return fmt.Errorf("expected %s to equal %s, got %s", a.Path, describe(a.Value), describe(value))
+			}
+			return fmt.Errorf("expected %s not to equal %s", a.Path, describe(a.Value))
+		}
+	case AssertContains, AssertNotContains:
+		contained, err := contains(value, a.Content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.Path, err)
+		}
+		if contained != (a.Kind == AssertContains) {
+			if a.Kind == AssertContains {
+				return fmt.Errorf("expected %s to contain %s, got %s", a.Path, describe(a.Content), describe(value))
+			}
+			return fmt.Errorf("expected %s not to contain %s", a.Path, describe(a.Content))
+		}
+	case AssertMatchRegex, AssertNotMatchRegex:
+		text, ok := scalarText(value)
+		if !ok {
+			return fmt.Errorf("expected %s to be a scalar, got %s", a.Path, describe(value))
+		}
+		if regexp.MustCompile(a.Pattern).MatchString(text) != (a.Kind == AssertMatchRegex) {
+			return fmt.Errorf("expected %s (%q) %sto match %q", a.Path, text, negation(a.Kind == AssertNotMatchRegex), a.Pattern)
+		}
+	case AssertLengthEqual:
+		length := reflect.ValueOf(value)
+		switch length.Kind() {
+		case reflect.Slice, reflect.Map, reflect.String:
+			if length.Len() != a.Count {
+				return fmt.Errorf("expected %s to have %d items, got %d", a.Path, a.Count, length.Len())
+			}
+		default:
+			return fmt.Errorf("expected %s to be a list or map, got %s", a.Path, describe(value))
+		}
+	}
+	return nil
+}
+
+// checkText runs contains and matchRegex against the whole output
+func (a *Assertion) checkText(output string) error {
+	want := a.Kind == AssertContains || a.Kind == AssertMatchRegex
+	if a.Kind == AssertContains || a.Kind == AssertNotContains {
+		content, ok := a.Content.(string)
+		if !ok {
+			return fmt.Errorf("content must be a string to search the output without a path")
+		}
+		if strings.Contains(output, content) != want {
+			return fmt.Errorf("expected the output %sto contain %q", negation(!want), content)
+		}
+		return nil
+	}
+	if regexp.MustCompile(a.Pattern).MatchString(output) != want {
+		return fmt.Errorf("expected the output %sto match %q", negation(!want), a.Pattern)
+	}
+	return nil
+}
+
+// Select returns the value at the assertion's path in the parsed output
+func (a *Assertion) Select(templatePath, output string) (interface{}, bool, error) {
+	document, err := parseOutput(templatePath, output, a.DocumentIndex)
+	if err != nil {
+		return nil, false, err
+	}
+	return lookup(document, a.Path)
+}
+
+func negation(not bool) string {
+	if not {
+		return "not "
+	}
+	return ""
+}
+
+// parseOutput parses a rendered output by the type of the file it produces:
+// YAML, JSON or INI
+func parseOutput(templatePath, output string, documentIndex int) (interface{}, error) {
+	name := strings.TrimSuffix(filepath.Base(templatePath), ".tmpl")
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(output))
+		for i := 0; ; i++ {
+			var document interface{}
+			err := decoder.Decode(&document)
+			if err == io.EOF {
+				return nil, fmt.Errorf("output has %d YAML documents, no documentIndex %d", i, documentIndex)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("parse output as YAML: %w", err)
+			}
+			if i == documentIndex {
+				return document, nil
+			}
+		}
+	case ".json":
+		var document interface{}
+		if err := json.Unmarshal([]byte(output), &document); err != nil {
+			return nil, fmt.Errorf("parse output as JSON: %w", err)
+		}
+		return document, nil
+	case ".ini":
+		return parseINI(output), nil
+	}
+	return nil, fmt.Errorf("paths cannot address %s output; use contains, matchRegex or matchSnapshot without a path", filepath.Ext(name))
+}
+
+// parseINI reads INI and Ansible inventory files into a map of sections.
+// key=value lines become entries of their section; other lines are entries
+// named by their first word, holding the key=value pairs after it:
+//
+//	[all]
+//	node1 ansible_host=10.0.0.1   →  all.node1.ansible_host = 10.0.0.1
+//	[k8s_cluster:children]
+//	kube_node                     →  "k8s_cluster:children".kube_node = {}
+//
+// Lines before the first section belong to the section "".
+func parseINI(output string) map[string]interface{} {
+	sections := map[string]interface{}{}
+	section := map[string]interface{}{}
+	sections[""] = section
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if existing, ok := sections[name].(map[string]interface{}); ok {
+				section = existing
+			} else {
+				section = map[string]interface{}{}
+				sections[name] = section
+			}
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && !strings.ContainsAny(strings.TrimSpace(key), " \t") {
+			section[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			continue
+		}
+		fields := strings.Fields(line)
+		vars := map[string]interface{}{}
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			vars[key] = value
+		}
+		section[fields[0]] = vars
+	}
+	return sections
+}
+
+// lookup follows a path through maps and lists
+func lookup(document interface{}, path string) (interface{}, bool, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	current := document
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			key, ok := segment.(string)
+			if !ok {
+				return nil, false, nil
+			}
+			if current, ok = node[key]; !ok {
+				return nil, false, nil
+			}
+		case []interface{}:
+			index, ok := segment.(int)
+			if !ok || index >= len(node) {
+				return nil, false, nil
+			}
+			current = node[index]
+		default:
+			return nil, false, nil
+		}
+	}
+	return current, true, nil
+}
+
+// parsePath splits a path into map keys (strings) and list indexes (ints)
+func parsePath(path string) ([]interface{}, error) {
+	var segments []interface{}
+	rest := strings.TrimPrefix(path, ".")
+	for rest != "" {
+		if rest[0] == '[' {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unclosed [", path)
+			}
+			inside := rest[1:end]
+			if unquoted, err := strconv.Unquote(inside); err == nil {
+				segments = append(segments, unquoted)
+			} else if index, err := strconv.Atoi(inside); err == nil && index >= 0 {
+				segments = append(segments, index)
+			} else {
+				return nil, fmt.Errorf("path %q: [%s] is neither an index nor a quoted key", path, inside)
+			}
+			rest = strings.TrimPrefix(rest[end+1:], ".")
+			continue
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("path %q: empty key", path)
+		}
+		segments = append(segments, rest[:end])
+		rest = strings.TrimPrefix(rest[end:], ".")
+	}
+	return segments, nil
+}
+
+// equal compares values parsed from YAML, JSON or INI, through JSON so that
+// numbers compare by value whatever their type
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(canonical(a), canonical(b))
+}
+
+func canonical(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// contains reports whether a list has an item equal to content, a map has
+// the key content, or a string has the substring content
+func contains(value, content interface{}) (bool, error) {
+	switch container := value.(type) {
+	case []interface{}:
+		for _, item := range container {
+			if equal(item, content) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := content.(string)
+		if !ok {
+			return false, fmt.Errorf("content must be a key to search a map")
+		}
+		_, found := container[key]
+		return found, nil
+	case string:
+		substring, ok := content.(string)
+		if !ok {
+			return false, fmt.Errorf("content must be a string to search a string")
+		}
+		return strings.Contains(container, substring), nil
+	}
+	return false, fmt.Errorf("cannot search %s", describe(value))
+}
+
+// scalarText returns the text of a string, number or bool
+func scalarText(v interface{}) (string, bool) {
+	switch v.(type) {
+	case string, int, int64, float64, bool:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// describe formats a value for failure messages as compact JSON
+func describe(v interface{}) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(b.String())
+}
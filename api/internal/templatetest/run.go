@@ -0,0 +1,131 @@
+package templatetest
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"pn-infra/api/internal/template"
+)
+
+// Result is the outcome of a suite
+type Result struct {
+	Suite *Suite
+	Tests []TestResult
+
+	// Snapshots written for the first time, updated and removed
+	SnapshotsWritten, SnapshotsUpdated, SnapshotsRemoved int
+
+	// Err is a failure of the suite as a whole, such as unreadable snapshots
+	Err error
+}
+
+// TestResult lists the failed assertions of a test
+type TestResult struct {
+	It       string
+	Failures []string
+}
+
+// Passed reports whether every test of the suite passed
+func (r Result) Passed() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, test := range r.Tests {
+		if len(test.Failures) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Run renders each test's template with its values and checks its
+// assertions. With updateSnapshots, snapshots that differ are rewritten
+// instead of failing.
+func Run(repoRoot string, suite *Suite, updateSnapshots bool) Result {
+	result := Result{Suite: suite}
+	store, err := loadSnapshots(suite.Path, updateSnapshots)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	resolver := template.NewPathResolver(repoRoot)
+	resolver.SearchPath = suite.SearchPath
+	renderer := template.NewRenderer(repoRoot)
+	for _, test := range suite.Tests {
+		result.Tests = append(result.Tests, runTest(resolver, renderer, suite, test, store))
+	}
+
+	if err := store.save(); err != nil {
+		result.Err = err
+	}
+	result.SnapshotsWritten, result.SnapshotsUpdated, result.SnapshotsRemoved = store.Written, store.Updated, store.Removed
+	return result
+}
+
+func runTest(resolver *template.PathResolver, renderer *template.Renderer, suite *Suite, test Test, store *snapshots) TestResult {
+	result := TestResult{It: test.It}
+	fail := func(format string, args ...interface{}) {
+		result.Failures = append(result.Failures, fmt.Sprintf(format, args...))
+	}
+
+	data, err := mergedConfig(suite.Values, test.Values)
+	if err != nil {
+		fail("%v", err)
+		return result
+	}
+	source, err := resolver.Find(filepath.Join(suite.Template, test.Template))
+	if err != nil {
+		fail("%v", err)
+		return result
+	}
+	output, renderErr := renderer.RenderSource(source, data)
+
+	// A template that fails is reported once, unless a test expects it
+	expectsFailure := false
+	for _, assertion := range test.Asserts {
+		expectsFailure = expectsFailure || assertion.Kind == AssertFailedTemplate
+	}
+	if renderErr != nil && !expectsFailure {
+		fail("render %s: %v", test.Template, renderErr)
+		return result
+	}
+
+	snapshot := 0
+	for _, assertion := range test.Asserts {
+		var err error
+		if assertion.Kind == AssertMatchSnapshot {
+			snapshot++
+			err = matchSnapshot(assertion, test, snapshot, source.Path, output, store)
+		} else {
+			err = assertion.Check(source.Path, output, renderErr)
+		}
+		if err != nil {
+			fail("%s (line %d): %v", assertion.Kind, assertion.Line, err)
+		}
+	}
+	return result
+}
+
+// matchSnapshot compares the output, or the value at the assertion's path
+// as YAML, with the test's nth snapshot
+func matchSnapshot(assertion Assertion, test Test, n int, templatePath, output string, store *snapshots) error {
+	content := output
+	if assertion.Path != "" {
+		value, found, err := assertion.Select(templatePath, output)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%s does not exist", assertion.Path)
+		}
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", assertion.Path, err)
+		}
+		content = string(data)
+	}
+	return store.match(fmt.Sprintf("%s %d", test.It, n), content)
+}
@@ -0,0 +1,103 @@
+package templatetest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"pn-infra/api/internal/diff"
+)
+
+// SnapshotDir is the directory beside a suite that holds its snapshots
+const SnapshotDir = "__snapshot__"
+
+// snapshots are the recorded outputs of a suite's matchSnapshot assertions,
+// stored as a YAML map from "<test> <n>" to content in
+// tests/__snapshot__/<suite>.snap
+type snapshots struct {
+	path    string
+	entries map[string]string
+	used    map[string]bool
+	update  bool
+
+	Written, Updated, Removed int
+}
+
+func snapshotPath(suitePath string) string {
+	name := strings.TrimSuffix(filepath.Base(suitePath), ".yaml") + ".snap"
+	return filepath.Join(filepath.Dir(suitePath), SnapshotDir, name)
+}
+
+func loadSnapshots(suitePath string, update bool) (*snapshots, error) {
+	s := &snapshots{path: snapshotPath(suitePath), entries: map[string]string{}, used: map[string]bool{}, update: update}
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshots: %w", err)
+	}
+	if err := yaml.Unmarshal(content, &s.entries); err != nil {
+		return nil, fmt.Errorf("parse snapshots %s: %w", s.path, err)
+	}
+	if s.entries == nil {
+		s.entries = map[string]string{}
+	}
+	return s, nil
+}
+
+// match compares content with the snapshot stored under key. A missing
+// snapshot is recorded; a different one is an error unless updating.
+func (s *snapshots) match(key, content string) error {
+	s.used[key] = true
+	recorded, ok := s.entries[key]
+	switch {
+	case !ok:
+		s.entries[key] = content
+		s.Written++
+	case recorded == content:
+	case s.update:
+		s.entries[key] = content
+		s.Updated++
+	default:
+		return fmt.Errorf("output differs from snapshot %q (rerun with --update-snapshots to accept it):\n%s",
+			key, diff.Unified("snapshot", "rendered", []byte(recorded), []byte(content)))
+	}
+	return nil
+}
+
+// save writes the snapshots when any were written or updated. When updating,
+// snapshots no assertion used are removed.
+func (s *snapshots) save() error {
+	if s.update {
+		for key := range s.entries {
+			if !s.used[key] {
+				delete(s.entries, key)
+				s.Removed++
+			}
+		}
+	}
+	if s.Written+s.Updated+s.Removed == 0 {
+		return nil
+	}
+	if len(s.entries) == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove snapshots: %w", err)
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(s.entries)
+	if err != nil {
+		return fmt.Errorf("encode snapshots: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("create snapshot directory: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("write snapshots: %w", err)
+	}
+	return nil
+}
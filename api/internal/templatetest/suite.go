@@ -0,0 +1,234 @@
+package templatetest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"pn-infra/api/internal/config"
+	"pn-infra/api/internal/template"
+)
+
+// TestsDir is the directory beside templates that holds their test suites
+const TestsDir = "tests"
+
+// SuiteSuffix ends the file name of every test suite
+const SuiteSuffix = "_test.yaml"
+
+// Suite is a file of template tests: <template dir>/tests/<name>_test.yaml
+type Suite struct {
+	Name      string                 `yaml:"suite"`
+	Templates []string               `yaml:"templates"`        // file names in the template directory
+	Values    map[string]interface{} `yaml:"values,omitempty"` // MergedConfig fragment shared by the tests
+	Tests     []Test                 `yaml:"tests"`
+
+	Path string `yaml:"-"`
+
+	// Template is the template directory relative to its search path
+	// directory, e.g. container-orchestration/kind
+	Template   string               `yaml:"-"`
+	SearchPath []template.SearchDir `yaml:"-"`
+}
+
+// Test renders one template with the suite's values overlaid with its own
+// and checks the output
+type Test struct {
+	It       string                 `yaml:"it"`
+	Template string                 `yaml:"template,omitempty"` // required when the suite lists several
+	Values   map[string]interface{} `yaml:"values,omitempty"`
+	Asserts  []Assertion            `yaml:"asserts"`
+}
+
+// Load reads and checks a suite. The template search path is the part of
+// searchPath from the directory containing the suite down to the built-in
+// templates, so package suites test package templates layered on the
+// built-in ones.
+func Load(path string, searchPath []template.SearchDir) (*Suite, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read test suite: %w", err)
+	}
+	suite := &Suite{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(suite); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("parse test suite %s: %w", path, err)
+	}
+	suite.Path = path
+
+	templateDir := filepath.Dir(filepath.Dir(path))
+	for i, dir := range searchPath {
+		relative, err := filepath.Rel(dir.Dir, templateDir)
+		if err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			suite.Template = relative
+			suite.SearchPath = searchPath[i:]
+			break
+		}
+	}
+	if suite.SearchPath == nil {
+		return nil, fmt.Errorf("test suite %s is not in a template directory", path)
+	}
+
+	if err := suite.check(); err != nil {
+		return nil, fmt.Errorf("test suite %s: %w", path, err)
+	}
+	return suite, nil
+}
+
+func (s *Suite) check() error {
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(s.Path), SuiteSuffix)
+	}
+	if len(s.Templates) == 0 {
+		return fmt.Errorf("no templates listed")
+	}
+	if len(s.Tests) == 0 {
+		return fmt.Errorf("no tests")
+	}
+	seen := map[string]bool{}
+	for i := range s.Tests {
+		test := &s.Tests[i]
+		if test.It == "" {
+			return fmt.Errorf("tests[%d]: missing it", i)
+		}
+		if seen[test.It] {
+			return fmt.Errorf("tests[%d]: duplicate test %q", i, test.It)
+		}
+		seen[test.It] = true
+		if test.Template == "" {
+			if len(s.Templates) > 1 {
+				return fmt.Errorf("test %q: template is required when the suite lists several", test.It)
+			}
+			test.Template = s.Templates[0]
+		}
+		if len(test.Asserts) == 0 {
+			return fmt.Errorf("test %q: no asserts", test.It)
+		}
+	}
+	return nil
+}
+
+// Discover finds the test suites of the built-in templates and of every
+// config package's and environment's templates. With paths, only suites in
+// or at those paths are returned.
+func Discover(repoRoot string, paths []string) ([]*Suite, error) {
+	var suites []*Suite
+	load := func(searchPath []template.SearchDir) error {
+		root := searchPath[0].Dir
+		return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if entry.IsDir() || !strings.HasSuffix(path, SuiteSuffix) || filepath.Base(filepath.Dir(path)) != TestsDir || !selected(path, paths) {
+				return nil
+			}
+			suite, err := Load(path, searchPath)
+			if err != nil {
+				return err
+			}
+			suites = append(suites, suite)
+			return nil
+		})
+	}
+
+	// Search paths run environment, package, built-in; each suite's starts at
+	// the directory it is in
+	if err := load(template.SearchPath(repoRoot, "", "")[2:]); err != nil {
+		return nil, err
+	}
+	packages, err := filepath.Glob(filepath.Join(repoRoot, "config", "packages", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, packageDir := range packages {
+		pkg := filepath.Base(packageDir)
+		if err := load(template.SearchPath(repoRoot, pkg, "")[1:]); err != nil {
+			return nil, err
+		}
+		environments, err := os.ReadDir(filepath.Join(packageDir, "environments"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, environment := range environments {
+			if environment.IsDir() {
+				if err := load(template.SearchPath(repoRoot, pkg, environment.Name())); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	sort.Slice(suites, func(i, j int) bool { return suites[i].Path < suites[j].Path })
+	return suites, nil
+}
+
+// selected reports whether path is one of paths or inside one of them; every
+// path is selected when there are none
+func selected(path string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		relative, err := filepath.Rel(p, path)
+		if err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergedConfig builds the template data of a test from MergedConfig
+// fragments, later ones overriding earlier ones key by key. Top-level keys
+// may be written as the field names (ContainerOrchestration) or in snake
+// case (container_orchestration); unknown fields are errors.
+func mergedConfig(fragments ...map[string]interface{}) (*config.MergedConfig, error) {
+	merged := map[string]interface{}{}
+	for _, fragment := range fragments {
+		overlay(merged, fragment)
+	}
+	fields := make(map[string]interface{}, len(merged))
+	for key, value := range merged {
+		fields[strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))] = value
+	}
+
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("encode values: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var cfg config.MergedConfig
+	if err := decoder.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("values do not fit MergedConfig: %w", err)
+	}
+	return &cfg, nil
+}
+
+// overlay copies source into target, merging nested maps; lists and scalars
+// are replaced
+func overlay(target, source map[string]interface{}) {
+	for key, value := range source {
+		nested, isMap := value.(map[string]interface{})
+		existing, existingIsMap := target[key].(map[string]interface{})
+		switch {
+		case isMap && existingIsMap:
+			overlay(existing, nested)
+		case isMap:
+			copied := map[string]interface{}{}
+			overlay(copied, nested)
+			target[key] = copied
+		default:
+			target[key] = value
+		}
+	}
+}
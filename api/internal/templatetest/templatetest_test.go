@@ -0,0 +1,171 @@
+package templatetest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+// testRepo writes an inventory template with a suite beside it
+func testRepo(t *testing.T, suite string) string {
+	t.Helper()
+	repo := t.TempDir()
+	dir := filepath.Join(repo, "api", "templates", "container-orchestration", "kubespray")
+	writeFile(t, filepath.Join(dir, "inventory.ini.tmpl"), "# {{ .Environment }}\n[all]\n{{- range .Hosts }}\n{{ .Name }} ansible_host={{ .IP }}\n{{- end }}\n\n[k8s_cluster:children]\nkube_node\n")
+	writeFile(t, filepath.Join(dir, TestsDir, "inventory"+SuiteSuffix), suite)
+	return repo
+}
+
+func TestRunChecksAssertionsAgainstParsedOutput(t *testing.T) {
+	repo := testRepo(t, `
+templates: [inventory.ini.tmpl]
+values:
+  environment: development
+  hosts:
+    - {name: node1, ip: 10.0.0.1}
+tests:
+  - it: lists hosts with their address
+    values:
+      hosts:
+        - {name: node1, ip: 10.0.0.1}
+        - {name: node2, ip: 10.0.0.2}
+    asserts:
+      - equal: {path: all.node2.ansible_host, value: 10.0.0.2}
+      - lengthEqual: {path: all, count: 2}
+      - contains: {path: '["k8s_cluster:children"]', content: kube_node}
+      - matchRegex: {pattern: "(?m)^# development$"}
+  - it: fails on purpose
+    asserts:
+      - equal: {path: all.node1.ansible_host, value: 10.0.0.9}
+      - exists: {path: all.node3}
+  - it: expects a failure
+    values:
+      hosts: [{name: node1, ip: 10.0.0.1, unknown: true}]
+    asserts:
+      - failedTemplate: {}
+`)
+	suites, err := Discover(repo, nil)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if len(suites) != 1 || suites[0].Name != "inventory" || suites[0].Template != filepath.Join("container-orchestration", "kubespray") {
+		t.Fatalf("unexpected suites: %+v", suites)
+	}
+
+	result := Run(repo, suites[0], false)
+	if result.Err != nil || len(result.Tests) != 3 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if failures := result.Tests[0].Failures; len(failures) != 0 {
+		t.Fatalf("expected the first test to pass, got %v", failures)
+	}
+	failures := result.Tests[1].Failures
+	if len(failures) != 2 || !strings.Contains(failures[0], `expected all.node1.ansible_host to equal "10.0.0.9", got "10.0.0.1"`) || !strings.Contains(failures[1], "expected all.node3 to exist") {
+		t.Fatalf("unexpected failures: %v", failures)
+	}
+	// Values that do not fit MergedConfig fail the test, not the template
+	if failures := result.Tests[2].Failures; len(failures) != 1 || !strings.Contains(failures[0], "unknown") {
+		t.Fatalf("expected a values error, got %v", failures)
+	}
+}
+
+func TestSnapshotsAreWrittenComparedAndUpdated(t *testing.T) {
+	suite := `
+templates: [inventory.ini.tmpl]
+values:
+  environment: development
+  hosts: [{name: node1, ip: 10.0.0.1}]
+tests:
+  - it: renders
+    asserts:
+      - matchSnapshot: {}
+      - matchSnapshot: {path: all}
+`
+	repo := testRepo(t, suite)
+	suites, err := Discover(repo, nil)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if result := Run(repo, suites[0], false); !result.Passed() || result.SnapshotsWritten != 2 {
+		t.Fatalf("expected two snapshots written, got %+v", result)
+	}
+	snapshot, err := os.ReadFile(snapshotPath(suites[0].Path))
+	if err != nil || !strings.Contains(string(snapshot), "renders 2:") || !strings.Contains(string(snapshot), "ansible_host: 10.0.0.1") {
+		t.Fatalf("unexpected snapshot file (%v):\n%s", err, snapshot)
+	}
+	if result := Run(repo, suites[0], false); !result.Passed() || result.SnapshotsWritten != 0 {
+		t.Fatalf("expected the snapshots to match, got %+v", result)
+	}
+
+	// A changed template fails until the snapshots are updated
+	writeFile(t, suites[0].Path, strings.Replace(suite, "10.0.0.1", "10.0.0.5", 1))
+	suites, _ = Discover(repo, nil)
+	result := Run(repo, suites[0], false)
+	if result.Passed() || !strings.Contains(strings.Join(result.Tests[0].Failures, "\n"), "+node1 ansible_host=10.0.0.5") {
+		t.Fatalf("expected a snapshot diff, got %+v", result)
+	}
+	if result := Run(repo, suites[0], true); !result.Passed() || result.SnapshotsUpdated != 2 {
+		t.Fatalf("expected two snapshots updated, got %+v", result)
+	}
+	if result := Run(repo, suites[0], false); !result.Passed() {
+		t.Fatalf("expected the updated snapshots to match, got %+v", result)
+	}
+}
+
+func TestLoadRejectsInvalidSuites(t *testing.T) {
+	tests := []struct {
+		suite, want string
+	}{
+		{"templates: [a.tmpl]\ntests: [{it: x, asserts: [{equals: {path: a, value: 1}}]}]", `unknown assertion "equals"`},
+		{"templates: [a.tmpl]\ntests: [{it: x, asserts: [{equal: {path: a}}]}]", "equal requires value"},
+		{"templates: [a.tmpl]\ntests: [{it: x, asserts: [{exists: {path: a, value: 1}}]}]", "exists does not take value"},
+		{"templates: [a.tmpl, b.tmpl]\ntests: [{it: x, asserts: [{exists: {path: a}}]}]", "template is required"},
+		{"templates: [a.tmpl]\ntests: [{it: x, asserts: [{exists: {path: a}}]}, {it: x, asserts: [{exists: {path: a}}]}]", "duplicate test"},
+		{"templates: [a.tmpl]\nvalue: {}\ntests: []", "field value not found"},
+	}
+	for _, test := range tests {
+		repo := testRepo(t, test.suite)
+		if _, err := Discover(repo, nil); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Fatalf("%q: expected an error containing %q, got %v", test.suite, test.want, err)
+		}
+	}
+}
+
+func TestLookupPaths(t *testing.T) {
+	document := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "api"}},
+		"nodes":    []interface{}{map[string]interface{}{"role": "control-plane"}},
+	}
+	tests := []struct {
+		path  string
+		want  interface{}
+		found bool
+	}{
+		{`metadata.labels["app.kubernetes.io/name"]`, "api", true},
+		{"nodes[0].role", "control-plane", true},
+		{".nodes[0].role", "control-plane", true},
+		{"nodes[1].role", nil, false},
+		{"nodes.role", nil, false},
+		{"metadata.missing", nil, false},
+	}
+	for _, test := range tests {
+		got, found, err := lookup(document, test.path)
+		if err != nil || found != test.found || (found && got != test.want) {
+			t.Fatalf("lookup %s = %v, %v, %v; want %v, %v", test.path, got, found, err, test.want, test.found)
+		}
+	}
+	if _, _, err := lookup(document, "nodes[x]"); err == nil {
+		t.Fatalf("expected an error for an invalid index")
+	}
+}
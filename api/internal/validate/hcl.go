@@ -0,0 +1,32 @@
+package validate
+
+import (
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// HCL parse-checks Terraform variable files (.tfvars) so a value that breaks
+// the syntax, such as an unescaped quote, fails generation instead of
+// Terraform. Other files are accepted unchanged.
+func HCL(outputPath string, content []byte) error {
+	if filepath.Ext(outputPath) != ".tfvars" {
+		return nil
+	}
+	_, diags := hclparse.NewParser().ParseHCL(content, filepath.Base(outputPath))
+	if !diags.HasErrors() {
+		return nil
+	}
+	err := &Error{Path: outputPath, Message: "invalid HCL: " + diags.Errs()[0].Error()}
+	for _, diag := range diags {
+		if diag.Subject != nil {
+			err.Line = diag.Subject.Start.Line
+			err.Message = "invalid HCL: " + diag.Summary
+			if diag.Detail != "" {
+				err.Message += ": " + diag.Detail
+			}
+			break
+		}
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+package validate
+
+import "testing"
+
+func TestHCLRejectsBrokenTfvars(t *testing.T) {
+	if err := HCL("terraform.tfvars", []byte(`proxmox_api_token_secret = "abc"def"`+"\n")); err == nil {
+		t.Fatalf("expected unescaped quote to be rejected")
+	}
+	if err := HCL("terraform.tfvars", []byte(`proxmox_api_token_secret = "abc\"def"`+"\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := HCL("inventory.ini", []byte(`not = "hcl`)); err != nil {
+		t.Fatalf("non-tfvars output should be skipped: %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package validate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a structural problem in a rendered output. Line is the 1-based
+// line of the output, or 0 when the parser reports no position.
+type Error struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", filepath.Base(e.Path), e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", filepath.Base(e.Path), e.Message)
+}
+
+// OutputLine returns the offending output line, used by the renderer to map
+// the error back to the template
+func (e *Error) OutputLine() int {
+	return e.Line
+}
+
+// Output validates rendered content according to the output's file type:
+// JSON must parse, YAML must be a single document without duplicate keys,
+// INI inventories must have valid sections and .tfvars must parse as HCL.
+// Other file types are accepted unchanged.
+func Output(outputPath string, content []byte) error {
+	switch filepath.Ext(outputPath) {
+	case ".json":
+		return JSON(outputPath, content)
+	case ".yaml", ".yml":
+		return YAML(outputPath, content)
+	case ".ini":
+		return INI(outputPath, content)
+	case ".tfvars":
+		return HCL(outputPath, content)
+	}
+	return nil
+}
+
+// JSON checks that content is a single valid JSON value
+func JSON(outputPath string, content []byte) error {
+	var v interface{}
+	err := json.Unmarshal(content, &v)
+	if err == nil {
+		return nil
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &Error{Path: outputPath, Line: lineAt(content, syntaxErr.Offset), Message: syntaxErr.Error()}
+	}
+	return &Error{Path: outputPath, Message: err.Error()}
+}
+
+// YAML checks that content is exactly one YAML document without duplicate keys
+func YAML(outputPath string, content []byte) error {
+	return checkYAML(outputPath, content, false)
+}
+
+// YAMLStream checks a multi-document YAML stream, e.g. Kubernetes manifests
+func YAMLStream(outputPath string, content []byte) error {
+	return checkYAML(outputPath, content, true)
+}
+
+func checkYAML(outputPath string, content []byte, multiDocument bool) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	documents := 0
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			line, message := yamlErrorLine(content, err)
+			return &Error{Path: outputPath, Line: line, Message: message}
+		}
+		documents++
+		if documents > 1 && !multiDocument {
+			return &Error{Path: outputPath, Line: node.Line, Message: "unexpected second YAML document"}
+		}
+		if err := duplicateKeys(outputPath, &node); err != nil {
+			return err
+		}
+	}
+}
+
+// duplicateKeys reports the first mapping key defined twice. yaml.v3 only
+// rejects duplicates when decoding into Go values, not into nodes.
+func duplicateKeys(outputPath string, node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		seen := make(map[string]int, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode || key.Tag == "!!merge" {
+				continue
+			}
+			if first, ok := seen[key.Value]; ok {
+				return &Error{
+					Path:    outputPath,
+					Line:    key.Line,
+					Message: fmt.Sprintf("duplicate key %q (first defined on line %d)", key.Value, first),
+				}
+			}
+			seen[key.Value] = key.Line
+		}
+	}
+	for _, child := range node.Content {
+		if err := duplicateKeys(outputPath, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var yamlLinePattern = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// yamlErrorLine returns the output line of a YAML syntax error and its
+// message without the line. yaml.v3 reports the line where the enclosing
+// block starts, so "did not find expected key" names the first line of the
+// mapping rather than the bad one. The error is placed on the first line from
+// there at which the content up to it fails with the same problem.
+func yamlErrorLine(content []byte, err error) (int, string) {
+	match := yamlLinePattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, err.Error()
+	}
+	reported, _ := strconv.Atoi(match[1])
+	problem := match[2]
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	for end := reported; end <= len(lines); end++ {
+		prefixErr := decodeYAML(bytes.Join(lines[:end], nil))
+		if prefixErr == nil {
+			continue
+		}
+		if prefixMatch := yamlLinePattern.FindStringSubmatch(prefixErr.Error()); prefixMatch != nil && prefixMatch[2] == problem {
+			return end, "yaml: " + problem
+		}
+	}
+	return reported, "yaml: " + problem
+}
+
+// decodeYAML returns the first syntax error of a YAML stream
+func decodeYAML(content []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+var (
+	iniSectionPattern = regexp.MustCompile(`^\[([A-Za-z0-9_.-]+)(?::(children|vars))?\]$`)
+	iniKeyPattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*=`)
+)
+
+// INI checks an Ansible INI inventory: section headers must be [group],
+// [group:children] or [group:vars], children sections list group names and
+// vars sections hold key=value pairs; other lines start with a host name
+func INI(outputPath string, content []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	section := ""
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			match := iniSectionPattern.FindStringSubmatch(text)
+			if match == nil {
+				return &Error{Path: outputPath, Line: line, Message: fmt.Sprintf("invalid section header %q", text)}
+			}
+			section = match[2]
+			continue
+		}
+		switch section {
+		case "children":
+			if strings.ContainsAny(text, " \t=") {
+				return &Error{Path: outputPath, Line: line, Message: fmt.Sprintf("children section expects a group name, got %q", text)}
+			}
+		case "vars":
+			if !iniKeyPattern.MatchString(text) {
+				return &Error{Path: outputPath, Line: line, Message: fmt.Sprintf("vars section expects key=value, got %q", text)}
+			}
+		default:
+			if host := strings.Fields(text)[0]; strings.Contains(host, "=") {
+				return &Error{Path: outputPath, Line: line, Message: fmt.Sprintf("expected a host name, got %q", host)}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return &Error{Path: outputPath, Message: err.Error()}
+	}
+	return nil
+}
+
+// lineAt returns the 1-based line containing the byte offset
+func lineAt(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,53 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOutputReportsLine(t *testing.T) {
+	cases := []struct {
+		path    string
+		content string
+		line    int
+	}{
+		{"provisioner.json", "{\n  \"a\": 1,\n  \"b\": 2,,\n}\n", 3},
+		{"business.yaml", "applications:\n  web: 1\n  api: 2\n  web: 3\n", 4},
+		{"platform.yaml", "stacks: {}\n---\nstacks: {}\n", 2},
+		{"platform.yaml", "stacks:\n  monitoring:\n\t- enabled: true\n", 3},
+		// yaml.v3 reports where the mapping starts for a missing key
+		{"group_vars/all.yaml", "# Kubespray\n\ncluster_name: dev\ncontainer_manager: containerd\n\nkube_dns_domain: {{ .Environment }}.cluster.local\ndns_mode: coredns\n", 6},
+		{"platform.yaml", "stacks:\n  monitoring:\n    enabled: true\n    namespace: {{ x }}-monitoring\n    sync_wave: 1\n", 4},
+		{"kubespray/inventory.ini", "[all]\nmaster-01 ansible_host=10.0.0.11\n[kube_control_plane\n", 3},
+		{"kubespray/inventory.ini", "[k8s_cluster:children]\nkube_node ansible_host=x\n", 2},
+		{"terraform.tfvars", "a = 1\nb = \"x\"y\"\n", 2},
+	}
+	for _, tc := range cases {
+		err := Output(tc.path, []byte(tc.content))
+		var validationErr *Error
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("%s: expected validation error, got %v", tc.path, err)
+		}
+		if validationErr.Line != tc.line {
+			t.Fatalf("%s: expected line %d, got %d (%v)", tc.path, tc.line, validationErr.Line, err)
+		}
+	}
+}
+
+func TestOutputAcceptsValidContent(t *testing.T) {
+	cases := map[string]string{
+		"provisioner.json":        `{"roles": {"master": {"hosts": ["master-01"]}}}`,
+		"business.yaml":           "---\napplications:\n  - name: web\n  - name: api\n",
+		"kubespray/inventory.ini": "# comment\n[all]\nmaster-01 ansible_host=10.0.0.11\n\n[k8s_cluster:children]\nkube_node\n\n[all:vars]\nansible_user = ubuntu\n",
+		"terraform.tfvars":        "tags = {\n  Environment = \"dev\"\n}\n",
+		"README.txt":              "{not checked",
+	}
+	for path, content := range cases {
+		if err := Output(path, []byte(content)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+	}
+	if err := YAMLStream("manifests.yaml", []byte("kind: A\n---\nkind: B\n")); err != nil {
+		t.Fatalf("multi-document stream rejected: %v", err)
+	}
+}